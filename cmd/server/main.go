@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/rpc"
+	"github.com/shodikhuja83/wallet/pkg/server"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"github.com/shodikhuja83/wallet/pkg/walletpb"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "HTTP address to listen on")
+	grpcAddr := flag.String("grpc-addr", "", "gRPC address to listen on, empty to disable")
+	dir := flag.String("data", "", "data directory to import on start and export on shutdown")
+	trustActor := flag.Bool("trust-actor-headers", false, "record the actor sent in X-Actor-Id/X-Actor-Role headers and gRPC metadata without verification; enable only behind a proxy that authenticates requests and sets them")
+	scheduleInterval := flag.Duration("schedule-interval", time.Minute, "how often to run due scheduled payments, 0 to disable")
+	flag.Parse()
+
+	svc := &wallet.Service{}
+	if *dir != "" {
+		if err := svc.Import(*dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var httpAuth server.Authenticator
+	var grpcAuth rpc.Authenticator
+	if *trustActor {
+		httpAuth, grpcAuth = server.ClientAsserted, rpc.ClientAsserted
+	}
+
+	mu := &sync.Mutex{}
+	httpServer := &http.Server{Addr: *addr, Handler: server.NewServer(svc, mu, httpAuth)}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Printf("HTTP listening on %s", *addr)
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer = grpc.NewServer()
+		walletpb.RegisterWalletServer(grpcServer, rpc.NewServer(svc, mu, grpcAuth))
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		log.Printf("gRPC listening on %s", *grpcAddr)
+	}
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	if *scheduleInterval > 0 {
+		go wallet.NewScheduler(svc, mu, *scheduleInterval).Run(schedulerCtx)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	stopScheduler()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Print(err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+
+	if *dir != "" {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := svc.Export(*dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// app состояние одного запуска команды
+type app struct {
+	ctx    context.Context
+	dir    string
+	json   bool
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	svc    *wallet.Service
+	actor  wallet.Actor
+}
+
+// session операции сервиса от имени исполнителя, указанного флагом -actor
+func (a *app) session() *wallet.Session {
+	return a.svc.As(a.actor)
+}
+
+// execute загружает данные, выполняет команду и сохраняет данные, если команда их меняет
+func (a *app) execute(cmd *command, args []string) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+	if err := cmd.run(a, args); err != nil {
+		return err
+	}
+	if cmd.mutates {
+		return a.save()
+	}
+	return nil
+}
+
+func (a *app) load() error {
+	if _, err := os.Stat(a.dir); os.IsNotExist(err) {
+		return nil
+	}
+	return a.svc.Import(a.dir)
+}
+
+func (a *app) save() error {
+	if err := os.MkdirAll(a.dir, 0777); err != nil {
+		return err
+	}
+	return a.svc.Export(a.dir)
+}
+
+// print выводит v в JSON или таблицей через table
+func (a *app) print(v interface{}, table func(w io.Writer)) error {
+	if a.json {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func row(w io.Writer, values ...interface{}) {
+	for i, value := range values {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, value)
+	}
+	fmt.Fprintln(w)
+}
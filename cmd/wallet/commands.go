@@ -0,0 +1,860 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// command подкоманда wallet
+type command struct {
+	name    string
+	usage   string
+	mutates bool
+	run     func(a *app, args []string) error
+}
+
+// commands все подкоманды, name может состоять из группы и действия
+var commands = []*command{
+	{name: "account register", usage: "account register <phone>", mutates: true, run: accountRegister},
+	{name: "account show", usage: "account show <account>", run: accountShow},
+	{name: "account list", usage: "account list", run: accountList},
+	{name: "account tier", usage: "account tier [-reason reason] <account> <tier>", mutates: true, run: accountTier},
+	{name: "deposit", usage: "deposit [-key key] <account> <amount>", mutates: true, run: deposit},
+	{name: "withdraw", usage: "withdraw <account> <amount>", mutates: true, run: withdraw},
+	{name: "pay", usage: "pay [-key key] [-merchant merchant] <account> <amount> <category>", mutates: true, run: pay},
+	{name: "reject", usage: "reject <payment>", mutates: true, run: reject},
+	{name: "confirm", usage: "confirm <payment>", mutates: true, run: confirm},
+	{name: "rewards", usage: "rewards <account>", run: rewards},
+	{name: "repeat", usage: "repeat <payment>", mutates: true, run: repeat},
+	{name: "favorite add", usage: "favorite add <payment> <name>", mutates: true, run: favoriteAdd},
+	{name: "favorite create", usage: "favorite create [-variable] <account> <name> <amount> <category>", mutates: true, run: favoriteCreate},
+	{name: "favorite pay", usage: "favorite pay [-amount amount] <favorite>", mutates: true, run: favoritePay},
+	{name: "favorite list", usage: "favorite list [account]", run: favoriteList},
+	{name: "favorite update", usage: "favorite update [-name name] [-amount amount] [-category category] [-variable=true|false] <favorite>", mutates: true, run: favoriteUpdate},
+	{name: "favorite move", usage: "favorite move <favorite> <position>", mutates: true, run: favoriteMove},
+	{name: "favorite delete", usage: "favorite delete <favorite>", mutates: true, run: favoriteDelete},
+	{name: "favorite schedule add", usage: "favorite schedule add [-start time] [-cron expr] <favorite> <kind>", mutates: true, run: favoriteScheduleAdd},
+	{name: "favorite schedule list", usage: "favorite schedule list [favorite]", run: favoriteScheduleList},
+	{name: "favorite schedule cancel", usage: "favorite schedule cancel <schedule>", mutates: true, run: favoriteScheduleCancel},
+	{name: "category add", usage: "category add <id> [name] [parent]", mutates: true, run: categoryAdd},
+	{name: "category list", usage: "category list [parent]", run: categoryList},
+	{name: "category enable", usage: "category enable <category>", mutates: true, run: categoryEnable},
+	{name: "category disable", usage: "category disable <category>", mutates: true, run: categoryDisable},
+	{name: "merchant register", usage: "merchant register <name> <account> [category...]", mutates: true, run: merchantRegister},
+	{name: "merchant list", usage: "merchant list", run: merchantList},
+	{name: "merchant settle", usage: "merchant settle [merchant]", mutates: true, run: merchantSettle},
+	{name: "budget set", usage: "budget set [-thresholds 80,100] <account> <category> <period> <limit>", mutates: true, run: budgetSet},
+	{name: "budget list", usage: "budget list <account>", run: budgetList},
+	{name: "budget delete", usage: "budget delete <budget>", mutates: true, run: budgetDelete},
+	{name: "export", usage: "export <dir>", run: exportTo},
+	{name: "import", usage: "import <dir>", mutates: true, run: importFrom},
+	{name: "history", usage: "history <account>", run: history},
+	{name: "sum", usage: "sum [-goroutines n]", run: sum},
+}
+
+// findCommand ищет подкоманду по первым аргументам и возвращает её вместе с оставшимися аргументами
+func findCommand(args []string) (*command, []string) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// parseFlags разбирает флаги подкоманды и проверяет количество позиционных аргументов
+func parseFlags(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, usagef("%v", err)
+	}
+	rest := fs.Args()
+	if len(rest) < min || len(rest) > max {
+		return nil, usagef("wrong number of arguments")
+	}
+	return rest, nil
+}
+
+func positional(args []string, min int, max int) ([]string, error) {
+	return parseFlags(flag.NewFlagSet("", flag.ContinueOnError), args, min, max)
+}
+
+func parseAccountID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, usagef("invalid account id %q", value)
+	}
+	return id, nil
+}
+
+func parseAmount(value string) (types.Money, error) {
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, usagef("invalid amount %q", value)
+	}
+	return types.Money(amount), nil
+}
+
+// printAccounts выводит один счёт объектом, а список - массивом
+func (a *app) printAccounts(single bool, accounts ...types.Account) error {
+	var v interface{} = accounts
+	if single {
+		v = accounts[0]
+	} else if accounts == nil {
+		v = []types.Account{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "PHONE", "BALANCE", "TIER")
+		for _, account := range accounts {
+			row(w, account.ID, account.Phone, account.Balance, account.Tier)
+		}
+	})
+}
+
+func (a *app) printPayments(single bool, payments ...types.Payment) error {
+	var v interface{} = payments
+	if single {
+		v = payments[0]
+	} else if payments == nil {
+		v = []types.Payment{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "ACCOUNT", "AMOUNT", "CATEGORY", "STATUS", "CREATED")
+		for _, payment := range payments {
+			row(w, payment.ID, payment.AccountID, payment.Amount, payment.Category, payment.Status, payment.Created.Format("2006-01-02 15:04:05"))
+		}
+	})
+}
+
+func (a *app) printFavorites(single bool, favorites ...types.Favorite) error {
+	var v interface{} = favorites
+	if single {
+		v = favorites[0]
+	} else if favorites == nil {
+		v = []types.Favorite{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "ACCOUNT", "NAME", "AMOUNT", "CATEGORY", "VARIABLE")
+		for _, favorite := range favorites {
+			row(w, favorite.ID, favorite.AccountID, favorite.Name, favorite.Amount, favorite.Category, favorite.VariableAmount)
+		}
+	})
+}
+
+func (a *app) printSchedules(single bool, schedules ...types.Schedule) error {
+	var v interface{} = schedules
+	if single {
+		v = schedules[0]
+	} else if schedules == nil {
+		v = []types.Schedule{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "FAVORITE", "KIND", "CRON", "NEXT RUN", "ACTIVE")
+		for _, schedule := range schedules {
+			row(w, schedule.ID, schedule.FavoriteID, schedule.Kind, schedule.Cron, schedule.NextRun.Format("2006-01-02 15:04:05"), schedule.Active)
+		}
+	})
+}
+
+func (a *app) printCategories(single bool, categories ...types.Category) error {
+	var v interface{} = categories
+	if single {
+		v = categories[0]
+	} else if categories == nil {
+		v = []types.Category{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "NAME", "PARENT", "ENABLED")
+		for _, category := range categories {
+			row(w, category.ID, category.Name, category.Parent, category.Enabled)
+		}
+	})
+}
+
+func (a *app) printMerchants(single bool, merchants ...types.Merchant) error {
+	var v interface{} = merchants
+	if single {
+		v = merchants[0]
+	} else if merchants == nil {
+		v = []types.Merchant{}
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "NAME", "CATEGORIES", "ACCOUNT", "BALANCE")
+		for _, merchant := range merchants {
+			categories := make([]string, 0, len(merchant.Categories))
+			for _, category := range merchant.Categories {
+				categories = append(categories, string(category))
+			}
+			row(w, merchant.ID, merchant.Name, strings.Join(categories, ","), merchant.SettlementAccountID, merchant.Balance)
+		}
+	})
+}
+
+func (a *app) printSettlements(reports []wallet.SettlementReport) error {
+	if reports == nil {
+		reports = []wallet.SettlementReport{}
+	}
+	return a.print(reports, func(w io.Writer) {
+		row(w, "ID", "MERCHANT", "ACCOUNT", "PAYMENTS", "GROSS", "REJECTED", "AMOUNT")
+		for _, report := range reports {
+			settlement := report.Settlement
+			row(w, settlement.ID, settlement.MerchantID, settlement.AccountID, len(report.Entries),
+				settlement.Gross, settlement.Rejected, settlement.Amount)
+		}
+	})
+}
+
+func (a *app) printBudgets(single bool, usages ...wallet.BudgetUsage) error {
+	var v interface{} = usages
+	if single {
+		v = usages[0]
+	}
+	return a.print(v, func(w io.Writer) {
+		row(w, "ID", "ACCOUNT", "CATEGORY", "PERIOD", "LIMIT", "SPENT", "REMAINING", "PERCENT")
+		for _, usage := range usages {
+			budget := usage.Budget
+			row(w, budget.ID, budget.AccountID, budget.Category, budget.Period, budget.Limit, usage.Spent, usage.Remaining, usage.Percent)
+		}
+	})
+}
+
+func (a *app) printRewards(balance *wallet.RewardBalance) error {
+	return a.print(balance, func(w io.Writer) {
+		row(w, "POINTS", balance.Points)
+		row(w, "CASHBACK", balance.Cashback)
+		row(w)
+		row(w, "ID", "PAYMENT", "RULE", "KIND", "AMOUNT", "REVERSED", "CREATED")
+		for _, reward := range balance.History {
+			row(w, reward.ID, reward.PaymentID, reward.Rule, reward.Kind, reward.Amount, reward.Reversed, reward.Created.Format("2006-01-02 15:04:05"))
+		}
+	})
+}
+
+func accountRegister(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	account, err := a.session().RegisterAccount(types.Phone(args[0]))
+	if err != nil {
+		return err
+	}
+	return a.printAccounts(true, *account)
+}
+
+func accountShow(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	account, err := a.svc.FindAccountByID(id)
+	if err != nil {
+		return err
+	}
+	return a.printAccounts(true, *account)
+}
+
+func accountList(a *app, args []string) error {
+	if _, err := positional(args, 0, 0); err != nil {
+		return err
+	}
+	return a.printAccounts(false, a.svc.Accounts()...)
+}
+
+func accountTier(a *app, args []string) error {
+	fs := flag.NewFlagSet("account tier", flag.ContinueOnError)
+	reason := fs.String("reason", "", "reason recorded in the tier history")
+	args, err := parseFlags(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := a.session().SetAccountTier(id, types.AccountTier(strings.ToUpper(args[1])), *reason); err != nil {
+		return err
+	}
+	account, err := a.svc.FindAccountByID(id)
+	if err != nil {
+		return err
+	}
+	return a.printAccounts(true, *account)
+}
+
+func deposit(a *app, args []string) error {
+	fs := flag.NewFlagSet("deposit", flag.ContinueOnError)
+	key := fs.String("key", "", "idempotency key")
+	args, err := parseFlags(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return err
+	}
+	if err := a.session().DepositWithKey(*key, id, amount); err != nil {
+		return err
+	}
+	account, err := a.svc.FindAccountByID(id)
+	if err != nil {
+		return err
+	}
+	return a.printAccounts(true, *account)
+}
+
+func withdraw(a *app, args []string) error {
+	args, err := positional(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return err
+	}
+	if _, err := a.session().Withdraw(id, amount); err != nil {
+		return err
+	}
+	account, err := a.svc.FindAccountByID(id)
+	if err != nil {
+		return err
+	}
+	return a.printAccounts(true, *account)
+}
+
+func pay(a *app, args []string) error {
+	fs := flag.NewFlagSet("pay", flag.ContinueOnError)
+	key := fs.String("key", "", "idempotency key")
+	merchant := fs.String("merchant", "", "merchant to pay, category defaults to the merchant's first one")
+	args, err := parseFlags(fs, args, 2, 3)
+	if err != nil {
+		return err
+	}
+	if len(args) < 3 && *merchant == "" {
+		return usagef("wrong number of arguments")
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return err
+	}
+	category := types.PaymentCategory("")
+	if len(args) == 3 {
+		category = types.PaymentCategory(args[2])
+	}
+	var payment *types.Payment
+	if *merchant != "" {
+		payment, err = a.session().PayMerchantWithKey(*key, id, *merchant, amount, category)
+	} else {
+		payment, err = a.session().PayWithKey(*key, id, amount, category)
+	}
+	if err != nil {
+		return err
+	}
+	return a.printPayments(true, *payment)
+}
+
+func confirm(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.session().Confirm(args[0]); err != nil {
+		return err
+	}
+	payment, err := a.svc.FindPaymentByID(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printPayments(true, *payment)
+}
+
+func rewards(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	balance, err := a.svc.Rewards(id)
+	if err != nil {
+		return err
+	}
+	return a.printRewards(balance)
+}
+
+func reject(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.session().Reject(args[0]); err != nil {
+		return err
+	}
+	payment, err := a.svc.FindPaymentByID(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printPayments(true, *payment)
+}
+
+func repeat(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	payment, err := a.session().Repeat(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printPayments(true, *payment)
+}
+
+func favoriteAdd(a *app, args []string) error {
+	args, err := positional(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	favorite, err := a.session().FavoritePayment(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return a.printFavorites(true, *favorite)
+}
+
+func favoriteCreate(a *app, args []string) error {
+	fs := flag.NewFlagSet("favorite create", flag.ContinueOnError)
+	variable := fs.Bool("variable", false, "amount is entered on payment, <amount> is the default")
+	args, err := parseFlags(fs, args, 4, 4)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	amount, err := parseAmount(args[2])
+	if err != nil {
+		return err
+	}
+	favorite, err := a.session().CreateFavorite(id, args[1], amount, types.PaymentCategory(args[3]), *variable)
+	if err != nil {
+		return err
+	}
+	return a.printFavorites(true, *favorite)
+}
+
+func favoritePay(a *app, args []string) error {
+	fs := flag.NewFlagSet("favorite pay", flag.ContinueOnError)
+	amount := fs.String("amount", "", "amount for a variable-amount favorite")
+	args, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	var payment *types.Payment
+	if *amount != "" {
+		var value types.Money
+		if value, err = parseAmount(*amount); err != nil {
+			return err
+		}
+		payment, err = a.session().PayFromFavoriteWithAmount(args[0], value)
+	} else {
+		payment, err = a.session().PayFromFavorite(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return a.printPayments(true, *payment)
+}
+
+func favoriteList(a *app, args []string) error {
+	args, err := positional(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	favorites := a.svc.Favorites()
+	if len(args) == 1 {
+		id, err := parseAccountID(args[0])
+		if err != nil {
+			return err
+		}
+		if favorites, err = a.svc.ListFavorites(id); err != nil {
+			return err
+		}
+	}
+	return a.printFavorites(false, favorites...)
+}
+
+func favoriteUpdate(a *app, args []string) error {
+	fs := flag.NewFlagSet("favorite update", flag.ContinueOnError)
+	name := fs.String("name", "", "new name")
+	amount := fs.String("amount", "", "new amount")
+	category := fs.String("category", "", "new category")
+	variable := fs.Bool("variable", false, "amount is entered on payment")
+	args, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	// меняются только явно указанные флаги
+	var update wallet.FavoriteUpdate
+	var parseErr error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			update.Name = name
+		case "amount":
+			value, err := parseAmount(*amount)
+			if err != nil {
+				parseErr = err
+				return
+			}
+			update.Amount = &value
+		case "category":
+			value := types.PaymentCategory(*category)
+			update.Category = &value
+		case "variable":
+			update.VariableAmount = variable
+		}
+	})
+	if parseErr != nil {
+		return parseErr
+	}
+
+	favorite, err := a.session().UpdateFavorite(args[0], update)
+	if err != nil {
+		return err
+	}
+	return a.printFavorites(true, *favorite)
+}
+
+func favoriteMove(a *app, args []string) error {
+	args, err := positional(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	position, err := strconv.Atoi(args[1])
+	if err != nil {
+		return usagef("invalid position %q", args[1])
+	}
+	if err := a.session().MoveFavorite(args[0], position); err != nil {
+		return err
+	}
+	favorite, err := a.svc.FindFavoriteByID(args[0])
+	if err != nil {
+		return err
+	}
+	favorites, err := a.svc.ListFavorites(favorite.AccountID)
+	if err != nil {
+		return err
+	}
+	return a.printFavorites(false, favorites...)
+}
+
+func favoriteDelete(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return a.session().DeleteFavorite(args[0])
+}
+
+func favoriteScheduleAdd(a *app, args []string) error {
+	fs := flag.NewFlagSet("favorite schedule add", flag.ContinueOnError)
+	startValue := fs.String("start", "", "first run in RFC 3339, default now")
+	expr := fs.String("cron", "", "cron expression for the cron kind")
+	args, err := parseFlags(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	kind := types.ScheduleKind(strings.ToUpper(args[1]))
+	var schedule *types.Schedule
+	if kind == types.ScheduleCron {
+		schedule, err = a.session().ScheduleFavoriteCron(args[0], *expr)
+	} else {
+		var start time.Time
+		if *startValue != "" {
+			if start, err = time.Parse(time.RFC3339, *startValue); err != nil {
+				return usagef("invalid start %q", *startValue)
+			}
+		}
+		schedule, err = a.session().ScheduleFavorite(args[0], kind, start)
+	}
+	if err != nil {
+		return err
+	}
+	return a.printSchedules(true, *schedule)
+}
+
+func favoriteScheduleList(a *app, args []string) error {
+	args, err := positional(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	favoriteID := ""
+	if len(args) == 1 {
+		if _, err := a.svc.FindFavoriteByID(args[0]); err != nil {
+			return err
+		}
+		favoriteID = args[0]
+	}
+	return a.printSchedules(false, a.svc.Schedules(favoriteID)...)
+}
+
+func favoriteScheduleCancel(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := a.session().CancelSchedule(args[0]); err != nil {
+		return err
+	}
+	schedule, err := a.svc.FindScheduleByID(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printSchedules(true, *schedule)
+}
+
+func budgetSet(a *app, args []string) error {
+	fs := flag.NewFlagSet("budget set", flag.ContinueOnError)
+	thresholdList := fs.String("thresholds", "", "comma separated alert thresholds in percent of the limit, default 80,100")
+	args, err := parseFlags(fs, args, 4, 4)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	limit, err := parseAmount(args[3])
+	if err != nil {
+		return err
+	}
+	var thresholds []int
+	if *thresholdList != "" {
+		for _, value := range strings.Split(*thresholdList, ",") {
+			threshold, err := strconv.Atoi(value)
+			if err != nil {
+				return usagef("invalid threshold %q", value)
+			}
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	budget, err := a.session().SetBudget(id, types.PaymentCategory(args[1]), types.Period(strings.ToUpper(args[2])), limit, thresholds)
+	if err != nil {
+		return err
+	}
+	usage, err := a.svc.BudgetUsage(budget.ID)
+	if err != nil {
+		return err
+	}
+	return a.printBudgets(true, *usage)
+}
+
+func budgetList(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	usages, err := a.svc.Budgets(id)
+	if err != nil {
+		return err
+	}
+	return a.printBudgets(false, usages...)
+}
+
+func budgetDelete(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return a.session().DeleteBudget(args[0])
+}
+
+func exportTo(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return a.svc.Export(args[0])
+}
+
+func importFrom(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return a.svc.Import(args[0])
+}
+
+func history(a *app, args []string) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[0])
+	if err != nil {
+		return err
+	}
+	payments, err := a.svc.ExportAccountHistory(id)
+	if err != nil {
+		return err
+	}
+	return a.printPayments(false, payments...)
+}
+
+type sumResult struct {
+	Sum types.Money `json:"sum"`
+}
+
+func sum(a *app, args []string) error {
+	fs := flag.NewFlagSet("sum", flag.ContinueOnError)
+	goroutines := fs.Int("goroutines", 0, "number of workers, 0 - number of CPUs")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	total, err := a.svc.SumPaymentsContext(a.ctx, *goroutines)
+	if err != nil {
+		return err
+	}
+	return a.print(sumResult{Sum: total}, func(w io.Writer) {
+		row(w, "SUM")
+		row(w, total)
+	})
+}
+
+func categoryAdd(a *app, args []string) error {
+	args, err := positional(args, 1, 3)
+	if err != nil {
+		return err
+	}
+	args = append(args, "", "")
+	category, err := a.session().RegisterCategory(types.PaymentCategory(args[0]), args[1], types.PaymentCategory(args[2]))
+	if err != nil {
+		return err
+	}
+	return a.printCategories(true, *category)
+}
+
+func categoryList(a *app, args []string) error {
+	args, err := positional(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	categories := a.svc.Categories()
+	if len(args) == 1 {
+		if categories, err = a.svc.Subcategories(types.PaymentCategory(args[0])); err != nil {
+			return err
+		}
+	}
+	return a.printCategories(false, categories...)
+}
+
+func categoryEnable(a *app, args []string) error {
+	return setCategoryEnabled(a, args, true)
+}
+
+func categoryDisable(a *app, args []string) error {
+	return setCategoryEnabled(a, args, false)
+}
+
+func setCategoryEnabled(a *app, args []string, enabled bool) error {
+	args, err := positional(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id := types.PaymentCategory(args[0])
+	if enabled {
+		err = a.session().EnableCategory(id)
+	} else {
+		err = a.session().DisableCategory(id)
+	}
+	if err != nil {
+		return err
+	}
+	category, err := a.svc.FindCategoryByID(id)
+	if err != nil {
+		return err
+	}
+	return a.printCategories(true, *category)
+}
+
+func merchantRegister(a *app, args []string) error {
+	args, err := positional(args, 2, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	id, err := parseAccountID(args[1])
+	if err != nil {
+		return err
+	}
+	var categories []types.PaymentCategory
+	for _, category := range args[2:] {
+		categories = append(categories, types.PaymentCategory(category))
+	}
+	merchant, err := a.session().RegisterMerchant(args[0], categories, id)
+	if err != nil {
+		return err
+	}
+	return a.printMerchants(true, *merchant)
+}
+
+func merchantList(a *app, args []string) error {
+	if _, err := positional(args, 0, 0); err != nil {
+		return err
+	}
+	return a.printMerchants(false, a.svc.Merchants()...)
+}
+
+func merchantSettle(a *app, args []string) error {
+	args, err := positional(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		reports, err := a.session().RunSettlement()
+		if err != nil {
+			return err
+		}
+		return a.printSettlements(reports)
+	}
+	report, err := a.session().Settle(args[0])
+	if err != nil {
+		return err
+	}
+	return a.printSettlements([]wallet.SettlementReport{*report})
+}
@@ -0,0 +1,169 @@
+// Команда wallet управляет кошельком, сохранённым в каталоге данных через Export/Import.
+//
+//	wallet [-data dir] [-o table|json] [-actor name] <command> [arguments]
+//
+// Суммы указываются в минимальных единицах (дирамах).
+// Команда shell запускает интерактивный режим с историей и дополнением по Tab.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// коды завершения
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitConflict = 4
+	exitDeclined = 5
+	exitInvalid  = 6
+)
+
+// exitCodes коды завершения для ошибок сервиса
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{wallet.ErrAccountNotFound, exitNotFound},
+	{wallet.ErrPaymentNotFound, exitNotFound},
+	{wallet.ErrFavoriteNotFound, exitNotFound},
+	{wallet.ErrTransferNotFound, exitNotFound},
+	{wallet.ErrCategoryNotFound, exitNotFound},
+	{wallet.ErrMerchantNotFound, exitNotFound},
+	{wallet.ErrSettlementNotFound, exitNotFound},
+	{wallet.ErrWithdrawalNotFound, exitNotFound},
+	{wallet.ErrBudgetNotFound, exitNotFound},
+	{wallet.ErrScheduleNotFound, exitNotFound},
+	{wallet.ErrPhoneRegistered, exitConflict},
+	{wallet.ErrIdempotencyConflict, exitConflict},
+	{wallet.ErrFavoriteNameTaken, exitConflict},
+	{wallet.ErrCategoryExists, exitConflict},
+	{wallet.ErrPaymentNotInProgress, exitConflict},
+	{wallet.ErrPaymentRejected, exitConflict},
+	{wallet.ErrNotEnoughtBalance, exitDeclined},
+	{wallet.ErrBalanceLimitExceeded, exitDeclined},
+	{wallet.ErrPaymentLimitExceeded, exitDeclined},
+	{wallet.ErrTurnoverLimitExceeded, exitDeclined},
+	{wallet.ErrCategoryDisabled, exitDeclined},
+	{wallet.ErrNothingToSettle, exitDeclined},
+	{wallet.ErrAmountMustBePositive, exitInvalid},
+	{wallet.ErrSameAccount, exitInvalid},
+	{wallet.ErrUnknownTier, exitInvalid},
+	{wallet.ErrInvalidFavoriteName, exitInvalid},
+	{wallet.ErrInvalidFavoritePosition, exitInvalid},
+	{wallet.ErrFavoriteAmountFixed, exitInvalid},
+	{wallet.ErrInvalidCategory, exitInvalid},
+	{wallet.ErrUnknownCategory, exitInvalid},
+	{wallet.ErrCategoryCycle, exitInvalid},
+	{wallet.ErrInvalidMerchant, exitInvalid},
+	{wallet.ErrMerchantCategory, exitInvalid},
+	{wallet.ErrInvalidFeeRule, exitInvalid},
+	{wallet.ErrInvalidRewardRule, exitInvalid},
+	{wallet.ErrInvalidBudget, exitInvalid},
+	{wallet.ErrInvalidSchedule, exitInvalid},
+	{wallet.ErrInvalidCron, exitInvalid},
+}
+
+// usageError ошибка в аргументах команды
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run разбирает аргументы, выполняет команду и возвращает код завершения
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("data", envOr("WALLET_DATA", "."), "data directory")
+	format := fs.String("o", "table", "output format: table or json")
+	actor := fs.String("actor", envOr("WALLET_ACTOR", envOr("USER", "anonymous")), "operator name for the audit log")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: wallet [-data dir] [-o table|json] [-actor name] <command> [arguments]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "commands:")
+		printCommands(stderr)
+		fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "wallet: unknown output format %q\n", *format)
+		return exitUsage
+	}
+
+	cmd, rest := findCommand(fs.Args())
+	if cmd == nil {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a := &app{
+		ctx:    ctx,
+		dir:    *dir,
+		json:   *format == "json",
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		svc:    &wallet.Service{},
+		actor:  wallet.Actor{ID: *actor, Role: "cli"},
+	}
+	err := a.execute(cmd, rest)
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "wallet: %v\n", err)
+	var usage *usageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(stderr, "usage: wallet %s\n", cmd.usage)
+		return exitUsage
+	}
+	return exitCode(err)
+}
+
+func printCommands(w io.Writer) {
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n", cmd.usage)
+	}
+}
+
+func exitCode(err error) int {
+	for _, mapping := range exitCodes {
+		if errors.Is(err, mapping.err) {
+			return mapping.code
+		}
+	}
+	return exitError
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func runWallet(t *testing.T, dir string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"-data", dir}, args...), strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_paymentFlow(t *testing.T) {
+	dir := t.TempDir()
+
+	if code, _, stderr := runWallet(t, dir, "account", "register", "+992000000001"); code != exitOK {
+		t.Fatalf("account register exited with %d: %s", code, stderr)
+	}
+	if code, _, stderr := runWallet(t, dir, "deposit", "1", "10000"); code != exitOK {
+		t.Fatalf("deposit exited with %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runWallet(t, dir, "-o", "json", "pay", "1", "2500", "auto")
+	if code != exitOK {
+		t.Fatalf("pay exited with %d: %s", code, stderr)
+	}
+	var payment types.Payment
+	if err := json.Unmarshal([]byte(stdout), &payment); err != nil {
+		t.Fatalf("pay printed invalid json: %v", err)
+	}
+
+	if code, _, stderr := runWallet(t, dir, "favorite", "add", payment.ID, "fuel"); code != exitOK {
+		t.Fatalf("favorite add exited with %d: %s", code, stderr)
+	}
+
+	code, stdout, _ = runWallet(t, dir, "-o", "json", "account", "show", "1")
+	if code != exitOK {
+		t.Fatalf("account show exited with %d", code)
+	}
+	var account types.Account
+	if err := json.Unmarshal([]byte(stdout), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 7500 {
+		t.Errorf("balance after reload = %v, want 7500", account.Balance)
+	}
+
+	code, stdout, _ = runWallet(t, dir, "favorite", "list", "1")
+	if code != exitOK || !strings.Contains(stdout, "fuel") {
+		t.Errorf("favorite list exited with %d, output %q", code, stdout)
+	}
+
+	code, stdout, _ = runWallet(t, dir, "sum")
+	if code != exitOK || !strings.Contains(stdout, "2500") {
+		t.Errorf("sum exited with %d, output %q", code, stdout)
+	}
+}
+
+func TestRun_accountTier(t *testing.T) {
+	dir := t.TempDir()
+	runWallet(t, dir, "account", "register", "+992000000001")
+
+	if code, _, stderr := runWallet(t, dir, "account", "tier", "-reason", "passport", "1", "basic"); code != exitOK {
+		t.Fatalf("account tier exited with %d: %s", code, stderr)
+	}
+	code, stdout, _ := runWallet(t, dir, "-o", "json", "account", "show", "1")
+	if code != exitOK {
+		t.Fatalf("account show exited with %d", code)
+	}
+	var account types.Account
+	if err := json.Unmarshal([]byte(stdout), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Tier != types.TierBasic {
+		t.Errorf("tier after reload = %q, want %q", account.Tier, types.TierBasic)
+	}
+}
+
+func TestRun_favoriteSchedule(t *testing.T) {
+	dir := t.TempDir()
+	runWallet(t, dir, "account", "register", "+992000000001")
+	code, stdout, stderr := runWallet(t, dir, "-o", "json", "favorite", "create", "1", "rent", "100", "auto")
+	if code != exitOK {
+		t.Fatalf("favorite create exited with %d: %s", code, stderr)
+	}
+	var favorite types.Favorite
+	if err := json.Unmarshal([]byte(stdout), &favorite); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr = runWallet(t, dir, "-o", "json", "favorite", "schedule", "add", "-start", "2030-01-31T09:00:00Z", favorite.ID, "monthly")
+	if code != exitOK {
+		t.Fatalf("favorite schedule add exited with %d: %s", code, stderr)
+	}
+	var schedule types.Schedule
+	if err := json.Unmarshal([]byte(stdout), &schedule); err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Kind != types.ScheduleMonthly || schedule.FavoriteID != favorite.ID {
+		t.Errorf("schedule = %+v", schedule)
+	}
+	if code, _, stderr := runWallet(t, dir, "favorite", "schedule", "add", "-cron", "0 9 * * 1", favorite.ID, "cron"); code != exitOK {
+		t.Fatalf("favorite schedule add -cron exited with %d: %s", code, stderr)
+	}
+
+	code, stdout, _ = runWallet(t, dir, "-o", "json", "favorite", "schedule", "list", favorite.ID)
+	var schedules []types.Schedule
+	if err := json.Unmarshal([]byte(stdout), &schedules); err != nil || code != exitOK {
+		t.Fatalf("favorite schedule list exited with %d: %v", code, err)
+	}
+	if len(schedules) != 2 {
+		t.Errorf("schedules after reload = %+v, want 2", schedules)
+	}
+
+	if code, _, stderr := runWallet(t, dir, "favorite", "schedule", "cancel", schedule.ID); code != exitOK {
+		t.Fatalf("favorite schedule cancel exited with %d: %s", code, stderr)
+	}
+	code, stdout, _ = runWallet(t, dir, "favorite", "schedule", "list")
+	if code != exitOK || !strings.Contains(stdout, "false") {
+		t.Errorf("favorite schedule list exited with %d, output %q", code, stdout)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"schedule not found", []string{"favorite", "schedule", "cancel", "missing"}, exitNotFound},
+		{"favorite not found", []string{"favorite", "schedule", "list", "missing"}, exitNotFound},
+		{"invalid kind", []string{"favorite", "schedule", "add", favorite.ID, "yearly"}, exitInvalid},
+		{"invalid cron", []string{"favorite", "schedule", "add", "-cron", "61 * * * *", favorite.ID, "cron"}, exitInvalid},
+		{"invalid start", []string{"favorite", "schedule", "add", "-start", "tomorrow", favorite.ID, "once"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, _ := runWallet(t, dir, tt.args...); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_exitCodes(t *testing.T) {
+	dir := t.TempDir()
+	runWallet(t, dir, "account", "register", "+992000000001")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"unknown command", []string{"transfer"}, exitUsage},
+		{"missing argument", []string{"deposit", "1"}, exitUsage},
+		{"bad account id", []string{"account", "show", "one"}, exitUsage},
+		{"account not found", []string{"account", "show", "42"}, exitNotFound},
+		{"payment not found", []string{"reject", "missing"}, exitNotFound},
+		{"phone registered", []string{"account", "register", "+992000000001"}, exitConflict},
+		{"not enough balance", []string{"pay", "1", "100", "auto"}, exitDeclined},
+		{"non positive amount", []string{"deposit", "1", "0"}, exitInvalid},
+		{"unknown tier", []string{"account", "tier", "1", "gold"}, exitInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, _ := runWallet(t, dir, tt.args...); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"golang.org/x/term"
+)
+
+// shellPrompt приглашение интерактивного режима
+const shellPrompt = "wallet> "
+
+// shellBuiltins команды, которые есть только в интерактивном режиме
+var shellBuiltins = []string{"help", "save", "exit", "quit"}
+
+// placeholderPattern выделяет имена аргументов из usage: <account>, [account]
+var placeholderPattern = regexp.MustCompile(`[<\[]([a-z]+)[>\]]`)
+
+func init() {
+	// shell вызывает остальные команды через commands, поэтому добавляется здесь,
+	// а не в объявлении commands, иначе получится цикл инициализации
+	commands = append(commands, &command{name: "shell", usage: "shell", run: runShell})
+}
+
+// shell интерактивный режим: команды выполняются над загруженными в память данными,
+// изменения сохраняются через Export при выходе или по команде save
+type shell struct {
+	app   *app
+	dirty bool
+}
+
+func runShell(a *app, args []string) error {
+	if _, err := positional(args, 0, 0); err != nil {
+		return err
+	}
+	sh := &shell{app: a}
+	if f, ok := a.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if err := sh.interactive(f); err != nil {
+			return err
+		}
+	} else if err := sh.script(a.stdin); err != nil {
+		return err
+	}
+	if sh.dirty {
+		return a.save()
+	}
+	return nil
+}
+
+// interactive читает команды с терминала с историей и дополнением по Tab
+func (sh *shell) interactive(f *os.File) error {
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{f, sh.app.stdout}, shellPrompt)
+	terminal.AutoCompleteCallback = sh.autoComplete
+	sh.app.stdout = terminal
+	sh.app.stderr = terminal
+
+	for {
+		line, err := terminal.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if sh.exec(line) {
+			return nil
+		}
+	}
+}
+
+// script выполняет команды построчно из неинтерактивного ввода
+func (sh *shell) script(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if sh.exec(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// exec выполняет одну строку и возвращает true, если нужно выйти
+func (sh *shell) exec(line string) bool {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false
+	}
+
+	a := sh.app
+	switch args[0] {
+	case "exit", "quit":
+		return true
+	case "help":
+		printCommands(a.stdout)
+		fmt.Fprintf(a.stdout, "  %s\n", strings.Join(shellBuiltins, ", "))
+		return false
+	case "save":
+		if err := a.save(); err != nil {
+			fmt.Fprintf(a.stderr, "error: %v\n", err)
+			return false
+		}
+		sh.dirty = false
+		fmt.Fprintf(a.stdout, "saved to %s\n", a.dir)
+		return false
+	}
+
+	cmd, rest := findCommand(args)
+	if cmd == nil || cmd.name == "shell" {
+		fmt.Fprintf(a.stderr, "unknown command %q, type help for the list of commands\n", args[0])
+		return false
+	}
+	if err := cmd.run(a, rest); err != nil {
+		fmt.Fprintf(a.stderr, "error: %v\n", err)
+		var usage *usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintf(a.stderr, "usage: %s\n", cmd.usage)
+		}
+		return false
+	}
+	if cmd.mutates {
+		sh.dirty = true
+	}
+	return false
+}
+
+// autoComplete дополняет слово под курсором по Tab до общего префикса подходящих вариантов
+func (sh *shell) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	head := line[:pos]
+	start := strings.LastIndex(head, " ") + 1
+	prefix := head[start:]
+
+	var matches []string
+	for _, candidate := range sh.candidates(strings.Fields(head[:start])) {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	completion := commonPrefix(matches)
+	if len(matches) == 1 {
+		completion += " "
+	}
+	return head[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// candidates варианты для следующего слова после words
+func (sh *shell) candidates(words []string) []string {
+	// имя команды или действие внутри группы
+	var names []string
+	for _, cmd := range commands {
+		nameWords := strings.Fields(cmd.name)
+		if len(nameWords) > len(words) && strings.Join(nameWords[:len(words)], " ") == strings.Join(words, " ") {
+			names = appendUnique(names, nameWords[len(words)])
+		}
+	}
+	if len(words) == 0 {
+		names = append(names, shellBuiltins...)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names
+	}
+
+	cmd, rest := findCommand(words)
+	if cmd == nil {
+		return nil
+	}
+	position := 0
+	for i := 0; i < len(rest); i++ {
+		if strings.HasPrefix(rest[i], "-") {
+			// значение флага - следующее слово; булевы флаги записаны в usage как [-name]
+			if !strings.Contains(rest[i], "=") && !strings.Contains(cmd.usage, "["+rest[i]+"]") {
+				i++
+			}
+			continue
+		}
+		position++
+	}
+	placeholders := placeholderPattern.FindAllStringSubmatch(cmd.usage, -1)
+	if position >= len(placeholders) {
+		return nil
+	}
+
+	svc := sh.app.svc
+	switch placeholders[position][1] {
+	case "account":
+		var ids []string
+		for _, account := range svc.Accounts() {
+			ids = append(ids, strconv.FormatInt(account.ID, 10))
+		}
+		return ids
+	case "payment":
+		var ids []string
+		for _, payment := range allPayments(svc) {
+			ids = append(ids, payment.ID)
+		}
+		return ids
+	case "merchant":
+		var ids []string
+		for _, merchant := range svc.Merchants() {
+			ids = append(ids, merchant.ID)
+		}
+		return ids
+	case "budget":
+		var ids []string
+		for _, account := range svc.Accounts() {
+			usages, _ := svc.Budgets(account.ID)
+			for _, usage := range usages {
+				ids = append(ids, usage.Budget.ID)
+			}
+		}
+		return ids
+	case "period":
+		return []string{string(types.PeriodDay), string(types.PeriodMonth), string(types.PeriodWeek)}
+	case "favorite":
+		var ids []string
+		for _, favorite := range svc.Favorites() {
+			ids = append(ids, favorite.ID)
+		}
+		return ids
+	case "schedule":
+		var ids []string
+		for _, schedule := range svc.Schedules("") {
+			if schedule.Active {
+				ids = append(ids, schedule.ID)
+			}
+		}
+		return ids
+	case "kind":
+		return []string{string(types.ScheduleCron), string(types.ScheduleDaily), string(types.ScheduleMonthly), string(types.ScheduleOnce), string(types.ScheduleWeekly)}
+	case "category":
+		var categories []string
+		if catalog := svc.Categories(); len(catalog) > 0 {
+			for _, category := range catalog {
+				categories = append(categories, string(category.ID))
+			}
+			sort.Strings(categories)
+			return categories
+		}
+		for _, payment := range allPayments(svc) {
+			categories = appendUnique(categories, string(payment.Category))
+		}
+		for _, favorite := range svc.Favorites() {
+			categories = appendUnique(categories, string(favorite.Category))
+		}
+		sort.Strings(categories)
+		return categories
+	}
+	return nil
+}
+
+func allPayments(svc *wallet.Service) []types.Payment {
+	page, err := svc.QueryPayments(wallet.PaymentQuery{})
+	if err != nil {
+		return nil
+	}
+	return page.Payments
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
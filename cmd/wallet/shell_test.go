@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+func TestShell_script(t *testing.T) {
+	dir := t.TempDir()
+	input := strings.Join([]string{
+		"account register +992000000001",
+		"deposit 1 10000",
+		"pay 1 2500 auto",
+		"pay 1",
+		"frobnicate",
+		"exit",
+		"deposit 1 10000",
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-data", dir, "shell"}, strings.NewReader(input), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("shell exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "usage: pay") || !strings.Contains(stderr.String(), `unknown command "frobnicate"`) {
+		t.Errorf("errors were not reported, stderr => %q", stderr.String())
+	}
+
+	svc := &wallet.Service{}
+	if err := svc.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	account, err := svc.FindAccountByID(1)
+	if err != nil {
+		t.Fatalf("shell did not save data on exit: %v", err)
+	}
+	if account.Balance != 7500 {
+		t.Errorf("balance = %v, want 7500", account.Balance)
+	}
+}
+
+func TestShell_autoComplete(t *testing.T) {
+	svc := &wallet.Service{}
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 10000); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 100, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(account.ID, 100, "aviation"); err != nil {
+		t.Fatal(err)
+	}
+	sh := &shell{app: &app{svc: svc}}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"dep", "deposit "},
+		{"favorite l", "favorite list "},
+		{"favorite schedule c", "favorite schedule cancel "},
+		{"favorite schedule add -cron x f W", "favorite schedule add -cron x f WEEKLY "},
+		{"pay ", "pay 1 "},
+		{"pay -key k ", "pay -key k 1 "},
+		{"favorite create -variable ", "favorite create -variable 1 "},
+		{"pay 1 100 a", "pay 1 100 a"},
+		{"pay 1 100 au", "pay 1 100 auto "},
+		{"reject " + payment.ID[:8], "reject " + payment.ID + " "},
+		{"history 1 ", ""},
+	}
+	for _, tt := range tests {
+		line, pos, ok := sh.autoComplete(tt.line, len(tt.line), '\t')
+		if tt.want == "" {
+			if ok {
+				t.Errorf("autoComplete(%q) = %q, want no completion", tt.line, line)
+			}
+			continue
+		}
+		if !ok || line != tt.want || pos != len(tt.want) {
+			t.Errorf("autoComplete(%q) = %q, %d, %v; want %q", tt.line, line, pos, ok, tt.want)
+		}
+	}
+}
@@ -2,4 +2,9 @@ module github.com/shodikhuja83/wallet
 
 go 1.16
 
-require github.com/google/uuid v1.2.0
+require (
+	github.com/google/uuid v1.2.0
+	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
+)
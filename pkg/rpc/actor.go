@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"google.golang.org/grpc/metadata"
+)
+
+// ключи метаданных с исполнителем операции для журнала аудита
+const (
+	MetadataActorID   = "x-actor-id"
+	MetadataActorRole = "x-actor-role"
+)
+
+// WithActor добавляет исполнителя в исходящие метаданные вызова
+func WithActor(ctx context.Context, actor wallet.Actor) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataActorID, actor.ID, MetadataActorRole, actor.Role)
+}
+
+// Authenticator определяет исполнителя вызова для журнала аудита.
+// Ошибка отклоняет вызов; чтобы клиент получил Unauthenticated, она должна оборачивать ErrUnauthenticated
+type Authenticator func(ctx context.Context) (wallet.Actor, error)
+
+// ErrUnauthenticated возвращается Authenticator, если исполнителя вызова не удалось определить
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Anonymous записывает все вызовы от anonymous/api, метаданные не читаются
+func Anonymous(ctx context.Context) (wallet.Actor, error) {
+	return wallet.Actor{ID: "anonymous", Role: "api"}, nil
+}
+
+// ClientAsserted берёт исполнителя из метаданных вызова через ActorOf
+func ClientAsserted(ctx context.Context) (wallet.Actor, error) {
+	return ActorOf(ctx), nil
+}
+
+// session возвращает сессию сервиса от имени исполнителя, определённого auth
+func (s *Server) session(ctx context.Context) (*wallet.Session, error) {
+	actor, err := s.auth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.svc.As(actor), nil
+}
+
+// ActorOf исполнитель операции из входящих метаданных, по умолчанию anonymous/api.
+// Значения заявлены клиентом и ничем не проверяются: использовать только за прокси,
+// который сам аутентифицирует вызов и перезаписывает эти метаданные
+func ActorOf(ctx context.Context) wallet.Actor {
+	actor := wallet.Actor{ID: "anonymous", Role: "api"}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return actor
+	}
+	if values := md.Get(MetadataActorID); len(values) > 0 && values[0] != "" {
+		actor.ID = values[0]
+	}
+	if values := md.Get(MetadataActorRole); len(values) > 0 && values[0] != "" {
+		actor.Role = values[0]
+	}
+	return actor
+}
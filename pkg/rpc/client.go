@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/walletpb"
+	"google.golang.org/grpc"
+)
+
+// Client клиент gRPC сервиса кошелька, возвращающий модели из пакета types
+// и ошибки wallet.ErrXxx там, где сервер вернул известную ошибку
+type Client struct {
+	client walletpb.WalletClient
+}
+
+// NewClient создаёт клиента поверх установленного соединения
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{client: walletpb.NewWalletClient(conn)}
+}
+
+// RegisterAccount регистрирует нового пользователя
+func (c *Client) RegisterAccount(ctx context.Context, phone types.Phone) (*types.Account, error) {
+	account, err := c.client.RegisterAccount(ctx, &walletpb.RegisterAccountRequest{Phone: string(phone)})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return accountFromPB(account), nil
+}
+
+// Deposit пополняет счёт; idempotencyKey может быть пустым
+func (c *Client) Deposit(ctx context.Context, accountID int64, amount types.Money, idempotencyKey string) (*types.Account, error) {
+	account, err := c.client.Deposit(ctx, &walletpb.DepositRequest{
+		AccountId:      accountID,
+		Amount:         int64(amount),
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return accountFromPB(account), nil
+}
+
+// SetAccountTier меняет уровень верификации аккаунта
+func (c *Client) SetAccountTier(ctx context.Context, accountID int64, tier types.AccountTier, reason string) (*types.TierChange, error) {
+	change, err := c.client.SetAccountTier(ctx, &walletpb.SetAccountTierRequest{
+		AccountId: accountID,
+		Tier:      string(tier),
+		Reason:    reason,
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return tierChangeFromPB(change), nil
+}
+
+// Pay платит за категорию; idempotencyKey может быть пустым
+func (c *Client) Pay(ctx context.Context, accountID int64, amount types.Money, category types.PaymentCategory, idempotencyKey string) (*types.Payment, error) {
+	payment, err := c.client.Pay(ctx, &walletpb.PayRequest{
+		AccountId:      accountID,
+		Amount:         int64(amount),
+		Category:       string(category),
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return paymentFromPB(payment), nil
+}
+
+// Reject отменяет платёж
+func (c *Client) Reject(ctx context.Context, paymentID string) (*types.Payment, error) {
+	payment, err := c.client.Reject(ctx, &walletpb.RejectRequest{PaymentId: paymentID})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return paymentFromPB(payment), nil
+}
+
+// Repeat повторяет платёж
+func (c *Client) Repeat(ctx context.Context, paymentID string) (*types.Payment, error) {
+	payment, err := c.client.Repeat(ctx, &walletpb.RepeatRequest{PaymentId: paymentID})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return paymentFromPB(payment), nil
+}
+
+// FavoritePayment добавляет платёж в избранное
+func (c *Client) FavoritePayment(ctx context.Context, paymentID string, name string) (*types.Favorite, error) {
+	favorite, err := c.client.FavoritePayment(ctx, &walletpb.FavoritePaymentRequest{PaymentId: paymentID, Name: name})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return favoriteFromPB(favorite), nil
+}
+
+// PayFromFavorite платит по шаблону из избранного
+func (c *Client) PayFromFavorite(ctx context.Context, favoriteID string) (*types.Payment, error) {
+	payment, err := c.client.PayFromFavorite(ctx, &walletpb.PayFromFavoriteRequest{FavoriteId: favoriteID})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return paymentFromPB(payment), nil
+}
+
+// ExportAccountHistory возвращает все платежи аккаунта
+func (c *Client) ExportAccountHistory(ctx context.Context, accountID int64) ([]types.Payment, error) {
+	resp, err := c.client.ExportAccountHistory(ctx, &walletpb.ExportAccountHistoryRequest{AccountId: accountID})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	var payments []types.Payment
+	for _, payment := range resp.GetPayments() {
+		payments = append(payments, *paymentFromPB(payment))
+	}
+	return payments, nil
+}
+
+// SumPaymentsWithProgress вызывает fn для каждого отчёта из потока, пока поток не закончится;
+// если fn вернёт ошибку, поток закрывается и ошибка возвращается
+func (c *Client) SumPaymentsWithProgress(ctx context.Context, chunkSize int, goroutines int, fn func(types.Progress) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.SumPaymentsWithProgress(ctx, &walletpb.SumPaymentsWithProgressRequest{
+		ChunkSize:  int32(chunkSize),
+		Goroutines: int32(goroutines),
+	})
+	if err != nil {
+		return fromStatus(err)
+	}
+	for {
+		progress, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fromStatus(err)
+		}
+		if err := fn(progressFromPB(progress)); err != nil {
+			return err
+		}
+	}
+}
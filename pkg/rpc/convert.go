@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/walletpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func accountToPB(account *types.Account) *walletpb.Account {
+	return &walletpb.Account{
+		Id:      account.ID,
+		Phone:   string(account.Phone),
+		Balance: int64(account.Balance),
+		Tier:    string(account.Tier),
+	}
+}
+
+func accountFromPB(account *walletpb.Account) *types.Account {
+	return &types.Account{
+		ID:      account.GetId(),
+		Phone:   types.Phone(account.GetPhone()),
+		Balance: types.Money(account.GetBalance()),
+		Tier:    types.AccountTier(account.GetTier()),
+	}
+}
+
+func tierChangeToPB(change *types.TierChange) *walletpb.TierChange {
+	pb := &walletpb.TierChange{
+		AccountId: change.AccountID,
+		From:      string(change.From),
+		To:        string(change.To),
+		Reason:    change.Reason,
+	}
+	if !change.Created.IsZero() {
+		pb.Created = timestamppb.New(change.Created)
+	}
+	return pb
+}
+
+func tierChangeFromPB(change *walletpb.TierChange) *types.TierChange {
+	result := &types.TierChange{
+		AccountID: change.GetAccountId(),
+		From:      types.AccountTier(change.GetFrom()),
+		To:        types.AccountTier(change.GetTo()),
+		Reason:    change.GetReason(),
+	}
+	if change.GetCreated() != nil {
+		result.Created = change.GetCreated().AsTime()
+	}
+	return result
+}
+
+func paymentToPB(payment *types.Payment) *walletpb.Payment {
+	pb := &walletpb.Payment{
+		Id:        payment.ID,
+		AccountId: payment.AccountID,
+		Amount:    int64(payment.Amount),
+		Category:  string(payment.Category),
+		Status:    string(payment.Status),
+	}
+	if !payment.Created.IsZero() {
+		pb.Created = timestamppb.New(payment.Created)
+	}
+	return pb
+}
+
+func paymentFromPB(payment *walletpb.Payment) *types.Payment {
+	result := &types.Payment{
+		ID:        payment.GetId(),
+		AccountID: payment.GetAccountId(),
+		Amount:    types.Money(payment.GetAmount()),
+		Category:  types.PaymentCategory(payment.GetCategory()),
+		Status:    types.PaymentStatus(payment.GetStatus()),
+	}
+	if payment.GetCreated() != nil {
+		result.Created = payment.GetCreated().AsTime()
+	}
+	return result
+}
+
+func favoriteToPB(favorite *types.Favorite) *walletpb.Favorite {
+	return &walletpb.Favorite{
+		Id:        favorite.ID,
+		AccountId: favorite.AccountID,
+		Name:      favorite.Name,
+		Amount:    int64(favorite.Amount),
+		Category:  string(favorite.Category),
+	}
+}
+
+func favoriteFromPB(favorite *walletpb.Favorite) *types.Favorite {
+	return &types.Favorite{
+		ID:        favorite.GetId(),
+		AccountID: favorite.GetAccountId(),
+		Name:      favorite.GetName(),
+		Amount:    types.Money(favorite.GetAmount()),
+		Category:  types.PaymentCategory(favorite.GetCategory()),
+	}
+}
+
+func progressToPB(progress types.Progress) *walletpb.Progress {
+	return &walletpb.Progress{
+		Part:      int32(progress.Part),
+		Result:    int64(progress.Result),
+		Chunk:     int32(progress.Chunk),
+		Processed: int32(progress.Processed),
+		Total:     int64(progress.Total),
+		Percent:   progress.Percent,
+	}
+}
+
+func progressFromPB(progress *walletpb.Progress) types.Progress {
+	return types.Progress{
+		Part:      int(progress.GetPart()),
+		Result:    types.Money(progress.GetResult()),
+		Chunk:     int(progress.GetChunk()),
+		Processed: int(progress.GetProcessed()),
+		Total:     types.Money(progress.GetTotal()),
+		Percent:   progress.GetPercent(),
+	}
+}
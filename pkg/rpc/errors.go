@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes соответствие ошибок сервиса кодам gRPC
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{ErrUnauthenticated, codes.Unauthenticated},
+
+	{wallet.ErrAccountNotFound, codes.NotFound},
+	{wallet.ErrPaymentNotFound, codes.NotFound},
+	{wallet.ErrFavoriteNotFound, codes.NotFound},
+	{wallet.ErrTransferNotFound, codes.NotFound},
+	{wallet.ErrCategoryNotFound, codes.NotFound},
+
+	{wallet.ErrPhoneRegistered, codes.AlreadyExists},
+	{wallet.ErrFavoriteNameTaken, codes.AlreadyExists},
+	{wallet.ErrIdempotencyConflict, codes.Aborted},
+
+	{wallet.ErrAmountMustBePositive, codes.InvalidArgument},
+	{wallet.ErrSameAccount, codes.InvalidArgument},
+	{wallet.ErrUnknownTier, codes.InvalidArgument},
+	{wallet.ErrInvalidFavoriteName, codes.InvalidArgument},
+	{wallet.ErrInvalidCategory, codes.InvalidArgument},
+	{wallet.ErrUnknownCategory, codes.InvalidArgument},
+	{wallet.ErrCategoryCycle, codes.InvalidArgument},
+
+	{wallet.ErrNotEnoughtBalance, codes.FailedPrecondition},
+	{wallet.ErrBalanceLimitExceeded, codes.FailedPrecondition},
+	{wallet.ErrPaymentLimitExceeded, codes.FailedPrecondition},
+	{wallet.ErrTurnoverLimitExceeded, codes.FailedPrecondition},
+	{wallet.ErrPaymentRejected, codes.FailedPrecondition},
+	{wallet.ErrCategoryDisabled, codes.FailedPrecondition},
+
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+
+// toStatus переводит ошибку сервиса в gRPC статус, сообщение статуса - текст ошибки
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.err) {
+			return status.Error(mapping.code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// fromStatus восстанавливает ошибку сервиса из gRPC статуса, чтобы клиент мог сравнивать её с wallet.ErrXxx
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, mapping := range errorCodes {
+		if st.Code() == mapping.code && st.Message() == mapping.err.Error() {
+			return mapping.err
+		}
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"github.com/shodikhuja83/wallet/pkg/walletpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, svc *wallet.Service, auth Authenticator) *Client {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	walletpb.RegisterWalletServer(grpcServer, NewServer(svc, nil, auth))
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("DialContext(): error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestClient_paymentFlow(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, &wallet.Service{}, nil)
+
+	account, err := client.RegisterAccount(ctx, "+992000000001")
+	if err != nil {
+		t.Fatalf("RegisterAccount(): error = %v", err)
+	}
+	account, err = client.Deposit(ctx, account.ID, 100_00, "dep-1")
+	if err != nil || account.Balance != 100_00 {
+		t.Fatalf("Deposit(): got > %v, %v", account, err)
+	}
+
+	payment, err := client.Pay(ctx, account.ID, 10_00, "Cafe", "pay-1")
+	if err != nil {
+		t.Fatalf("Pay(): error = %v", err)
+	}
+	if payment.Created.IsZero() {
+		t.Errorf("payment time was not transferred")
+	}
+	favorite, err := client.FavoritePayment(ctx, payment.ID, "coffee")
+	if err != nil {
+		t.Fatalf("FavoritePayment(): error = %v", err)
+	}
+	if _, err := client.PayFromFavorite(ctx, favorite.ID); err != nil {
+		t.Fatalf("PayFromFavorite(): error = %v", err)
+	}
+	if _, err := client.Repeat(ctx, payment.ID); err != nil {
+		t.Fatalf("Repeat(): error = %v", err)
+	}
+	rejected, err := client.Reject(ctx, payment.ID)
+	if err != nil || rejected.Status != types.PaymentStatusFail {
+		t.Fatalf("Reject(): got > %v, %v", rejected, err)
+	}
+
+	history, err := client.ExportAccountHistory(ctx, account.ID)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("ExportAccountHistory(): got %v payments, %v", len(history), err)
+	}
+
+	var last types.Progress
+	reports := 0
+	err = client.SumPaymentsWithProgress(ctx, 1, 2, func(progress types.Progress) error {
+		reports++
+		last = progress
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SumPaymentsWithProgress(): error = %v", err)
+	}
+	if reports != 3 || last.Total != 30_00 || last.Percent != 100 {
+		t.Errorf("got %v reports, last > %+v", reports, last)
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	ctx := context.Background()
+	svc := &wallet.Service{}
+	client := newTestClient(t, svc, nil)
+	account, _ := client.RegisterAccount(ctx, "+992000000001")
+
+	if _, err := client.RegisterAccount(ctx, "+992000000001"); err != wallet.ErrPhoneRegistered {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrPhoneRegistered)
+	}
+	if _, err := client.Pay(ctx, account.ID, 10, "Cafe", ""); err != wallet.ErrNotEnoughtBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrNotEnoughtBalance)
+	}
+	if _, err := client.Reject(ctx, "unknown"); err != wallet.ErrPaymentNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrPaymentNotFound)
+	}
+
+	client.Deposit(ctx, account.ID, 100, "")
+	payment, _ := client.Pay(ctx, account.ID, 10, "Cafe", "")
+	client.FavoritePayment(ctx, payment.ID, "cafe")
+	if _, err := client.FavoritePayment(ctx, payment.ID, "cafe"); err != wallet.ErrFavoriteNameTaken {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrFavoriteNameTaken)
+	}
+	if _, err := client.FavoritePayment(ctx, payment.ID, "a;b"); err != wallet.ErrInvalidFavoriteName {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrInvalidFavoriteName)
+	}
+
+	svc.RegisterCategory("cafe", "Cafe", "")
+	if _, err := client.Pay(ctx, account.ID, 10, "casino", ""); err != wallet.ErrUnknownCategory {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrUnknownCategory)
+	}
+	svc.DisableCategory("cafe")
+	if _, err := client.Pay(ctx, account.ID, 10, "cafe", ""); err != wallet.ErrCategoryDisabled {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrCategoryDisabled)
+	}
+	// цикл, который мог попасть в каталог в обход Import
+	svc.RegisterCategory("food", "Food", "")
+	food, _ := svc.FindCategoryByID("food")
+	food.Parent = "food"
+	if _, err := client.Pay(ctx, account.ID, 10, "food", ""); err != wallet.ErrCategoryCycle {
+		t.Errorf("\ngot > %v \nwant > %v", err, wallet.ErrCategoryCycle)
+	}
+
+	stop := errors.New("stop")
+	err := client.SumPaymentsWithProgress(ctx, 1, 1, func(types.Progress) error { return stop })
+	if err != stop {
+		t.Errorf("\ngot > %v \nwant > %v", err, stop)
+	}
+}
+
+func TestClient_actor(t *testing.T) {
+	svc := &wallet.Service{}
+	client := newTestClient(t, svc, ClientAsserted)
+	operator := wallet.Actor{ID: "aziz", Role: "operator"}
+
+	account, err := client.RegisterAccount(WithActor(context.Background(), operator), "+992000000001")
+	if err != nil {
+		t.Fatalf("RegisterAccount(): error = %v", err)
+	}
+	if _, err := client.Deposit(context.Background(), account.ID, 100_00, ""); err != nil {
+		t.Fatalf("Deposit(): error = %v", err)
+	}
+
+	records := svc.AuditLog(wallet.AuditQuery{})
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	if records[0].Actor != operator {
+		t.Errorf("register actor = %+v, want %+v", records[0].Actor, operator)
+	}
+	if want := (wallet.Actor{ID: "anonymous", Role: "api"}); records[1].Actor != want {
+		t.Errorf("deposit actor = %+v, want %+v", records[1].Actor, want)
+	}
+}
+
+func TestClient_authenticator(t *testing.T) {
+	svc := &wallet.Service{}
+	operator := wallet.Actor{ID: "aziz", Role: "operator"}
+	if _, err := newTestClient(t, svc, nil).RegisterAccount(WithActor(context.Background(), operator), "+992000000001"); err != nil {
+		t.Fatalf("RegisterAccount(): error = %v", err)
+	}
+
+	client := newTestClient(t, svc, func(ctx context.Context) (wallet.Actor, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); len(values) == 0 || values[0] != "Bearer secret" {
+			return wallet.Actor{}, ErrUnauthenticated
+		}
+		return wallet.Actor{ID: "cashier", Role: "operator"}, nil
+	})
+	_, err := client.Deposit(context.Background(), 1, 100_00, "")
+	if !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("Deposit() without token: error = %v, want %v", err, ErrUnauthenticated)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.Deposit(ctx, 1, 100_00, ""); err != nil {
+		t.Fatalf("Deposit() with token: error = %v", err)
+	}
+
+	records := svc.AuditLog(wallet.AuditQuery{})
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	if want := (wallet.Actor{ID: "anonymous", Role: "api"}); records[0].Actor != want {
+		t.Errorf("default authenticator actor = %+v, want %+v", records[0].Actor, want)
+	}
+	if want := (wallet.Actor{ID: "cashier", Role: "operator"}); records[1].Actor != want {
+		t.Errorf("custom authenticator actor = %+v, want %+v", records[1].Actor, want)
+	}
+}
+
+func TestClient_SetAccountTier(t *testing.T) {
+	svc := &wallet.Service{}
+	client := newTestClient(t, svc, nil)
+	ctx := context.Background()
+	account, err := client.RegisterAccount(ctx, "+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := client.SetAccountTier(ctx, account.ID, types.TierBasic, "passport")
+	if err != nil {
+		t.Fatalf("SetAccountTier(): error = %v", err)
+	}
+	if change.From != types.TierAnonymous || change.To != types.TierBasic || change.Reason != "passport" || change.Created.IsZero() {
+		t.Errorf("SetAccountTier() = %+v", change)
+	}
+	if got, _ := svc.FindAccountByID(account.ID); got.Tier != types.TierBasic {
+		t.Errorf("account tier = %q, want %q", got.Tier, types.TierBasic)
+	}
+
+	if _, err := client.SetAccountTier(ctx, account.ID, "GOLD", ""); !errors.Is(err, wallet.ErrUnknownTier) {
+		t.Errorf("SetAccountTier(GOLD): error = %v, want %v", err, wallet.ErrUnknownTier)
+	}
+}
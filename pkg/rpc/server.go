@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+	"github.com/shodikhuja83/wallet/pkg/walletpb"
+)
+
+// Server реализует walletpb.WalletServer поверх wallet.Service.
+// wallet.Service не потокобезопасен, поэтому все вызовы сервиса выполняются под блокировкой mu
+type Server struct {
+	walletpb.UnimplementedWalletServer
+
+	mu   sync.Locker
+	svc  *wallet.Service
+	auth Authenticator
+}
+
+// NewServer создаёт gRPC сервер для сервиса svc; mu нужно передать, если тот же сервис
+// используется ещё где-то (например, HTTP сервером), nil - своя блокировка.
+// auth определяет исполнителя вызовов для журнала аудита, nil - Anonymous
+func NewServer(svc *wallet.Service, mu sync.Locker, auth Authenticator) *Server {
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	if auth == nil {
+		auth = Anonymous
+	}
+	return &Server{svc: svc, mu: mu, auth: auth}
+}
+
+// RegisterAccount регистрирует нового пользователя
+func (s *Server) RegisterAccount(ctx context.Context, req *walletpb.RegisterAccountRequest) (*walletpb.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	account, err := se.RegisterAccount(types.Phone(req.GetPhone()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return accountToPB(account), nil
+}
+
+// Deposit пополняет счёт и возвращает аккаунт с новым балансом
+func (s *Server) Deposit(ctx context.Context, req *walletpb.DepositRequest) (*walletpb.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	err = se.DepositWithKey(req.GetIdempotencyKey(), req.GetAccountId(), types.Money(req.GetAmount()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	account, err := s.svc.FindAccountByID(req.GetAccountId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return accountToPB(account), nil
+}
+
+// SetAccountTier меняет уровень верификации аккаунта и возвращает запись об изменении
+func (s *Server) SetAccountTier(ctx context.Context, req *walletpb.SetAccountTierRequest) (*walletpb.TierChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	change, err := se.SetAccountTier(req.GetAccountId(), types.AccountTier(req.GetTier()), req.GetReason())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return tierChangeToPB(change), nil
+}
+
+// Pay платит за категорию
+func (s *Server) Pay(ctx context.Context, req *walletpb.PayRequest) (*walletpb.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	payment, err := se.PayWithKey(req.GetIdempotencyKey(), req.GetAccountId(), types.Money(req.GetAmount()), types.PaymentCategory(req.GetCategory()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return paymentToPB(payment), nil
+}
+
+// Reject отменяет платёж и возвращает его с новым статусом
+func (s *Server) Reject(ctx context.Context, req *walletpb.RejectRequest) (*walletpb.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err := se.Reject(req.GetPaymentId()); err != nil {
+		return nil, toStatus(err)
+	}
+	payment, err := s.svc.FindPaymentByID(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return paymentToPB(payment), nil
+}
+
+// Repeat повторяет платёж
+func (s *Server) Repeat(ctx context.Context, req *walletpb.RepeatRequest) (*walletpb.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	payment, err := se.Repeat(req.GetPaymentId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return paymentToPB(payment), nil
+}
+
+// FavoritePayment добавляет платёж в избранное
+func (s *Server) FavoritePayment(ctx context.Context, req *walletpb.FavoritePaymentRequest) (*walletpb.Favorite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	favorite, err := se.FavoritePayment(req.GetPaymentId(), req.GetName())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return favoriteToPB(favorite), nil
+}
+
+// PayFromFavorite платит по шаблону из избранного
+func (s *Server) PayFromFavorite(ctx context.Context, req *walletpb.PayFromFavoriteRequest) (*walletpb.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.session(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	payment, err := se.PayFromFavorite(req.GetFavoriteId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return paymentToPB(payment), nil
+}
+
+// ExportAccountHistory возвращает все платежи аккаунта
+func (s *Server) ExportAccountHistory(ctx context.Context, req *walletpb.ExportAccountHistoryRequest) (*walletpb.ExportAccountHistoryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payments, err := s.svc.ExportAccountHistory(req.GetAccountId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &walletpb.ExportAccountHistoryResponse{}
+	for i := range payments {
+		resp.Payments = append(resp.Payments, paymentToPB(&payments[i]))
+	}
+	return resp, nil
+}
+
+// SumPaymentsWithProgress отправляет отчёты о суммировании по мере готовности кусков
+func (s *Server) SumPaymentsWithProgress(req *walletpb.SumPaymentsWithProgressRequest, stream walletpb.Wallet_SumPaymentsWithProgressServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	s.mu.Lock()
+	ch := s.svc.SumPaymentsProgressive(ctx, int(req.GetChunkSize()), int(req.GetGoroutines()))
+	s.mu.Unlock()
+
+	for progress := range ch {
+		if err := stream.Send(progressToPB(progress)); err != nil {
+			return err
+		}
+	}
+	return toStatus(ctx.Err())
+}
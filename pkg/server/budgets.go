@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+type budgetRequest struct {
+	Category   types.PaymentCategory `json:"category"`
+	Period     types.Period          `json:"period"`
+	Limit      types.Money           `json:"limit"`
+	Thresholds []int                 `json:"thresholds"`
+}
+
+// POST /accounts/{id}/budgets создаёт или меняет бюджет и возвращает его расход
+func (s *Server) setBudget(w http.ResponseWriter, r *http.Request, accountID int64) {
+	var req budgetRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	budget, err := s.session(r).SetBudget(accountID, req.Category, req.Period, req.Limit, req.Thresholds)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	usage, err := s.svc.BudgetUsage(budget.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// GET /budgets/{id}, DELETE /budgets/{id}
+func (s *Server) handleBudget(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/budgets/")
+	if len(parts) != 1 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	budgetID := parts[0]
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		usage, err := s.svc.BudgetUsage(budgetID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, usage)
+
+	case http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).DeleteBudget(budgetID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+type categoryRequest struct {
+	ID     types.PaymentCategory `json:"id"`
+	Name   string                `json:"name"`
+	Parent types.PaymentCategory `json:"parent"`
+}
+
+// GET /categories, POST /categories
+func (s *Server) handleCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.svc.Categories())
+
+	case http.MethodPost:
+		var req categoryRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		category, err := s.session(r).RegisterCategory(req.ID, req.Name, req.Parent)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, category)
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
+
+// GET /categories/{id}, GET /categories/{id}/children,
+// POST /categories/{id}/enable, POST /categories/{id}/disable
+func (s *Server) handleCategory(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/categories/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	id := types.PaymentCategory(parts[0])
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		category, err := s.svc.FindCategoryByID(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, category)
+
+	case action == "children" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		categories, err := s.svc.Subcategories(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, categories)
+
+	case (action == "enable" || action == "disable") && r.Method == http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		session := s.session(r)
+		setEnabled := session.EnableCategory
+		if action == "disable" {
+			setEnabled = session.DisableCategory
+		}
+		if err := setEnabled(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		category, err := s.svc.FindCategoryByID(id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, category)
+
+	case action == "" || action == "children" || action == "enable" || action == "disable":
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// ErrorBody тело ответа с ошибкой
+type ErrorBody struct {
+	Error ErrorInfo `json:"error"`
+}
+
+// ErrorInfo код и описание ошибки
+type ErrorInfo struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings соответствие ошибок сервиса HTTP статусам и кодам
+var errorMappings = []errorMapping{
+	{ErrBadRequest, http.StatusBadRequest, "bad_request"},
+	{ErrNotFound, http.StatusNotFound, "not_found"},
+	{ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed"},
+	{ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+
+	{wallet.ErrAccountNotFound, http.StatusNotFound, "account_not_found"},
+	{wallet.ErrPaymentNotFound, http.StatusNotFound, "payment_not_found"},
+	{wallet.ErrFavoriteNotFound, http.StatusNotFound, "favorite_not_found"},
+	{wallet.ErrTransferNotFound, http.StatusNotFound, "transfer_not_found"},
+	{wallet.ErrCategoryNotFound, http.StatusNotFound, "category_not_found"},
+	{wallet.ErrMerchantNotFound, http.StatusNotFound, "merchant_not_found"},
+	{wallet.ErrSettlementNotFound, http.StatusNotFound, "settlement_not_found"},
+	{wallet.ErrWithdrawalNotFound, http.StatusNotFound, "withdrawal_not_found"},
+	{wallet.ErrBudgetNotFound, http.StatusNotFound, "budget_not_found"},
+	{wallet.ErrScheduleNotFound, http.StatusNotFound, "schedule_not_found"},
+
+	{wallet.ErrPhoneRegistered, http.StatusConflict, "phone_registered"},
+	{wallet.ErrIdempotencyConflict, http.StatusConflict, "idempotency_conflict"},
+	{wallet.ErrFavoriteNameTaken, http.StatusConflict, "favorite_name_taken"},
+	{wallet.ErrCategoryExists, http.StatusConflict, "category_exists"},
+	{wallet.ErrPaymentNotInProgress, http.StatusConflict, "payment_not_in_progress"},
+	{wallet.ErrPaymentRejected, http.StatusConflict, "payment_already_rejected"},
+
+	{wallet.ErrAmountMustBePositive, http.StatusBadRequest, "amount_must_be_positive"},
+	{wallet.ErrSameAccount, http.StatusBadRequest, "same_account"},
+	{wallet.ErrUnknownTier, http.StatusBadRequest, "unknown_tier"},
+	{wallet.ErrInvalidFavoriteName, http.StatusBadRequest, "invalid_favorite_name"},
+	{wallet.ErrInvalidFavoritePosition, http.StatusBadRequest, "invalid_favorite_position"},
+	{wallet.ErrFavoriteAmountFixed, http.StatusBadRequest, "favorite_amount_fixed"},
+	{wallet.ErrInvalidCategory, http.StatusBadRequest, "invalid_category"},
+	{wallet.ErrInvalidMerchant, http.StatusBadRequest, "invalid_merchant"},
+	{wallet.ErrMerchantCategory, http.StatusBadRequest, "merchant_category"},
+	{wallet.ErrInvalidFeeRule, http.StatusBadRequest, "invalid_fee_rule"},
+	{wallet.ErrInvalidRewardRule, http.StatusBadRequest, "invalid_reward_rule"},
+	{wallet.ErrInvalidBudget, http.StatusBadRequest, "invalid_budget"},
+	{wallet.ErrInvalidSchedule, http.StatusBadRequest, "invalid_schedule"},
+	{wallet.ErrInvalidCron, http.StatusBadRequest, "invalid_cron"},
+
+	{wallet.ErrNotEnoughtBalance, http.StatusUnprocessableEntity, "not_enough_balance"},
+	{wallet.ErrBalanceLimitExceeded, http.StatusUnprocessableEntity, "balance_limit_exceeded"},
+	{wallet.ErrPaymentLimitExceeded, http.StatusUnprocessableEntity, "payment_limit_exceeded"},
+	{wallet.ErrTurnoverLimitExceeded, http.StatusUnprocessableEntity, "turnover_limit_exceeded"},
+	{wallet.ErrCategoryDisabled, http.StatusUnprocessableEntity, "category_disabled"},
+	{wallet.ErrUnknownCategory, http.StatusUnprocessableEntity, "unknown_category"},
+	{wallet.ErrCategoryCycle, http.StatusUnprocessableEntity, "category_cycle"},
+	{wallet.ErrNothingToSettle, http.StatusUnprocessableEntity, "nothing_to_settle"},
+
+	{context.Canceled, http.StatusServiceUnavailable, "canceled"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "deadline_exceeded"},
+}
+
+// StatusOf возвращает HTTP статус и код для ошибки; неизвестные ошибки считаются внутренними
+func StatusOf(err error) (int, string) {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.status, mapping.code
+		}
+	}
+	return http.StatusInternalServerError, "internal"
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, code := StatusOf(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, ErrorBody{Error: ErrorInfo{Code: code, Message: message}})
+}
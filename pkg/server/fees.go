@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+type feeQuoteResponse struct {
+	Total types.Money     `json:"total"`
+	Fees  []types.FeeLine `json:"fees"`
+}
+
+// GET /fees, PUT /fees
+func (s *Server) handleFees(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.svc.FeeSchedule())
+
+	case http.MethodPut:
+		var rules []types.FeeRule
+		if err := decode(r, &rules); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).SetFeeSchedule(rules); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.svc.FeeSchedule())
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
+
+// GET /fees/quote?operation=PAYMENT&amount=1000&category=food
+func (s *Server) handleFeeQuote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	amount, err := strconv.ParseInt(query.Get("amount"), 10, 64)
+	if err != nil {
+		writeError(w, ErrBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total, fees := s.svc.QuoteFees(types.FeeOperation(query.Get("operation")), types.Money(amount), types.PaymentCategory(query.Get("category")))
+	if fees == nil {
+		fees = []types.FeeLine{}
+	}
+	writeJSON(w, http.StatusOK, feeQuoteResponse{Total: total, Fees: fees})
+}
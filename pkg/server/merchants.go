@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+type merchantRequest struct {
+	Name                string                  `json:"name"`
+	Categories          []types.PaymentCategory `json:"categories"`
+	SettlementAccountID int64                   `json:"settlementAccountId"`
+}
+
+// GET /merchants, POST /merchants
+func (s *Server) handleMerchants(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.svc.Merchants())
+
+	case http.MethodPost:
+		var req merchantRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		merchant, err := s.session(r).RegisterMerchant(req.Name, req.Categories, req.SettlementAccountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, merchant)
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
+
+// GET /merchants/{id}, GET /merchants/{id}/entries, GET /merchants/{id}/settlements,
+// POST /merchants/{id}/settle
+func (s *Server) handleMerchant(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/merchants/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	merchantID := parts[0]
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		merchant, err := s.svc.FindMerchantByID(merchantID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, merchant)
+
+	case action == "entries" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		entries, err := s.svc.MerchantEntries(merchantID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+
+	case action == "settlements" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, err := s.svc.FindMerchantByID(merchantID); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.svc.Settlements(merchantID))
+
+	case action == "settle" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		report, err := s.session(r).Settle(merchantID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, report)
+
+	case action == "" || action == "entries" || action == "settlements" || action == "settle":
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
+
+// GET /settlements, POST /settlements - выплата всем мерчантам с положительным балансом
+func (s *Server) handleSettlements(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.svc.Settlements(""))
+
+	case http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		reports, err := s.session(r).RunSettlement()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, reports)
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
+
+// GET /settlements/{id} - отчёт по выплате
+func (s *Server) handleSettlement(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/settlements/")
+	if len(parts) != 1 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, err := s.svc.SettlementReport(parts[0])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// GET /rewards, PUT /rewards
+func (s *Server) handleRewards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.svc.RewardRules())
+
+	case http.MethodPut:
+		var rules []types.RewardRule
+		if err := decode(r, &rules); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).SetRewardRules(rules); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.svc.RewardRules())
+
+	default:
+		writeError(w, ErrMethodNotAllowed)
+	}
+}
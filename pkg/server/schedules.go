@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+type scheduleRequest struct {
+	Kind  types.ScheduleKind `json:"kind"`
+	Start time.Time          `json:"start"`
+	Cron  string             `json:"cron"`
+}
+
+// POST /favorites/{id}/schedules, GET /favorites/{id}/schedules,
+// DELETE /favorites/{id}/schedules/{scheduleId}
+func (s *Server) handleFavoriteSchedules(w http.ResponseWriter, r *http.Request, favoriteID string, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req scheduleRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var schedule *types.Schedule
+		var err error
+		if req.Kind == types.ScheduleCron {
+			schedule, err = s.session(r).ScheduleFavoriteCron(favoriteID, req.Cron)
+		} else {
+			schedule, err = s.session(r).ScheduleFavorite(favoriteID, req.Kind, req.Start)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, schedule)
+
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, err := s.svc.FindFavoriteByID(favoriteID); err != nil {
+			writeError(w, err)
+			return
+		}
+		schedules := s.svc.Schedules(favoriteID)
+		if schedules == nil {
+			schedules = []types.Schedule{}
+		}
+		writeJSON(w, http.StatusOK, schedules)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// расписание другого избранного по этому пути не найдено
+		schedule, err := s.svc.FindScheduleByID(parts[0])
+		if err == nil && schedule.FavoriteID != favoriteID {
+			err = wallet.ErrScheduleNotFound
+		}
+		if err == nil {
+			err = s.session(r).CancelSchedule(schedule.ID)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) <= 1:
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
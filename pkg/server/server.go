@@ -0,0 +1,617 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// ErrBadRequest возвращается, если тело или параметры запроса не удалось разобрать
+var ErrBadRequest = errors.New("bad request")
+
+// ErrNotFound возвращается для неизвестных путей
+var ErrNotFound = errors.New("not found")
+
+// ErrMethodNotAllowed возвращается, если путь не поддерживает метод запроса
+var ErrMethodNotAllowed = errors.New("method not allowed")
+
+// ErrUnauthenticated возвращается Authenticator, если исполнителя запроса не удалось определить
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Server HTTP JSON API поверх wallet.Service.
+// wallet.Service не потокобезопасен, поэтому все вызовы сервиса выполняются под блокировкой mu
+type Server struct {
+	mu   sync.Locker
+	svc  *wallet.Service
+	mux  *http.ServeMux
+	auth Authenticator
+}
+
+// NewServer создаёт сервер для сервиса svc; mu нужно передать, если тот же сервис
+// используется ещё где-то (например, gRPC сервером), nil - своя блокировка.
+// auth определяет исполнителя запросов для журнала аудита, nil - Anonymous
+func NewServer(svc *wallet.Service, mu sync.Locker, auth Authenticator) *Server {
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	if auth == nil {
+		auth = Anonymous
+	}
+	s := &Server{svc: svc, mu: mu, mux: http.NewServeMux(), auth: auth}
+	s.mux.HandleFunc("/accounts", s.handleAccounts)
+	s.mux.HandleFunc("/accounts/", s.handleAccount)
+	s.mux.HandleFunc("/payments", s.handlePayments)
+	s.mux.HandleFunc("/payments/", s.handlePayment)
+	s.mux.HandleFunc("/favorites", s.handleFavorites)
+	s.mux.HandleFunc("/favorites/", s.handleFavorite)
+	s.mux.HandleFunc("/categories", s.handleCategories)
+	s.mux.HandleFunc("/categories/", s.handleCategory)
+	s.mux.HandleFunc("/merchants", s.handleMerchants)
+	s.mux.HandleFunc("/merchants/", s.handleMerchant)
+	s.mux.HandleFunc("/settlements", s.handleSettlements)
+	s.mux.HandleFunc("/settlements/", s.handleSettlement)
+	s.mux.HandleFunc("/fees", s.handleFees)
+	s.mux.HandleFunc("/fees/quote", s.handleFeeQuote)
+	s.mux.HandleFunc("/rewards", s.handleRewards)
+	s.mux.HandleFunc("/budgets/", s.handleBudget)
+	return s
+}
+
+// ServeHTTP реализует http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	actor, err := s.auth(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+}
+
+type registerRequest struct {
+	Phone types.Phone `json:"phone"`
+}
+
+type amountRequest struct {
+	Amount types.Money `json:"amount"`
+}
+
+type payRequest struct {
+	AccountID  int64                 `json:"accountId"`
+	Amount     types.Money           `json:"amount"`
+	Category   types.PaymentCategory `json:"category"`
+	MerchantID string                `json:"merchantId"`
+}
+
+// favoriteRequest либо paymentId, либо поля шаблона
+type favoriteRequest struct {
+	PaymentID      string                `json:"paymentId"`
+	Name           string                `json:"name"`
+	AccountID      int64                 `json:"accountId"`
+	Amount         types.Money           `json:"amount"`
+	Category       types.PaymentCategory `json:"category"`
+	VariableAmount bool                  `json:"variableAmount"`
+}
+
+type favoriteUpdateRequest struct {
+	Name           *string                `json:"name"`
+	Amount         *types.Money           `json:"amount"`
+	Category       *types.PaymentCategory `json:"category"`
+	VariableAmount *bool                  `json:"variableAmount"`
+}
+
+type favoritePayRequest struct {
+	Amount *types.Money `json:"amount"`
+}
+
+type tierRequest struct {
+	Tier   types.AccountTier `json:"tier"`
+	Reason string            `json:"reason"`
+}
+
+type moveRequest struct {
+	Position int `json:"position"`
+}
+
+type sumResponse struct {
+	Sum types.Money `json:"sum"`
+}
+
+// POST /accounts
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+	var req registerRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, err := s.session(r).RegisterAccount(req.Phone)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// GET /accounts/{id}, POST /accounts/{id}/deposit, POST /accounts/{id}/withdraw,
+// GET /accounts/{id}/history, GET /accounts/{id}/favorites, GET /accounts/{id}/rewards,
+// GET /accounts/{id}/budgets, POST /accounts/{id}/budgets
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/accounts/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	accountID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		writeError(w, ErrBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		account, err := s.svc.FindAccountByID(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, account)
+
+	case action == "deposit" && r.Method == http.MethodPost:
+		var req amountRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err := s.session(r).DepositWithKey(r.Header.Get("Idempotency-Key"), accountID, req.Amount)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		account, err := s.svc.FindAccountByID(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, account)
+
+	case action == "withdraw" && r.Method == http.MethodPost:
+		var req amountRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		withdrawal, err := s.session(r).Withdraw(accountID, req.Amount)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, withdrawal)
+
+	case action == "history" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		payments, err := s.svc.ExportAccountHistory(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if payments == nil {
+			payments = []types.Payment{}
+		}
+		writeJSON(w, http.StatusOK, payments)
+
+	case action == "favorites" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		favorites, err := s.svc.ListFavorites(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, favorites)
+
+	case action == "rewards" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		rewards, err := s.svc.Rewards(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rewards)
+
+	case action == "budgets" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		budgets, err := s.svc.Budgets(accountID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, budgets)
+
+	case action == "budgets" && r.Method == http.MethodPost:
+		s.setBudget(w, r, accountID)
+
+	case action == "tier" && r.Method == http.MethodPut:
+		var req tierRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		change, err := s.session(r).SetAccountTier(accountID, req.Tier, req.Reason)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, change)
+
+	case action == "" || action == "deposit" || action == "withdraw" || action == "history" || action == "favorites" || action == "rewards" || action == "budgets" || action == "tier":
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
+
+// POST /payments
+func (s *Server) handlePayments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+	var req payRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := r.Header.Get("Idempotency-Key")
+	var payment *types.Payment
+	var err error
+	if req.MerchantID != "" {
+		payment, err = s.session(r).PayMerchantWithKey(key, req.AccountID, req.MerchantID, req.Amount, req.Category)
+	} else {
+		payment, err = s.session(r).PayWithKey(key, req.AccountID, req.Amount, req.Category)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, payment)
+}
+
+// GET /payments/{id}, POST /payments/{id}/reject, POST /payments/{id}/confirm,
+// POST /payments/{id}/repeat, GET /payments/sum
+func (s *Server) handlePayment(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/payments/")
+	if len(parts) == 0 || len(parts) > 2 {
+		writeError(w, ErrNotFound)
+		return
+	}
+
+	if len(parts) == 1 && parts[0] == "sum" {
+		if r.Method != http.MethodGet {
+			writeError(w, ErrMethodNotAllowed)
+			return
+		}
+		goroutines := 0
+		if value := r.URL.Query().Get("goroutines"); value != "" {
+			var err error
+			goroutines, err = strconv.Atoi(value)
+			if err != nil {
+				writeError(w, ErrBadRequest)
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sum, err := s.svc.SumPaymentsContext(r.Context(), goroutines)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sumResponse{Sum: sum})
+		return
+	}
+
+	paymentID := parts[0]
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		payment, err := s.svc.FindPaymentByID(paymentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, payment)
+
+	case action == "reject" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).Reject(paymentID); err != nil {
+			writeError(w, err)
+			return
+		}
+		payment, err := s.svc.FindPaymentByID(paymentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, payment)
+
+	case action == "confirm" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).Confirm(paymentID); err != nil {
+			writeError(w, err)
+			return
+		}
+		payment, err := s.svc.FindPaymentByID(paymentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, payment)
+
+	case action == "repeat" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		payment, err := s.session(r).Repeat(paymentID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, payment)
+
+	case action == "" || action == "reject" || action == "confirm" || action == "repeat":
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
+
+// POST /favorites
+func (s *Server) handleFavorites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, ErrMethodNotAllowed)
+		return
+	}
+	var req favoriteRequest
+	if err := decode(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var favorite *types.Favorite
+	var err error
+	if req.PaymentID != "" {
+		favorite, err = s.session(r).FavoritePayment(req.PaymentID, req.Name)
+	} else {
+		favorite, err = s.session(r).CreateFavorite(req.AccountID, req.Name, req.Amount, req.Category, req.VariableAmount)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, favorite)
+}
+
+// GET /favorites/{id}, PATCH /favorites/{id}, DELETE /favorites/{id},
+// POST /favorites/{id}/pay, POST /favorites/{id}/move, /favorites/{id}/schedules
+func (s *Server) handleFavorite(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r.URL.Path, "/favorites/")
+	if len(parts) >= 2 && parts[1] == "schedules" {
+		s.handleFavoriteSchedules(w, r, parts[0], parts[2:])
+		return
+	}
+	if len(parts) == 0 || len(parts) > 2 {
+		writeError(w, ErrNotFound)
+		return
+	}
+	favoriteID := parts[0]
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		favorite, err := s.svc.FindFavoriteByID(favoriteID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, favorite)
+
+	case action == "" && r.Method == http.MethodPatch:
+		var req favoriteUpdateRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		favorite, err := s.session(r).UpdateFavorite(favoriteID, wallet.FavoriteUpdate{
+			Name:           req.Name,
+			Amount:         req.Amount,
+			Category:       req.Category,
+			VariableAmount: req.VariableAmount,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, favorite)
+
+	case action == "" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).DeleteFavorite(favoriteID); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "move" && r.Method == http.MethodPost:
+		var req moveRequest
+		if err := decode(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.session(r).MoveFavorite(favoriteID, req.Position); err != nil {
+			writeError(w, err)
+			return
+		}
+		favorite, err := s.svc.FindFavoriteByID(favoriteID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, favorite)
+
+	case action == "pay" && r.Method == http.MethodPost:
+		// тело необязательно, amount - сумма для шаблона с переменной суммой
+		var req favoritePayRequest
+		if r.ContentLength != 0 {
+			if err := decode(r, &req); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var payment *types.Payment
+		var err error
+		if req.Amount != nil {
+			payment, err = s.session(r).PayFromFavoriteWithAmount(favoriteID, *req.Amount)
+		} else {
+			payment, err = s.session(r).PayFromFavorite(favoriteID)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, payment)
+
+	case action == "" || action == "pay" || action == "move":
+		writeError(w, ErrMethodNotAllowed)
+
+	default:
+		writeError(w, ErrNotFound)
+	}
+}
+
+// заголовки с исполнителем операции для журнала аудита
+const (
+	HeaderActorID   = "X-Actor-Id"
+	HeaderActorRole = "X-Actor-Role"
+)
+
+// Authenticator определяет исполнителя запроса для журнала аудита.
+// Ошибка отклоняет запрос; чтобы клиент получил 401, она должна оборачивать ErrUnauthenticated
+type Authenticator func(r *http.Request) (wallet.Actor, error)
+
+// Anonymous записывает все запросы от anonymous/api, заголовки не читаются
+func Anonymous(r *http.Request) (wallet.Actor, error) {
+	return wallet.Actor{ID: "anonymous", Role: "api"}, nil
+}
+
+// ClientAsserted берёт исполнителя из заголовков запроса через ActorOf
+func ClientAsserted(r *http.Request) (wallet.Actor, error) {
+	return ActorOf(r), nil
+}
+
+type actorKey struct{}
+
+// session возвращает сессию сервиса от имени исполнителя, определённого auth
+func (s *Server) session(r *http.Request) *wallet.Session {
+	actor, ok := r.Context().Value(actorKey{}).(wallet.Actor)
+	if !ok {
+		actor, _ = Anonymous(r)
+	}
+	return s.svc.As(actor)
+}
+
+// ActorOf исполнитель операции из заголовков запроса, по умолчанию anonymous/api.
+// Значения заявлены клиентом и ничем не проверяются: использовать только за прокси,
+// который сам аутентифицирует запрос и перезаписывает эти заголовки
+func ActorOf(r *http.Request) wallet.Actor {
+	actor := wallet.Actor{ID: r.Header.Get(HeaderActorID), Role: r.Header.Get(HeaderActorRole)}
+	if actor.ID == "" {
+		actor.ID = "anonymous"
+	}
+	if actor.Role == "" {
+		actor.Role = "api"
+	}
+	return actor
+}
+
+// pathParts возвращает непустые части пути после prefix
+func pathParts(path string, prefix string) []string {
+	var parts []string
+	for _, part := range strings.Split(strings.TrimPrefix(path, prefix), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func decode(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return ErrBadRequest
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
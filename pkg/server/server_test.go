@@ -0,0 +1,664 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+func do(t *testing.T, handler http.Handler, method string, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("can't decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestServer_paymentFlow(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+
+	rec := do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: got > %v %v", rec.Code, rec.Body)
+	}
+	var account types.Account
+	decodeBody(t, rec, &account)
+
+	rec = do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deposit: got > %v %v", rec.Code, rec.Body)
+	}
+
+	pay := map[string]interface{}{"accountId": account.ID, "amount": 10_00, "category": "Cafe"}
+	headers := map[string]string{"Idempotency-Key": "k1"}
+	rec = do(t, srv, http.MethodPost, "/payments", pay, headers)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("pay: got > %v %v", rec.Code, rec.Body)
+	}
+	var payment types.Payment
+	decodeBody(t, rec, &payment)
+
+	rec = do(t, srv, http.MethodPost, "/payments", pay, headers)
+	var retried types.Payment
+	decodeBody(t, rec, &retried)
+	if retried.ID != payment.ID {
+		t.Errorf("retry created new payment")
+	}
+
+	rec = do(t, srv, http.MethodPost, "/favorites", map[string]string{"paymentId": payment.ID, "name": "coffee"}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("favorite: got > %v %v", rec.Code, rec.Body)
+	}
+	var favorite types.Favorite
+	decodeBody(t, rec, &favorite)
+
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/pay", nil, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("pay favorite: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/payments/"+payment.ID+"/repeat", nil, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("repeat: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/payments/"+payment.ID+"/reject", nil, nil)
+	decodeBody(t, rec, &payment)
+	if payment.Status != types.PaymentStatusFail {
+		t.Errorf("reject: got status > %v", payment.Status)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/1/history", nil, nil)
+	var history []types.Payment
+	decodeBody(t, rec, &history)
+	if len(history) != 3 {
+		t.Errorf("history: got %v payments, want 3", len(history))
+	}
+
+	rec = do(t, srv, http.MethodGet, "/payments/sum?goroutines=2", nil, nil)
+	var sum sumResponse
+	decodeBody(t, rec, &sum)
+	if sum.Sum != 30_00 {
+		t.Errorf("sum: got > %v want > %v", sum.Sum, 30_00)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/1", nil, nil)
+	decodeBody(t, rec, &account)
+	if account.Balance != 80_00 {
+		t.Errorf("balance: got > %v want > %v", account.Balance, 80_00)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/accounts/42", nil, http.StatusNotFound, "account_not_found"},
+		{http.MethodGet, "/accounts/abc", nil, http.StatusBadRequest, "bad_request"},
+		{http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, http.StatusConflict, "phone_registered"},
+		{http.MethodPost, "/accounts", map[string]string{"email": "x"}, http.StatusBadRequest, "bad_request"},
+		{http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": -1}, http.StatusBadRequest, "amount_must_be_positive"},
+		{http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 5, "category": "Cafe"}, http.StatusUnprocessableEntity, "not_enough_balance"},
+		{http.MethodGet, "/payments/unknown", nil, http.StatusNotFound, "payment_not_found"},
+		{http.MethodPost, "/favorites/unknown/pay", nil, http.StatusNotFound, "favorite_not_found"},
+		{http.MethodDelete, "/accounts/1", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/accounts/1/unknown", nil, http.StatusNotFound, "not_found"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		if rec.Code != test.status {
+			t.Errorf("%v %v: got status > %v want > %v", test.method, test.path, rec.Code, test.status)
+			continue
+		}
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if body.Error.Code != test.code {
+			t.Errorf("%v %v: got code > %v want > %v", test.method, test.path, body.Error.Code, test.code)
+		}
+	}
+}
+
+func TestServer_actor(t *testing.T) {
+	svc := &wallet.Service{}
+	srv := NewServer(svc, nil, ClientAsserted)
+
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	headers := map[string]string{HeaderActorID: "aziz", HeaderActorRole: "operator"}
+	rec := do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, headers)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deposit: got > %v %v", rec.Code, rec.Body)
+	}
+
+	records := svc.AuditLog(wallet.AuditQuery{})
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	if want := (wallet.Actor{ID: "anonymous", Role: "api"}); records[0].Actor != want {
+		t.Errorf("register actor = %+v, want %+v", records[0].Actor, want)
+	}
+	if want := (wallet.Actor{ID: "aziz", Role: "operator"}); records[1].Actor != want {
+		t.Errorf("deposit actor = %+v, want %+v", records[1].Actor, want)
+	}
+}
+
+func TestServer_authenticator(t *testing.T) {
+	svc := &wallet.Service{}
+	headers := map[string]string{HeaderActorID: "aziz", HeaderActorRole: "operator"}
+	do(t, NewServer(svc, nil, nil), http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, headers)
+
+	const token = "secret"
+	srv := NewServer(svc, nil, func(r *http.Request) (wallet.Actor, error) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			return wallet.Actor{}, ErrUnauthenticated
+		}
+		return wallet.Actor{ID: "cashier", Role: "operator"}, nil
+	})
+	rec := do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, headers)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without token: got > %v %v", rec.Code, rec.Body)
+	}
+	headers["Authorization"] = "Bearer " + token
+	rec = do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, headers)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with token: got > %v %v", rec.Code, rec.Body)
+	}
+
+	records := svc.AuditLog(wallet.AuditQuery{})
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	if want := (wallet.Actor{ID: "anonymous", Role: "api"}); records[0].Actor != want {
+		t.Errorf("default authenticator actor = %+v, want %+v", records[0].Actor, want)
+	}
+	if want := (wallet.Actor{ID: "cashier", Role: "operator"}); records[1].Actor != want {
+		t.Errorf("custom authenticator actor = %+v, want %+v", records[1].Actor, want)
+	}
+}
+
+func TestServer_favorites(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	var favorites []types.Favorite
+	for _, name := range []string{"coffee", "taxi"} {
+		rec := do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 1_00, "category": "Cafe"}, nil)
+		var payment types.Payment
+		decodeBody(t, rec, &payment)
+		rec = do(t, srv, http.MethodPost, "/favorites", map[string]string{"paymentId": payment.ID, "name": name}, nil)
+		var favorite types.Favorite
+		decodeBody(t, rec, &favorite)
+		favorites = append(favorites, favorite)
+	}
+
+	rec := do(t, srv, http.MethodPatch, "/favorites/"+favorites[1].ID, map[string]string{"name": "Coffee"}, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("rename: got > %v %v", rec.Code, rec.Body)
+	}
+	rec = do(t, srv, http.MethodPatch, "/favorites/"+favorites[1].ID, map[string]interface{}{"name": "cab", "amount": 2_00}, nil)
+	var updated types.Favorite
+	decodeBody(t, rec, &updated)
+	if updated.Name != "cab" || updated.Amount != 2_00 || updated.Category != "Cafe" {
+		t.Errorf("update: got > %+v", updated)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorites[1].ID+"/move", map[string]int{"position": 0}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("move: got > %v %v", rec.Code, rec.Body)
+	}
+	rec = do(t, srv, http.MethodDelete, "/favorites/"+favorites[0].ID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/1/favorites", nil, nil)
+	var list []types.Favorite
+	decodeBody(t, rec, &list)
+	if len(list) != 1 || list[0].ID != favorites[1].ID {
+		t.Errorf("list: got > %+v", list)
+	}
+}
+
+func TestServer_favoriteTemplate(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	body := map[string]interface{}{"accountId": 1, "name": "electricity", "category": "utilities", "variableAmount": true}
+	rec := do(t, srv, http.MethodPost, "/favorites", body, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: got > %v %v", rec.Code, rec.Body)
+	}
+	var favorite types.Favorite
+	decodeBody(t, rec, &favorite)
+
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/pay", map[string]int{"amount": 30_00}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("pay: got > %v %v", rec.Code, rec.Body)
+	}
+	var payment types.Payment
+	decodeBody(t, rec, &payment)
+	if payment.Amount != 30_00 || payment.Category != "utilities" {
+		t.Errorf("pay: got > %+v", payment)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/pay", nil, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("pay without amount: got > %v %v", rec.Code, rec.Body)
+	}
+}
+
+func TestServer_categories(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	rec := do(t, srv, http.MethodPost, "/categories", map[string]string{"id": "food", "name": "Food"}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: got > %v %v", rec.Code, rec.Body)
+	}
+	rec = do(t, srv, http.MethodPost, "/categories", map[string]string{"id": "Cafe", "parent": "Food"}, nil)
+	var category types.Category
+	decodeBody(t, rec, &category)
+	if category.ID != "cafe" || category.Parent != "food" {
+		t.Errorf("register child: got > %+v", category)
+	}
+
+	pay := map[string]interface{}{"accountId": 1, "amount": 1_00, "category": "CAFE"}
+	rec = do(t, srv, http.MethodPost, "/payments", pay, nil)
+	var payment types.Payment
+	decodeBody(t, rec, &payment)
+	if payment.Category != "cafe" {
+		t.Errorf("pay: got category > %v", payment.Category)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/categories/food/disable", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("disable: got > %v %v", rec.Code, rec.Body)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/payments", pay, http.StatusUnprocessableEntity, "category_disabled"},
+		{http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 1_00, "category": "casino"}, http.StatusUnprocessableEntity, "unknown_category"},
+		{http.MethodGet, "/categories/casino", nil, http.StatusNotFound, "category_not_found"},
+		{http.MethodPost, "/categories", map[string]string{"id": "FOOD"}, http.StatusConflict, "category_exists"},
+		{http.MethodDelete, "/categories/food", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if rec.Code != test.status || body.Error.Code != test.code {
+			t.Errorf("%v %v: got > %v %v want > %v %v", test.method, test.path, rec.Code, body.Error.Code, test.status, test.code)
+		}
+	}
+
+	rec = do(t, srv, http.MethodGet, "/categories/food/children", nil, nil)
+	var children []types.Category
+	decodeBody(t, rec, &children)
+	if len(children) != 1 || children[0].ID != "cafe" {
+		t.Errorf("children: got > %+v", children)
+	}
+}
+
+func TestServer_categoryCycle(t *testing.T) {
+	svc := &wallet.Service{}
+	srv := NewServer(svc, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+	do(t, srv, http.MethodPost, "/categories", map[string]string{"id": "food"}, nil)
+	// цикл, который мог попасть в каталог в обход Import
+	food, _ := svc.FindCategoryByID("food")
+	food.Parent = "food"
+
+	rec := do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 1_00, "category": "food"}, nil)
+	var body ErrorBody
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusUnprocessableEntity || body.Error.Code != "category_cycle" {
+		t.Errorf("pay: got > %v %v", rec.Code, body.Error.Code)
+	}
+}
+
+func TestServer_merchants(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000002"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	body := map[string]interface{}{"name": "Coffee House", "categories": []string{"cafe"}, "settlementAccountId": 2}
+	rec := do(t, srv, http.MethodPost, "/merchants", body, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: got > %v %v", rec.Code, rec.Body)
+	}
+	var merchant types.Merchant
+	decodeBody(t, rec, &merchant)
+
+	pay := map[string]interface{}{"accountId": 1, "amount": 10_00, "merchantId": merchant.ID}
+	rec = do(t, srv, http.MethodPost, "/payments", pay, map[string]string{"Idempotency-Key": "m1"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("pay: got > %v %v", rec.Code, rec.Body)
+	}
+	do(t, srv, http.MethodPost, "/payments", pay, map[string]string{"Idempotency-Key": "m1"})
+
+	rec = do(t, srv, http.MethodPost, "/settlements", nil, nil)
+	var reports []wallet.SettlementReport
+	decodeBody(t, rec, &reports)
+	if len(reports) != 1 || reports[0].Settlement.Amount != 10_00 {
+		t.Fatalf("run: got > %+v", reports)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/settlements/"+reports[0].Settlement.ID, nil, nil)
+	var report wallet.SettlementReport
+	decodeBody(t, rec, &report)
+	if len(report.Entries) != 1 {
+		t.Errorf("report: got > %+v", report)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/merchants/"+merchant.ID+"/settle", nil, nil)
+	var errBody ErrorBody
+	decodeBody(t, rec, &errBody)
+	if rec.Code != http.StatusUnprocessableEntity || errBody.Error.Code != "nothing_to_settle" {
+		t.Errorf("settle: got > %v %v", rec.Code, errBody.Error.Code)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/2", nil, nil)
+	var account types.Account
+	decodeBody(t, rec, &account)
+	if account.Balance != 10_00 {
+		t.Errorf("balance: got > %v want > %v", account.Balance, 10_00)
+	}
+}
+
+func TestServer_fees(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	schedule := []types.FeeRule{
+		{Operation: types.FeePayment, BasisPoints: 100, Min: 1_00},
+		{Operation: types.FeeWithdrawal, Flat: 2_00},
+	}
+	rec := do(t, srv, http.MethodPut, "/fees", schedule, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set schedule: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/fees/quote?operation=PAYMENT&amount=50000", nil, nil)
+	var quote feeQuoteResponse
+	decodeBody(t, rec, &quote)
+	if quote.Total != 5_00 || len(quote.Fees) != 1 {
+		t.Errorf("quote: got > %+v", quote)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/accounts/1/withdraw", map[string]int{"amount": 50_00}, nil)
+	var withdrawal types.Withdrawal
+	decodeBody(t, rec, &withdrawal)
+	if rec.Code != http.StatusCreated || len(withdrawal.Fees) != 1 || withdrawal.Fees[0].Amount != 2_00 {
+		t.Errorf("withdraw: got > %v %+v", rec.Code, withdrawal)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 48_00, "category": "shop"}, http.StatusUnprocessableEntity, "not_enough_balance"},
+		{http.MethodPut, "/fees", []types.FeeRule{{Operation: "REFUND"}}, http.StatusBadRequest, "invalid_fee_rule"},
+		{http.MethodGet, "/fees/quote?amount=x", nil, http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "/accounts/1/withdraw", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if rec.Code != test.status || body.Error.Code != test.code {
+			t.Errorf("%v %v: got > %v %v want > %v %v", test.method, test.path, rec.Code, body.Error.Code, test.status, test.code)
+		}
+	}
+}
+
+func TestServer_rewards(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 100_00}, nil)
+
+	rules := []types.RewardRule{{Kind: types.RewardCashback, BasisPoints: 1_000, Cap: 5_00, Period: types.PeriodMonth}}
+	rec := do(t, srv, http.MethodPut, "/rewards", rules, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set rules: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 20_00, "category": "cafe"}, nil)
+	var payment types.Payment
+	decodeBody(t, rec, &payment)
+	rec = do(t, srv, http.MethodPost, "/payments/"+payment.ID+"/confirm", nil, nil)
+	decodeBody(t, rec, &payment)
+	if rec.Code != http.StatusOK || payment.Status != types.PaymentStatusOk {
+		t.Errorf("confirm: got > %v %+v", rec.Code, payment)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/1/rewards", nil, nil)
+	var balance wallet.RewardBalance
+	decodeBody(t, rec, &balance)
+	if balance.Cashback != 2_00 || len(balance.History) != 1 {
+		t.Errorf("rewards: got > %+v", balance)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/payments/" + payment.ID + "/confirm", nil, http.StatusConflict, "payment_not_in_progress"},
+		{http.MethodPut, "/rewards", []types.RewardRule{{Kind: "BONUS", BasisPoints: 1}}, http.StatusBadRequest, "invalid_reward_rule"},
+		{http.MethodGet, "/accounts/42/rewards", nil, http.StatusNotFound, "account_not_found"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if rec.Code != test.status || body.Error.Code != test.code {
+			t.Errorf("%v %v: got > %v %v want > %v %v", test.method, test.path, rec.Code, body.Error.Code, test.status, test.code)
+		}
+	}
+}
+
+func TestServer_budgets(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	do(t, srv, http.MethodPost, "/accounts/1/deposit", map[string]int{"amount": 1_000_00}, nil)
+
+	body := map[string]interface{}{"category": "cafe", "period": "MONTH", "limit": 500_00}
+	rec := do(t, srv, http.MethodPost, "/accounts/1/budgets", body, nil)
+	var usage wallet.BudgetUsage
+	decodeBody(t, rec, &usage)
+	if rec.Code != http.StatusOK || usage.Budget.Limit != 500_00 {
+		t.Fatalf("set budget: got > %v %+v", rec.Code, usage)
+	}
+
+	do(t, srv, http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 400_00, "category": "cafe"}, nil)
+	rec = do(t, srv, http.MethodGet, "/budgets/"+usage.Budget.ID, nil, nil)
+	decodeBody(t, rec, &usage)
+	if usage.Spent != 400_00 || usage.Remaining != 100_00 || usage.Percent != 80 {
+		t.Errorf("usage: got > %+v", usage)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/budgets/"+usage.Budget.ID, nil, nil)
+	var fields map[string]json.RawMessage
+	decodeBody(t, rec, &fields)
+	for _, name := range []string{"budget", "from", "to", "spent", "remaining", "percent"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("usage: field %q missing in %v", name, fields)
+		}
+	}
+
+	rec = do(t, srv, http.MethodGet, "/accounts/1/budgets", nil, nil)
+	var usages []wallet.BudgetUsage
+	decodeBody(t, rec, &usages)
+	if len(usages) != 1 {
+		t.Errorf("budgets: got > %+v", usages)
+	}
+
+	rec = do(t, srv, http.MethodDelete, "/budgets/"+usage.Budget.ID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete: got > %v %v", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/budgets/" + usage.Budget.ID, nil, http.StatusNotFound, "budget_not_found"},
+		{http.MethodPost, "/accounts/1/budgets", map[string]interface{}{"category": "cafe", "period": "YEAR", "limit": 1}, http.StatusBadRequest, "invalid_budget"},
+		{http.MethodPut, "/accounts/1/budgets", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if rec.Code != test.status || body.Error.Code != test.code {
+			t.Errorf("%v %v: got > %v %v want > %v %v", test.method, test.path, rec.Code, body.Error.Code, test.status, test.code)
+		}
+	}
+}
+
+func TestServer_favoriteSchedules(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+	rec := do(t, srv, http.MethodPost, "/favorites", map[string]interface{}{"accountId": 1, "name": "rent", "amount": 100, "category": "auto"}, nil)
+	var favorite types.Favorite
+	decodeBody(t, rec, &favorite)
+
+	start := time.Date(2030, 1, 31, 9, 0, 0, 0, time.UTC)
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/schedules", map[string]interface{}{"kind": "MONTHLY", "start": start}, nil)
+	var schedule types.Schedule
+	decodeBody(t, rec, &schedule)
+	if rec.Code != http.StatusCreated || schedule.Kind != types.ScheduleMonthly || !schedule.NextRun.Equal(start) {
+		t.Fatalf("create: got > %v %+v", rec.Code, schedule)
+	}
+	rec = do(t, srv, http.MethodPost, "/favorites/"+favorite.ID+"/schedules", map[string]string{"kind": "CRON", "cron": "0 9 * * 1"}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create cron: got > %v %v", rec.Code, rec.Body)
+	}
+
+	rec = do(t, srv, http.MethodGet, "/favorites/"+favorite.ID+"/schedules", nil, nil)
+	var schedules []types.Schedule
+	decodeBody(t, rec, &schedules)
+	if rec.Code != http.StatusOK || len(schedules) != 2 {
+		t.Errorf("list: got > %v %+v", rec.Code, schedules)
+	}
+
+	rec = do(t, srv, http.MethodDelete, "/favorites/"+favorite.ID+"/schedules/"+schedule.ID, nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("cancel: got > %v %v", rec.Code, rec.Body)
+	}
+	rec = do(t, srv, http.MethodGet, "/favorites/"+favorite.ID+"/schedules", nil, nil)
+	decodeBody(t, rec, &schedules)
+	for _, got := range schedules {
+		if got.ID == schedule.ID && got.Active {
+			t.Errorf("cancelled schedule still active: %+v", got)
+		}
+	}
+
+	rec = do(t, srv, http.MethodPost, "/favorites", map[string]interface{}{"accountId": 1, "name": "fuel", "amount": 100, "category": "auto"}, nil)
+	var other types.Favorite
+	decodeBody(t, rec, &other)
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/favorites/missing/schedules", nil, http.StatusNotFound, "favorite_not_found"},
+		{http.MethodPost, "/favorites/missing/schedules", map[string]string{"kind": "ONCE"}, http.StatusNotFound, "favorite_not_found"},
+		{http.MethodPost, "/favorites/" + favorite.ID + "/schedules", map[string]string{"kind": "YEARLY"}, http.StatusBadRequest, "invalid_schedule"},
+		{http.MethodPost, "/favorites/" + favorite.ID + "/schedules", map[string]string{"kind": "CRON", "cron": "61 * * * *"}, http.StatusBadRequest, "invalid_cron"},
+		{http.MethodDelete, "/favorites/" + favorite.ID + "/schedules/missing", nil, http.StatusNotFound, "schedule_not_found"},
+		{http.MethodDelete, "/favorites/" + other.ID + "/schedules/" + schedule.ID, nil, http.StatusNotFound, "schedule_not_found"},
+		{http.MethodPut, "/favorites/" + favorite.ID + "/schedules", nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodGet, "/favorites/" + favorite.ID + "/schedules/" + schedule.ID, nil, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodDelete, "/favorites/" + favorite.ID + "/schedules/" + schedule.ID + "/runs", nil, http.StatusNotFound, "not_found"},
+	}
+	for _, test := range tests {
+		rec := do(t, srv, test.method, test.path, test.body, nil)
+		var body ErrorBody
+		decodeBody(t, rec, &body)
+		if rec.Code != test.status || body.Error.Code != test.code {
+			t.Errorf("%v %v: got > %v %v want > %v %v", test.method, test.path, rec.Code, body.Error.Code, test.status, test.code)
+		}
+	}
+}
+
+func TestServer_tier(t *testing.T) {
+	srv := NewServer(&wallet.Service{}, nil, nil)
+	do(t, srv, http.MethodPost, "/accounts", map[string]string{"phone": "+992000000001"}, nil)
+
+	rec := do(t, srv, http.MethodPut, "/accounts/1/tier", map[string]string{"tier": "BASIC", "reason": "passport"}, nil)
+	var change types.TierChange
+	decodeBody(t, rec, &change)
+	if rec.Code != http.StatusOK || change.From != types.TierAnonymous || change.To != types.TierBasic || change.Reason != "passport" {
+		t.Fatalf("set tier: got > %v %+v", rec.Code, change)
+	}
+	rec = do(t, srv, http.MethodGet, "/accounts/1", nil, nil)
+	var account types.Account
+	decodeBody(t, rec, &account)
+	if account.Tier != types.TierBasic {
+		t.Errorf("account tier = %q, want %q", account.Tier, types.TierBasic)
+	}
+
+	rec = do(t, srv, http.MethodPut, "/accounts/1/tier", map[string]string{"tier": "GOLD"}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown tier: got > %v %v", rec.Code, rec.Body)
+	}
+	rec = do(t, srv, http.MethodPost, "/accounts/1/tier", map[string]string{"tier": "FULL"}, nil)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST tier: got > %v %v", rec.Code, rec.Body)
+	}
+}
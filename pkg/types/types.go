@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 //Money int64
 type Money int64
 
@@ -18,35 +20,300 @@ const (
 
 //Payment model
 type Payment struct {
-	ID        string
-	AccountID int64
-	Amount    Money
-	Category  PaymentCategory
-	Status    PaymentStatus
+	ID        string          `json:"id"`
+	AccountID int64           `json:"accountId"`
+	Amount    Money           `json:"amount"`
+	Category  PaymentCategory `json:"category"`
+	Status    PaymentStatus   `json:"status"`
+	Created   time.Time       `json:"created"`
+	//MerchantID получатель платежа, пусто - платёж только по категории
+	MerchantID string `json:"merchantId,omitempty"`
+	//Fees комиссии, списанные сверх Amount
+	Fees []FeeLine `json:"fees,omitempty"`
 }
 
 //Phone string
 type Phone string
 
+//AccountTier string
+type AccountTier string
+
+//Tiers
+const (
+	TierAnonymous AccountTier = "ANONYMOUS"
+	TierBasic     AccountTier = "BASIC"
+	TierFull      AccountTier = "FULL"
+)
+
 //Account model
 type Account struct {
-	ID      int64
-	Phone   Phone
-	Balance Money
+	ID      int64       `json:"id"`
+	Phone   Phone       `json:"phone"`
+	Balance Money       `json:"balance"`
+	Tier    AccountTier `json:"tier"`
+}
+
+//TierPolicy limits, zero value means no limit
+type TierPolicy struct {
+	MaxBalance      Money `json:"maxBalance"`
+	MaxPayment      Money `json:"maxPayment"`
+	MonthlyTurnover Money `json:"monthlyTurnover"`
+}
+
+//TierChange audit record
+type TierChange struct {
+	AccountID int64       `json:"accountId"`
+	From      AccountTier `json:"from"`
+	To        AccountTier `json:"to"`
+	Reason    string      `json:"reason"`
+	Created   time.Time   `json:"created"`
+}
+
+//Category категория платежей из каталога, ID - каноническое имя
+type Category struct {
+	ID      PaymentCategory `json:"id"`
+	Name    string          `json:"name"`
+	Parent  PaymentCategory `json:"parent,omitempty"`
+	Enabled bool            `json:"enabled"`
 }
 
 //Favorite model
 type Favorite struct {
-	ID        string
-	AccountID int64
-	Name      string
-	Amount    Money
-	Category  PaymentCategory
+	ID        string          `json:"id"`
+	AccountID int64           `json:"accountId"`
+	Name      string          `json:"name"`
+	Amount    Money           `json:"amount"`
+	Category  PaymentCategory `json:"category"`
+	//VariableAmount сумма указывается при оплате, Amount - сумма по умолчанию
+	VariableAmount bool `json:"variableAmount,omitempty"`
 }
 
-
 //Progress ..
 type Progress struct {
-	Part   int
-	Result Money
-}
\ No newline at end of file
+	Part      int     `json:"part"`      // количество платежей в куске
+	Result    Money   `json:"result"`    // сумма платежей куска
+	Chunk     int     `json:"chunk"`     // порядковый номер отчёта, начиная с 1
+	Processed int     `json:"processed"` // сколько платежей обработано всего
+	Total     Money   `json:"total"`     // накопленная сумма
+	Percent   float64 `json:"percent"`   // процент выполнения
+}
+
+//Transfer model
+type Transfer struct {
+	ID            string    `json:"id"`
+	FromAccountID int64     `json:"fromAccountId"`
+	ToAccountID   int64     `json:"toAccountId"`
+	Amount        Money     `json:"amount"`
+	Created       time.Time `json:"created"`
+	Fees          []FeeLine `json:"fees,omitempty"`
+}
+
+//Withdrawal вывод денег со счёта
+type Withdrawal struct {
+	ID        string    `json:"id"`
+	AccountID int64     `json:"accountId"`
+	Amount    Money     `json:"amount"`
+	Created   time.Time `json:"created"`
+	Fees      []FeeLine `json:"fees,omitempty"`
+}
+
+//FeeOperation операция, за которую берётся комиссия
+type FeeOperation string
+
+//Fee operations
+const (
+	FeePayment    FeeOperation = "PAYMENT"
+	FeeTransfer   FeeOperation = "TRANSFER"
+	FeeWithdrawal FeeOperation = "WITHDRAWAL"
+)
+
+//FeeTier ставка для сумм от From включительно
+type FeeTier struct {
+	From        Money `json:"from"`
+	Flat        Money `json:"flat,omitempty"`
+	BasisPoints int64 `json:"basisPoints,omitempty"`
+}
+
+//FeeRule правило комиссии: Flat + Amount*BasisPoints/10000 (150 = 1.5%), при заданных Tiers
+//ставка берётся из последнего тира с From <= Amount. Min и Max ограничивают комиссию, 0 - без
+//ограничения. Category только для платежей, пусто - любая категория
+type FeeRule struct {
+	Name        string          `json:"name"`
+	Operation   FeeOperation    `json:"operation"`
+	Category    PaymentCategory `json:"category,omitempty"`
+	Flat        Money           `json:"flat,omitempty"`
+	BasisPoints int64           `json:"basisPoints,omitempty"`
+	Tiers       []FeeTier       `json:"tiers,omitempty"`
+	Min         Money           `json:"min,omitempty"`
+	Max         Money           `json:"max,omitempty"`
+}
+
+//FeeLine комиссия по одному правилу, Refunded - сколько из неё возвращено
+type FeeLine struct {
+	Rule     string `json:"rule"`
+	Amount   Money  `json:"amount"`
+	Refunded Money  `json:"refunded,omitempty"`
+}
+
+//Period календарный период: день, неделя с понедельника или месяц
+type Period string
+
+//Periods
+const (
+	PeriodDay   Period = "DAY"
+	PeriodWeek  Period = "WEEK"
+	PeriodMonth Period = "MONTH"
+)
+
+//RewardKind string
+type RewardKind string
+
+//Reward kinds
+const (
+	RewardCashback RewardKind = "CASHBACK"
+	RewardPoints   RewardKind = "POINTS"
+)
+
+//RewardRule начисление за подтверждённый платёж: Amount*BasisPoints/10000 с округлением вниз,
+//в дирамах для кэшбэка и в баллах для баллов. Cap ограничивает сумму начислений по правилу
+//на аккаунт за Period, 0 - без ограничения. Category пусто - любая категория
+type RewardRule struct {
+	Name        string          `json:"name"`
+	Kind        RewardKind      `json:"kind"`
+	Category    PaymentCategory `json:"category,omitempty"`
+	BasisPoints int64           `json:"basisPoints"`
+	Cap         int64           `json:"cap,omitempty"`
+	Period      Period          `json:"period,omitempty"`
+}
+
+//Reward начисление по правилу за платёж, Reversed - платёж отменён и начисление списано
+type Reward struct {
+	ID        string     `json:"id"`
+	AccountID int64      `json:"accountId"`
+	PaymentID string     `json:"paymentId"`
+	Rule      string     `json:"rule"`
+	Kind      RewardKind `json:"kind"`
+	Amount    int64      `json:"amount"`
+	Created   time.Time  `json:"created"`
+	Reversed  bool       `json:"reversed,omitempty"`
+}
+
+//Budget лимит расходов аккаунта по категории за период. Spent - расходы периода, начавшегося
+//в PeriodStart, Thresholds - пороги оповещений в процентах от Limit по возрастанию,
+//Alerted - наибольший достигнутый в этом периоде порог
+type Budget struct {
+	ID          string          `json:"id"`
+	AccountID   int64           `json:"accountId"`
+	Category    PaymentCategory `json:"category"`
+	Period      Period          `json:"period"`
+	Limit       Money           `json:"limit"`
+	Thresholds  []int           `json:"thresholds"`
+	Spent       Money           `json:"spent"`
+	PeriodStart time.Time       `json:"periodStart"`
+	Alerted     int             `json:"alerted,omitempty"`
+}
+
+//EntryKind string
+type EntryKind string
+
+//Entry kinds
+const (
+	EntryDeposit     EntryKind = "DEPOSIT"
+	EntryPayment     EntryKind = "PAYMENT"
+	EntryRefund      EntryKind = "REFUND"
+	EntryTransferIn  EntryKind = "TRANSFER_IN"
+	EntryTransferOut EntryKind = "TRANSFER_OUT"
+	EntrySettlement  EntryKind = "SETTLEMENT"
+	EntryWithdrawal  EntryKind = "WITHDRAWAL"
+	EntryFee         EntryKind = "FEE"
+	EntryFeeRefund   EntryKind = "FEE_REFUND"
+	EntryCashback    EntryKind = "CASHBACK"
+	EntryCashbackOut EntryKind = "CASHBACK_REVERSAL"
+)
+
+//Entry balance movement, Amount is positive for credit and negative for debit
+type Entry struct {
+	ID          string          `json:"id"`
+	AccountID   int64           `json:"accountId"`
+	Kind        EntryKind       `json:"kind"`
+	Amount      Money           `json:"amount"`
+	ReferenceID string          `json:"referenceId"`
+	Category    PaymentCategory `json:"category"`
+	Created     time.Time       `json:"created"`
+}
+
+//Merchant получатель платежей, Balance - сумма ещё не перечисленных платежей за вычетом отмен
+type Merchant struct {
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	Categories          []PaymentCategory `json:"categories"`
+	SettlementAccountID int64             `json:"settlementAccountId"`
+	Balance             Money             `json:"balance"`
+}
+
+//MerchantEntry движение баланса мерчанта: платёж (Amount > 0) или его отмена (Amount < 0)
+type MerchantEntry struct {
+	MerchantID   string    `json:"merchantId"`
+	PaymentID    string    `json:"paymentId"`
+	Amount       Money     `json:"amount"`
+	Created      time.Time `json:"created"`
+	SettlementID string    `json:"settlementId,omitempty"`
+}
+
+//Settlement перечисление баланса мерчанта на его счёт, Amount = Gross - Rejected
+type Settlement struct {
+	ID         string    `json:"id"`
+	MerchantID string    `json:"merchantId"`
+	AccountID  int64     `json:"accountId"`
+	Gross      Money     `json:"gross"`
+	Rejected   Money     `json:"rejected"`
+	Amount     Money     `json:"amount"`
+	Created    time.Time `json:"created"`
+}
+
+//ScheduleKind string
+type ScheduleKind string
+
+//Schedule kinds
+const (
+	ScheduleOnce    ScheduleKind = "ONCE"
+	ScheduleDaily   ScheduleKind = "DAILY"
+	ScheduleWeekly  ScheduleKind = "WEEKLY"
+	ScheduleMonthly ScheduleKind = "MONTHLY"
+	ScheduleCron    ScheduleKind = "CRON"
+)
+
+//Schedule of payments from favorite, Start is the first run and the anchor for periodic kinds
+type Schedule struct {
+	ID         string       `json:"id"`
+	FavoriteID string       `json:"favoriteId"`
+	Kind       ScheduleKind `json:"kind"`
+	Start      time.Time    `json:"start"`
+	Cron       string       `json:"cron,omitempty"`
+	NextRun    time.Time    `json:"nextRun"`
+	Due        time.Time    `json:"due"`
+	Attempts   int          `json:"attempts"`
+	Active     bool         `json:"active"`
+}
+
+//ScheduleRunStatus string
+type ScheduleRunStatus string
+
+//Schedule run statuses
+const (
+	ScheduleRunOK     ScheduleRunStatus = "OK"
+	ScheduleRunRetry  ScheduleRunStatus = "RETRY"
+	ScheduleRunFailed ScheduleRunStatus = "FAILED"
+)
+
+//ScheduleRun record of one scheduled payment attempt
+type ScheduleRun struct {
+	ScheduleID string            `json:"scheduleId"`
+	FavoriteID string            `json:"favoriteId"`
+	Due        time.Time         `json:"due"`
+	Executed   time.Time         `json:"executed"`
+	Attempt    int               `json:"attempt"`
+	Status     ScheduleRunStatus `json:"status"`
+	PaymentID  string            `json:"paymentId,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
@@ -0,0 +1,191 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrInvalidBucket возвращается при неизвестном интервале группировки
+var ErrInvalidBucket = errors.New("invalid time bucket")
+
+// Bucket интервал группировки платежей по времени
+type Bucket string
+
+// интервалы группировки
+const (
+	BucketNone  Bucket = ""
+	BucketDay   Bucket = "day"
+	BucketWeek  Bucket = "week"
+	BucketMonth Bucket = "month"
+)
+
+// GroupBy поля, по которым группируются платежи
+type GroupBy struct {
+	Category bool
+	Status   bool
+	Account  bool
+	Bucket   Bucket
+}
+
+// GroupKey ключ группы, поля без группировки остаются пустыми
+type GroupKey struct {
+	Category  types.PaymentCategory
+	Status    types.PaymentStatus
+	AccountID int64
+	// Period начало интервала (день, неделя с понедельника или месяц)
+	Period time.Time
+}
+
+// AggregateRow итоги по одной группе
+type AggregateRow struct {
+	Key   GroupKey
+	Count int
+	Sum   types.Money
+	Min   types.Money
+	Max   types.Money
+	Avg   types.Money
+}
+
+// Aggregate группирует подходящие под query платежи и считает по группам количество, сумму,
+// минимум, максимум и среднее. Сортировка и страницы query не учитываются.
+// Строки отсортированы по периоду, категории, статусу и аккаунту
+func (s *Service) Aggregate(ctx context.Context, query PaymentQuery, groupBy GroupBy, goroutines int) ([]AggregateRow, error) {
+	switch groupBy.Bucket {
+	case BucketNone, BucketDay, BucketWeek, BucketMonth:
+	default:
+		return nil, ErrInvalidBucket
+	}
+
+	result, err := s.MapReduce(ctx, ScanOptions{Goroutines: goroutines}, func(payments []*types.Payment) interface{} {
+		groups := make(map[GroupKey]*AggregateRow)
+		for _, payment := range payments {
+			if !query.matches(payment) {
+				continue
+			}
+			key := groupBy.key(payment)
+			row, ok := groups[key]
+			if !ok {
+				row = &AggregateRow{Key: key, Min: payment.Amount, Max: payment.Amount}
+				groups[key] = row
+			}
+			row.add(payment.Amount)
+		}
+		return groups
+	}, func(acc interface{}, part interface{}) interface{} {
+		groups := acc.(map[GroupKey]*AggregateRow)
+		for key, row := range part.(map[GroupKey]*AggregateRow) {
+			if existing, ok := groups[key]; ok {
+				existing.merge(row)
+				continue
+			}
+			groups[key] = row
+		}
+		return groups
+	}, make(map[GroupKey]*AggregateRow))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := result.(map[GroupKey]*AggregateRow)
+	rows := make([]AggregateRow, 0, len(groups))
+	for _, row := range groups {
+		row.Avg = row.Sum / types.Money(row.Count)
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key.less(rows[j].Key)
+	})
+	return rows, nil
+}
+
+// SumByCategory возвращает сумму неотменённых платежей аккаунта по категориям за период [from, to)
+func (s *Service) SumByCategory(accountID int64, from time.Time, to time.Time) (map[types.PaymentCategory]types.Money, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Aggregate(context.Background(), PaymentQuery{
+		AccountID: accountID,
+		Statuses:  []types.PaymentStatus{types.PaymentStatusInProgress, types.PaymentStatusOk},
+		From:      from,
+		To:        to,
+	}, GroupBy{Category: true}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[types.PaymentCategory]types.Money, len(rows))
+	for _, row := range rows {
+		sums[row.Key.Category] = row.Sum
+	}
+	return sums, nil
+}
+
+func (groupBy GroupBy) key(payment *types.Payment) GroupKey {
+	var key GroupKey
+	if groupBy.Category {
+		key.Category = payment.Category
+	}
+	if groupBy.Status {
+		key.Status = payment.Status
+	}
+	if groupBy.Account {
+		key.AccountID = payment.AccountID
+	}
+	key.Period = bucketStart(payment.Created, groupBy.Bucket)
+	return key
+}
+
+// bucketStart возвращает начало интервала, в который попадает t
+func bucketStart(t time.Time, bucket Bucket) time.Time {
+	year, month, day := t.Date()
+	switch bucket {
+	case BucketDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case BucketWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case BucketMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+func (row *AggregateRow) add(amount types.Money) {
+	row.Count++
+	row.Sum += amount
+	if amount < row.Min {
+		row.Min = amount
+	}
+	if amount > row.Max {
+		row.Max = amount
+	}
+}
+
+func (row *AggregateRow) merge(other *AggregateRow) {
+	row.Count += other.Count
+	row.Sum += other.Sum
+	if other.Min < row.Min {
+		row.Min = other.Min
+	}
+	if other.Max > row.Max {
+		row.Max = other.Max
+	}
+}
+
+func (key GroupKey) less(other GroupKey) bool {
+	if !key.Period.Equal(other.Period) {
+		return key.Period.Before(other.Period)
+	}
+	if key.Category != other.Category {
+		return key.Category < other.Category
+	}
+	if key.Status != other.Status {
+		return key.Status < other.Status
+	}
+	return key.AccountID < other.AccountID
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestService_Aggregate_categoryStatus(t *testing.T) {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+
+	svc.Pay(account.ID, 100, "Cafe")
+	svc.Pay(account.ID, 300, "Cafe")
+	svc.Pay(account.ID, 500, "auto")
+	payment, _ := svc.Pay(account.ID, 700, "Cafe")
+	svc.Reject(payment.ID)
+
+	rows, err := svc.Aggregate(context.Background(), PaymentQuery{}, GroupBy{Category: true, Status: true}, 2)
+	if err != nil {
+		t.Fatalf("Aggregate(): error = %v", err)
+	}
+
+	want := []AggregateRow{
+		{Key: GroupKey{Category: "Cafe", Status: types.PaymentStatusFail}, Count: 1, Sum: 700, Min: 700, Max: 700, Avg: 700},
+		{Key: GroupKey{Category: "Cafe", Status: types.PaymentStatusInProgress}, Count: 2, Sum: 400, Min: 100, Max: 300, Avg: 200},
+		{Key: GroupKey{Category: "auto", Status: types.PaymentStatusInProgress}, Count: 1, Sum: 500, Min: 500, Max: 500, Avg: 500},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got > %v \nwant > %v", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %v: got > %+v want > %+v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestService_Aggregate_monthBucket(t *testing.T) {
+	svc := &Service{}
+	now := time.Date(2021, 1, 30, 10, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time { return now })
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+
+	svc.Pay(account.ID, 100, "Cafe")
+	now = now.AddDate(0, 0, 3)
+	svc.Pay(account.ID, 200, "Cafe")
+	svc.Pay(account.ID, 300, "Cafe")
+
+	rows, err := svc.Aggregate(context.Background(), PaymentQuery{AccountID: account.ID}, GroupBy{Bucket: BucketMonth}, 0)
+	if err != nil {
+		t.Fatalf("Aggregate(): error = %v", err)
+	}
+	if len(rows) != 2 || rows[0].Sum != 100 || rows[1].Sum != 500 || rows[1].Count != 2 {
+		t.Errorf("got > %+v", rows)
+	}
+	if !rows[1].Key.Period.Equal(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong period: %v", rows[1].Key.Period)
+	}
+
+	if _, err := svc.Aggregate(context.Background(), PaymentQuery{}, GroupBy{Bucket: "year"}, 0); err != ErrInvalidBucket {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidBucket)
+	}
+}
+
+func TestService_SumByCategory(t *testing.T) {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	svc.Pay(account.ID, 100, "Cafe")
+	svc.Pay(account.ID, 200, "Cafe")
+	payment, _ := svc.Pay(account.ID, 400, "Cafe")
+	svc.Reject(payment.ID)
+
+	sums, err := svc.SumByCategory(account.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("SumByCategory(): error = %v", err)
+	}
+	if sums["Cafe"] != 300 {
+		t.Errorf("\ngot > %v \nwant > 300", sums["Cafe"])
+	}
+	if _, err := svc.SumByCategory(42, time.Time{}, time.Time{}); err != ErrAccountNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountNotFound)
+	}
+}
+
+func TestBucketStart_week(t *testing.T) {
+	sunday := time.Date(2021, 5, 9, 15, 0, 0, 0, time.UTC)
+	if got := bucketStart(sunday, BucketWeek); !got.Equal(time.Date(2021, 5, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got > %v", got)
+	}
+}
@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestService_AuditLog(t *testing.T) {
+	svc := &Service{}
+	operator := Actor{ID: "aziz", Role: "operator"}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 100_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 30_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.As(operator).Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.As(operator).Pay(account.ID, 1_000_00, "auto"); err != ErrNotEnoughtBalance {
+		t.Fatalf("Pay error = %v, want %v", err, ErrNotEnoughtBalance)
+	}
+
+	all := svc.AuditLog(AuditQuery{})
+	if len(all) != 4 {
+		t.Fatalf("got %d audit records, want 4", len(all))
+	}
+	if all[0].Actor != SystemActor || all[0].Action != AuditRegisterAccount {
+		t.Errorf("first record = %+v", all[0])
+	}
+
+	rejects := svc.AuditLog(AuditQuery{Target: paymentTarget(payment.ID), Action: AuditReject})
+	if len(rejects) != 1 {
+		t.Fatalf("got %d reject records, want 1", len(rejects))
+	}
+	reject := rejects[0]
+	if reject.Actor != operator {
+		t.Errorf("reject actor = %+v, want %+v", reject.Actor, operator)
+	}
+	if reject.Before.Payment.Status != types.PaymentStatusInProgress || reject.After.Payment.Status != types.PaymentStatusFail {
+		t.Errorf("reject payment status %v -> %v", reject.Before.Payment.Status, reject.After.Payment.Status)
+	}
+	if reject.Before.Account.Balance != 70_00 || reject.After.Account.Balance != 100_00 {
+		t.Errorf("reject balance %v -> %v", reject.Before.Account.Balance, reject.After.Account.Balance)
+	}
+	if got := svc.AuditLog(AuditQuery{ActorID: operator.ID}); len(got) != 1 {
+		t.Errorf("got %d records of operator, want 1", len(got))
+	}
+	if err := svc.VerifyAuditLog(); err != nil {
+		t.Errorf("VerifyAuditLog() = %v", err)
+	}
+
+	// записи наружу отдаются копиями
+	all[0].Actor.ID = "mallory"
+	if err := svc.VerifyAuditLog(); err != nil {
+		t.Errorf("VerifyAuditLog() after changing a copy = %v", err)
+	}
+}
+
+func TestService_VerifyAuditLog_tampered(t *testing.T) {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+	svc.Deposit(account.ID, 50_00)
+
+	svc.auditLog[1].After.Account.Balance = 1_000_00
+	if err := svc.VerifyAuditLog(); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("changed record: VerifyAuditLog() = %v, want %v", err, ErrAuditTampered)
+	}
+	svc.auditLog[1].After.Account.Balance = 100_00
+	if err := svc.VerifyAuditLog(); err != nil {
+		t.Fatalf("restored record: VerifyAuditLog() = %v", err)
+	}
+
+	svc.auditLog = append(svc.auditLog[:1], svc.auditLog[2:]...)
+	if err := svc.VerifyAuditLog(); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("removed record: VerifyAuditLog() = %v, want %v", err, ErrAuditTampered)
+	}
+}
+
+func TestService_AuditLog_exportImport(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	account, _ := svc.As(Actor{ID: "semicolon;user", Role: "operator"}).RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+	if _, err := svc.RegisterCategory("food,drinks", "Food, drinks", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.VerifyAuditLog(); err != nil {
+		t.Fatalf("VerifyAuditLog() after import = %v", err)
+	}
+	records := restored.AuditLog(AuditQuery{})
+	if len(records) != 3 || records[0].Actor.ID != "semicolon;user" {
+		t.Fatalf("imported records = %+v", records)
+	}
+	if targets := records[2].Targets; len(targets) != 1 || targets[0] != "category:food,drinks" {
+		t.Errorf("imported targets = %q, want %q", targets, []string{"category:food,drinks"})
+	}
+
+	path := filepath.Join(dir, "audit.dump")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.Split(string(content), "\n")[1], ";")
+	fields[4] = string(AuditReject)
+	lines := strings.Split(string(content), "\n")
+	lines[1] = strings.Join(fields, ";")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := &Service{}
+	if err := tampered.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := tampered.VerifyAuditLog(); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog() of edited file = %v, want %v", err, ErrAuditTampered)
+	}
+}
+
+func TestService_Import_existingAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	source := &Service{}
+	account, _ := source.RegisterAccount("+992000000001")
+	source.Deposit(account.ID, 100_00)
+	if err := source.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &Service{}
+	if err := target.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(target.AuditLog(AuditQuery{})); got != 2 {
+		t.Fatalf("initial import: %d records, want 2", got)
+	}
+
+	source.Deposit(account.ID, 50_00)
+	if err := source.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Import(dir); err != nil {
+		t.Fatalf("continuation: Import() = %v", err)
+	}
+	records := target.AuditLog(AuditQuery{})
+	if len(records) != 4 || records[2].Action != AuditDeposit || records[3].Action != AuditImport {
+		t.Fatalf("continuation: records = %+v", records)
+	}
+	if err := target.VerifyAuditLog(); err != nil {
+		t.Fatalf("continuation: VerifyAuditLog() = %v", err)
+	}
+
+	source.Deposit(account.ID, 10_00)
+	if err := source.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Import(dir); err != nil {
+		t.Fatalf("diverged: Import() = %v", err)
+	}
+	records = target.AuditLog(AuditQuery{})
+	if len(records) != 6 || records[4].Action != AuditDeposit || records[4].PrevHash != records[3].Hash {
+		t.Fatalf("diverged: records = %+v", records)
+	}
+	if err := target.VerifyAuditLog(); err != nil {
+		t.Fatalf("diverged: VerifyAuditLog() = %v", err)
+	}
+
+	path := filepath.Join(dir, "audit.dump")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(content), "\n")
+	fields := strings.Split(lines[3], ";")
+	fields[4] = string(AuditReject)
+	lines[3] = strings.Join(fields, ";")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Import(dir); !errors.Is(err, ErrAuditTampered) {
+		t.Fatalf("tampered: Import() = %v, want %v", err, ErrAuditTampered)
+	}
+	if got := len(target.AuditLog(AuditQuery{})); got != 6 {
+		t.Errorf("tampered: %d records, want 6", got)
+	}
+	if got, _ := target.FindAccountByID(account.ID); got.Balance != 160_00 {
+		t.Errorf("tampered: balance = %v, want %v", got.Balance, types.Money(160_00))
+	}
+}
@@ -0,0 +1,328 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки бюджетов
+var ErrBudgetNotFound = errors.New("budget not found")
+var ErrInvalidBudget = errors.New("budget needs a category, a known period, a positive limit and ascending positive thresholds")
+
+// defaultBudgetThresholds пороги оповещений, если при создании бюджета они не заданы
+var defaultBudgetThresholds = []int{80, 100}
+
+// BudgetUsage расход бюджета в текущем периоде [From, To)
+type BudgetUsage struct {
+	Budget    types.Budget `json:"budget"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Spent     types.Money  `json:"spent"`
+	Remaining types.Money  `json:"remaining"` // отрицательный, если лимит превышен
+	Percent   int          `json:"percent"`
+}
+
+// SetBudget задаёт лимит расходов аккаунта по категории за период. Для той же категории и
+// периода бюджет обновляется, новый бюджет сразу учитывает платежи текущего периода.
+// Пустой thresholds - оповещения на 80% и 100%
+func (s *Service) SetBudget(accountID int64, category types.PaymentCategory, period types.Period, limit types.Money, thresholds []int) (*types.Budget, error) {
+	if strings.TrimSpace(string(category)) == "" || strings.ContainsAny(string(category), ";\r\n") || !validPeriod(period) || limit <= 0 {
+		return nil, ErrInvalidBudget
+	}
+	if len(thresholds) == 0 {
+		thresholds = defaultBudgetThresholds
+	}
+	for i, threshold := range thresholds {
+		if threshold <= 0 || i > 0 && threshold <= thresholds[i-1] {
+			return nil, ErrInvalidBudget
+		}
+	}
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	category = s.categoryKey(category)
+
+	budget := s.findBudget(account.ID, category, period)
+	before := AuditState{}
+	if budget == nil {
+		budget = &types.Budget{ID: uuid.New().String(), AccountID: account.ID, Category: category, Period: period}
+		budget.PeriodStart, _ = periodBounds(period, s.now())
+		budget.Spent = s.spent(budget)
+		s.budgets = append(s.budgets, budget)
+	} else {
+		before.Budget = cloneBudget(budget)
+		s.rollBudget(budget)
+	}
+	budget.Limit = limit
+	budget.Thresholds = append([]int(nil), thresholds...)
+	// порог, достигнутый уже при установке, не оповещается
+	budget.Alerted = reachedThreshold(budget)
+
+	after := cloneBudget(budget)
+	s.audit(AuditSetBudget, before, AuditState{Budget: after}, accountTarget(account.ID), budgetTarget(budget.ID))
+	s.publish(BudgetSet{EventHeader: s.header(EventBudgetSet, account.ID), Budget: *after})
+	return budget, nil
+}
+
+// DeleteBudget удаляет бюджет
+func (s *Service) DeleteBudget(budgetID string) error {
+	for i, budget := range s.budgets {
+		if budget.ID != budgetID {
+			continue
+		}
+		s.budgets = append(s.budgets[:i], s.budgets[i+1:]...)
+		s.audit(AuditDeleteBudget, AuditState{Budget: cloneBudget(budget)}, AuditState{}, accountTarget(budget.AccountID), budgetTarget(budget.ID))
+		s.publish(BudgetDeleted{EventHeader: s.header(EventBudgetDeleted, budget.AccountID), BudgetID: budget.ID})
+		return nil
+	}
+	return ErrBudgetNotFound
+}
+
+// BudgetUsage возвращает расход бюджета в текущем периоде
+func (s *Service) BudgetUsage(budgetID string) (*BudgetUsage, error) {
+	budget := s.findBudgetByID(budgetID)
+	if budget == nil {
+		return nil, ErrBudgetNotFound
+	}
+	usage := s.usage(budget)
+	return &usage, nil
+}
+
+// Budgets возвращает бюджеты аккаунта с расходом в текущем периоде
+func (s *Service) Budgets(accountID int64) ([]BudgetUsage, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	usages := []BudgetUsage{}
+	for _, budget := range s.budgets {
+		if budget.AccountID == accountID {
+			usages = append(usages, s.usage(budget))
+		}
+	}
+	return usages, nil
+}
+
+// usage не меняет бюджет: если период сменился, а платежей ещё не было, расход нулевой
+func (s *Service) usage(budget *types.Budget) BudgetUsage {
+	usage := BudgetUsage{Budget: *cloneBudget(budget)}
+	usage.From, usage.To = periodBounds(budget.Period, s.now())
+	if budget.PeriodStart.Equal(usage.From) {
+		usage.Spent = budget.Spent
+	}
+	usage.Remaining = budget.Limit - usage.Spent
+	usage.Percent = int(usage.Spent * 100 / budget.Limit)
+	return usage
+}
+
+// trackBudgets учитывает платёж (amount > 0) или его отмену (amount < 0) в бюджетах аккаунта
+// и возвращает оповещения о пересечённых порогах. Отмена платежа прошлого периода
+// на текущий не влияет
+func (s *Service) trackBudgets(payment *types.Payment, amount types.Money) []BudgetThresholdReached {
+	var alerts []BudgetThresholdReached
+	for _, budget := range s.budgets {
+		if budget.AccountID != payment.AccountID || !s.inCategory(payment.Category, budget.Category) {
+			continue
+		}
+		s.rollBudget(budget)
+		if payment.Created.Before(budget.PeriodStart) {
+			continue
+		}
+
+		budget.Spent += amount
+		reached := reachedThreshold(budget)
+		for _, threshold := range budget.Thresholds {
+			if threshold > budget.Alerted && threshold <= reached {
+				alerts = append(alerts, BudgetThresholdReached{Budget: *cloneBudget(budget), Threshold: threshold})
+			}
+		}
+		// после отмены порог снова можно пересечь и получить оповещение
+		budget.Alerted = reached
+	}
+	return alerts
+}
+
+// publishBudgetAlerts публикует оповещения после события платежа, вызвавшего их
+func (s *Service) publishBudgetAlerts(alerts []BudgetThresholdReached) {
+	if s.events == nil {
+		return
+	}
+	for _, alert := range alerts {
+		alert.EventHeader = s.header(EventBudgetThresholdReached, alert.Budget.AccountID)
+		s.publish(alert)
+	}
+}
+
+// rollBudget начинает новый период, если текущий закончился
+func (s *Service) rollBudget(budget *types.Budget) {
+	start, _ := periodBounds(budget.Period, s.now())
+	if !budget.PeriodStart.Equal(start) {
+		budget.PeriodStart = start
+		budget.Spent = 0
+		budget.Alerted = 0
+	}
+}
+
+// spent сумма неотменённых платежей по категории бюджета в его текущем периоде
+func (s *Service) spent(budget *types.Budget) types.Money {
+	_, end := periodBounds(budget.Period, budget.PeriodStart)
+	total := types.Money(0)
+	for _, payment := range s.payments {
+		if payment.AccountID != budget.AccountID || payment.Status == types.PaymentStatusFail || !s.inCategory(payment.Category, budget.Category) {
+			continue
+		}
+		if !payment.Created.Before(budget.PeriodStart) && payment.Created.Before(end) {
+			total += payment.Amount
+		}
+	}
+	return total
+}
+
+// InCategory сообщает, относится ли категория платежа value к category
+// или к одной из её подкатегорий; обе категории ищутся в каталоге по каноническому имени
+func (s *Service) InCategory(value types.PaymentCategory, category types.PaymentCategory) bool {
+	return s.inCategory(value, s.categoryKey(category))
+}
+
+// inCategory проверяет, что категория платежа совпадает с категорией бюджета или вложена в неё
+func (s *Service) inCategory(value types.PaymentCategory, budgetCategory types.PaymentCategory) bool {
+	if s.categoryKey(value) == budgetCategory {
+		return true
+	}
+	category := s.findCategory(string(value))
+	if category == nil {
+		return false
+	}
+	// при зацикленных предках достаточно пройденной части пути
+	path, _ := s.categoryPath(category)
+	for _, current := range path {
+		if current.Parent == budgetCategory {
+			return true
+		}
+	}
+	return false
+}
+
+// reachedThreshold наибольший порог, достигнутый расходом бюджета, 0 - ни одного
+func reachedThreshold(budget *types.Budget) int {
+	reached := 0
+	for _, threshold := range budget.Thresholds {
+		if budget.Spent*100 >= budget.Limit*types.Money(threshold) {
+			reached = threshold
+		}
+	}
+	return reached
+}
+
+func (s *Service) findBudget(accountID int64, category types.PaymentCategory, period types.Period) *types.Budget {
+	for _, budget := range s.budgets {
+		if budget.AccountID == accountID && budget.Category == category && budget.Period == period {
+			return budget
+		}
+	}
+	return nil
+}
+
+func cloneBudget(budget *types.Budget) *types.Budget {
+	clone := *budget
+	clone.Thresholds = append([]int(nil), budget.Thresholds...)
+	return &clone
+}
+
+// exportBudgets перезаписывает budgets.dump даже пустым списком, иначе удалённый
+// последним бюджет вернулся бы при импорте
+func (s *Service) exportBudgets(dir string) error {
+	rows := make([][]string, 0, len(s.budgets))
+	for _, v := range s.budgets {
+		thresholds := make([]string, 0, len(v.Thresholds))
+		for _, threshold := range v.Thresholds {
+			thresholds = append(thresholds, strconv.Itoa(threshold))
+		}
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.AccountID, 10),
+			string(v.Category),
+			string(v.Period),
+			strconv.FormatInt(int64(v.Limit), 10),
+			strings.Join(thresholds, ","),
+			strconv.FormatInt(int64(v.Spent), 10),
+			formatTime(v.PeriodStart),
+			strconv.Itoa(v.Alerted),
+		})
+	}
+	return writeDump(filepath.Join(dir, "budgets.dump"), rows)
+}
+
+func (s *Service) importBudgets(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "budgets.dump"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 9 {
+			return ErrInvalidDump
+		}
+		accountID, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		limit, err := strconv.ParseInt(row[4], 10, 64)
+		if err != nil {
+			return err
+		}
+		var thresholds []int
+		for _, value := range strings.Split(row[5], ",") {
+			threshold, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			thresholds = append(thresholds, threshold)
+		}
+		spent, err := strconv.ParseInt(row[6], 10, 64)
+		if err != nil {
+			return err
+		}
+		periodStart, err := parseTime(row[7])
+		if err != nil {
+			return err
+		}
+		alerted, err := strconv.Atoi(row[8])
+		if err != nil {
+			return err
+		}
+
+		budget := &types.Budget{
+			ID:          row[0],
+			AccountID:   accountID,
+			Category:    types.PaymentCategory(row[2]),
+			Period:      types.Period(row[3]),
+			Limit:       types.Money(limit),
+			Thresholds:  thresholds,
+			Spent:       types.Money(spent),
+			PeriodStart: periodStart,
+			Alerted:     alerted,
+		}
+		if existing := s.findBudgetByID(budget.ID); existing != nil {
+			*existing = *budget
+			continue
+		}
+		s.budgets = append(s.budgets, budget)
+	}
+	return nil
+}
+
+func (s *Service) findBudgetByID(budgetID string) *types.Budget {
+	for _, budget := range s.budgets {
+		if budget.ID == budgetID {
+			return budget
+		}
+	}
+	return nil
+}
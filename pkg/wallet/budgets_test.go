@@ -0,0 +1,221 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestService_SetBudget(t *testing.T) {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+
+	tests := []struct {
+		name       string
+		account    int64
+		category   types.PaymentCategory
+		period     types.Period
+		limit      types.Money
+		thresholds []int
+		want       error
+	}{
+		{"default thresholds", account.ID, "cafe", types.PeriodMonth, 500_00, nil, nil},
+		{"custom thresholds", account.ID, "taxi", types.PeriodWeek, 100_00, []int{50, 90, 120}, nil},
+		{"empty category", account.ID, " ", types.PeriodMonth, 500_00, nil, ErrInvalidBudget},
+		{"unknown period", account.ID, "cafe", "YEAR", 500_00, nil, ErrInvalidBudget},
+		{"zero limit", account.ID, "cafe", types.PeriodMonth, 0, nil, ErrInvalidBudget},
+		{"unordered thresholds", account.ID, "cafe", types.PeriodMonth, 500_00, []int{100, 80}, ErrInvalidBudget},
+		{"zero threshold", account.ID, "cafe", types.PeriodMonth, 500_00, []int{0, 100}, ErrInvalidBudget},
+		{"unknown account", 42, "cafe", types.PeriodMonth, 500_00, nil, ErrAccountNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.SetBudget(test.account, test.category, test.period, test.limit, test.thresholds); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	// та же категория и период меняют бюджет, а не создают второй
+	budget, err := svc.SetBudget(account.ID, "Cafe", types.PeriodMonth, 300_00, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages, _ := svc.Budgets(account.ID)
+	if len(usages) != 2 || budget.Limit != 300_00 || budget.Category != "cafe" {
+		t.Errorf("budgets = %+v", usages)
+	}
+}
+
+func TestService_trackBudgets(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	svc := &Service{clock: func() time.Time { return now }}
+	var events []Event
+	bus := NewEventBus()
+	bus.Subscribe(func(event Event) { events = append(events, event) }, SubscribeOptions{})
+	svc.SetEventBus(bus)
+	svc.RegisterCategory("food", "Food", "")
+	svc.RegisterCategory("cafe", "Cafe", "food")
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+
+	// платёж до создания бюджета тоже входит в расход периода
+	svc.Pay(account.ID, 100_00, "cafe")
+	budget, err := svc.SetBudget(account.ID, "food", types.PeriodMonth, 500_00, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := func() []int {
+		var thresholds []int
+		for _, event := range events {
+			if alert, ok := event.(BudgetThresholdReached); ok {
+				thresholds = append(thresholds, alert.Threshold)
+			}
+		}
+		events = nil
+		return thresholds
+	}
+	alerts()
+
+	first, _ := svc.Pay(account.ID, 250_00, "food")
+	if got := alerts(); got != nil {
+		t.Errorf("alerts at 70%% = %v, want none", got)
+	}
+	second, _ := svc.Pay(account.ID, 50_00, "cafe")
+	if got := alerts(); !reflect.DeepEqual(got, []int{80}) {
+		t.Errorf("alerts at 80%% = %v, want [80]", got)
+	}
+	svc.Pay(account.ID, 30_00, "taxi")
+	third, _ := svc.Pay(account.ID, 150_00, "cafe")
+	if len(events) < 2 || events[0].Header().Type != EventPaymentCreated || events[1].Header().Type != EventBudgetThresholdReached {
+		t.Errorf("alert must follow the payment event: %+v", events)
+	}
+	if got := alerts(); !reflect.DeepEqual(got, []int{100}) {
+		t.Errorf("alerts at 110%% = %v, want [100]", got)
+	}
+
+	usage, _ := svc.BudgetUsage(budget.ID)
+	if usage.Spent != 550_00 || usage.Remaining != -50_00 || usage.Percent != 110 {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	// отмена опускает расход ниже порогов, и повторное пересечение снова оповещает
+	svc.Reject(third.ID)
+	svc.Reject(second.ID)
+	alerts()
+	svc.Pay(account.ID, 50_00, "cafe")
+	if got := alerts(); !reflect.DeepEqual(got, []int{80}) {
+		t.Errorf("alerts after reject = %v, want [80]", got)
+	}
+
+	// в новом месяце расход начинается с нуля, а отмена платежа прошлого месяца его не трогает
+	now = now.AddDate(0, 1, 0)
+	usage, _ = svc.BudgetUsage(budget.ID)
+	if usage.Spent != 0 {
+		t.Errorf("spent next month = %v, want 0", usage.Spent)
+	}
+	svc.Pay(account.ID, 20_00, "food")
+	svc.Reject(first.ID)
+	usage, _ = svc.BudgetUsage(budget.ID)
+	if usage.Spent != 20_00 {
+		t.Errorf("spent next month = %v, want %v", usage.Spent, 20_00)
+	}
+}
+
+func TestService_Reject_twice(t *testing.T) {
+	svc := &Service{}
+	var events []Event
+	bus := NewEventBus()
+	bus.Subscribe(func(event Event) { events = append(events, event) }, SubscribeOptions{})
+	svc.SetEventBus(bus)
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+	budget, _ := svc.SetBudget(account.ID, "Cafe", types.PeriodMonth, 50_00, nil)
+	payment, _ := svc.Pay(account.ID, 10_00, "Cafe")
+
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+	audited := len(svc.AuditLog(AuditQuery{}))
+	if err := svc.Reject(payment.ID); err != ErrPaymentRejected {
+		t.Errorf("error = %v, want %v", err, ErrPaymentRejected)
+	}
+	if account.Balance != 100_00 {
+		t.Errorf("balance = %v, want %v", account.Balance, 100_00)
+	}
+	if budget.Spent != 0 {
+		t.Errorf("spent = %v, want 0", budget.Spent)
+	}
+	if len(events) != 0 || len(svc.AuditLog(AuditQuery{})) != audited {
+		t.Errorf("second reject recorded %d events and %d audit records", len(events), len(svc.AuditLog(AuditQuery{}))-audited)
+	}
+}
+
+func TestService_Budgets_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	svc.Pay(account.ID, 100_00, "cafe")
+	cafe, _ := svc.SetBudget(account.ID, "cafe", types.PeriodMonth, 200_00, []int{50, 100})
+	deleted, _ := svc.SetBudget(account.ID, "taxi", types.PeriodDay, 50_00, nil)
+	payment, _ := svc.Pay(account.ID, 80_00, "cafe")
+	svc.Pay(account.ID, 10_00, "cafe")
+	svc.Reject(payment.ID)
+	svc.DeleteBudget(deleted.ID)
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := svc.Budgets(account.ID)
+	for name, got := range map[string]*Service{"imported": restored, "rebuilt": rebuilt} {
+		usages, err := got.Budgets(account.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(usages) != 1 || usages[0].Budget.ID != cafe.ID || usages[0].Spent != 110_00 || usages[0].Budget.Alerted != 50 {
+			t.Errorf("%s budgets = %+v, want %+v", name, usages, want)
+		}
+	}
+}
+
+func TestService_Budgets_exportAfterDeletingLast(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	budget, _ := svc.SetBudget(account.ID, "cafe", types.PeriodMonth, 100_00, nil)
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteBudget(budget.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.BudgetUsage(budget.ID); err != ErrBudgetNotFound {
+		t.Errorf("error = %v, want %v", err, ErrBudgetNotFound)
+	}
+}
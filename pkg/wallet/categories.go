@@ -0,0 +1,271 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки каталога категорий
+var ErrCategoryNotFound = errors.New("category not found")
+var ErrCategoryExists = errors.New("category already registered")
+var ErrCategoryDisabled = errors.New("category is disabled")
+var ErrInvalidCategory = errors.New("category id and name must be non-empty and must not contain ';' or line breaks")
+var ErrUnknownCategory = errors.New("category is not in the catalog")
+var ErrCategoryCycle = errors.New("category parents form a cycle")
+
+// CanonicalCategory приводит произвольное написание категории к каноническому ID:
+// нижний регистр, пробелы заменяются дефисом ("Fast Food" -> "fast-food")
+func CanonicalCategory(value string) types.PaymentCategory {
+	return types.PaymentCategory(strings.Join(strings.Fields(strings.ToLower(value)), "-"))
+}
+
+// RegisterCategory добавляет категорию в каталог. id приводится к каноническому виду,
+// пустое name заменяется на id, parent - ID или название уже зарегистрированной категории.
+// Пока каталог пуст, категории платежей не проверяются
+func (s *Service) RegisterCategory(id types.PaymentCategory, name string, parent types.PaymentCategory) (*types.Category, error) {
+	id = CanonicalCategory(string(id))
+	if name == "" {
+		name = string(id)
+	}
+	if id == "" || strings.ContainsAny(string(id)+name, ";\r\n") {
+		return nil, ErrInvalidCategory
+	}
+	if s.findCategory(string(id)) != nil || s.findCategory(name) != nil {
+		return nil, ErrCategoryExists
+	}
+	if parent != "" {
+		parentCategory := s.findCategory(string(parent))
+		if parentCategory == nil {
+			return nil, ErrCategoryNotFound
+		}
+		parent = parentCategory.ID
+	}
+
+	category := &types.Category{ID: id, Name: name, Parent: parent, Enabled: true}
+	s.categories = append(s.categories, category)
+
+	after := *category
+	s.audit(AuditRegisterCategory, AuditState{}, AuditState{Category: &after}, categoryTarget(category.ID))
+	s.publish(CategoryRegistered{EventHeader: s.header(EventCategoryRegistered, 0), Category: after})
+	return category, nil
+}
+
+// FindCategoryByID ищет категорию по ID или названию в любом регистре
+func (s *Service) FindCategoryByID(id types.PaymentCategory) (*types.Category, error) {
+	category := s.findCategory(string(id))
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// Categories возвращает каталог в порядке регистрации
+func (s *Service) Categories() []types.Category {
+	categories := make([]types.Category, 0, len(s.categories))
+	for _, category := range s.categories {
+		categories = append(categories, *category)
+	}
+	return categories
+}
+
+// Subcategories возвращает прямых потомков категории
+func (s *Service) Subcategories(id types.PaymentCategory) ([]types.Category, error) {
+	parent, err := s.FindCategoryByID(id)
+	if err != nil {
+		return nil, err
+	}
+	categories := []types.Category{}
+	for _, category := range s.categories {
+		if category.Parent == parent.ID {
+			categories = append(categories, *category)
+		}
+	}
+	return categories, nil
+}
+
+// EnableCategory разрешает платежи по категории
+func (s *Service) EnableCategory(id types.PaymentCategory) error {
+	return s.setCategoryEnabled(AuditEnableCategory, id, true)
+}
+
+// DisableCategory запрещает платежи по категории и всем её подкатегориям
+func (s *Service) DisableCategory(id types.PaymentCategory) error {
+	return s.setCategoryEnabled(AuditDisableCategory, id, false)
+}
+
+func (s *Service) setCategoryEnabled(action AuditAction, id types.PaymentCategory, enabled bool) error {
+	category, err := s.FindCategoryByID(id)
+	if err != nil {
+		return err
+	}
+	if category.Enabled == enabled {
+		return nil
+	}
+
+	before := *category
+	category.Enabled = enabled
+	after := *category
+	s.audit(action, AuditState{Category: &before}, AuditState{Category: &after}, categoryTarget(category.ID))
+	s.publish(CategoryChanged{EventHeader: s.header(EventCategoryChanged, 0), Category: after})
+	return nil
+}
+
+// checkCategory возвращает канонический ID категории для платежа или избранного.
+// Категория должна быть в каталоге и включена вместе со всеми предками. В отличие от
+// ErrCategoryNotFound, ErrUnknownCategory - ошибка в данных запроса, а не отсутствующий ресурс
+func (s *Service) checkCategory(value types.PaymentCategory) (types.PaymentCategory, error) {
+	if len(s.categories) == 0 {
+		return value, nil
+	}
+	category := s.findCategory(string(value))
+	if category == nil {
+		return "", ErrUnknownCategory
+	}
+	path, err := s.categoryPath(category)
+	if err != nil {
+		return "", err
+	}
+	for _, current := range path {
+		if !current.Enabled {
+			return "", ErrCategoryDisabled
+		}
+	}
+	return category.ID, nil
+}
+
+// categoryPath возвращает категорию и всех её предков до корня. Если предки зациклены,
+// возвращает пройденную часть пути и ErrCategoryCycle
+func (s *Service) categoryPath(category *types.Category) ([]*types.Category, error) {
+	visited := make(map[types.PaymentCategory]bool)
+	var path []*types.Category
+	for current := category; current != nil; current = s.findCategory(string(current.Parent)) {
+		if visited[current.ID] {
+			return path, ErrCategoryCycle
+		}
+		visited[current.ID] = true
+		path = append(path, current)
+	}
+	return path, nil
+}
+
+func (s *Service) findCategory(value string) *types.Category {
+	key := CanonicalCategory(value)
+	if key == "" {
+		return nil
+	}
+	for _, category := range s.categories {
+		if category.ID == key {
+			return category
+		}
+	}
+	for _, category := range s.categories {
+		if CanonicalCategory(category.Name) == key {
+			return category
+		}
+	}
+	return nil
+}
+
+// mapCategories переводит произвольные категории платежей, избранного, проводок, мерчантов и бюджетов
+// на канонические ID каталога; неизвестные категории регистрируются как корневые
+func (s *Service) mapCategories() {
+	if len(s.categories) == 0 {
+		return
+	}
+
+	mapped := make(map[types.PaymentCategory]types.PaymentCategory)
+	resolve := func(value types.PaymentCategory) types.PaymentCategory {
+		if value == "" {
+			return value
+		}
+		if id, ok := mapped[value]; ok {
+			return id
+		}
+		category := s.findCategory(string(value))
+		if category == nil {
+			category = &types.Category{ID: CanonicalCategory(string(value)), Name: string(value), Enabled: true}
+			s.categories = append(s.categories, category)
+		}
+		mapped[value] = category.ID
+		return category.ID
+	}
+
+	for _, payment := range s.payments {
+		payment.Category = resolve(payment.Category)
+	}
+	for _, favorite := range s.favorites {
+		favorite.Category = resolve(favorite.Category)
+	}
+	for _, entry := range s.entries {
+		entry.Category = resolve(entry.Category)
+	}
+	for _, merchant := range s.merchants {
+		for i, category := range merchant.Categories {
+			merchant.Categories[i] = resolve(category)
+		}
+	}
+	for _, budget := range s.budgets {
+		budget.Category = resolve(budget.Category)
+	}
+	s.resetIndex()
+}
+
+func (s *Service) exportCategories(dir string) error {
+	if len(s.categories) == 0 {
+		return nil
+	}
+	rows := make([][]string, 0, len(s.categories))
+	for _, v := range s.categories {
+		rows = append(rows, []string{
+			string(v.ID),
+			v.Name,
+			string(v.Parent),
+			strconv.FormatBool(v.Enabled),
+		})
+	}
+	return writeDump(filepath.Join(dir, "categories.dump"), rows)
+}
+
+// importCategories читает каталог и сопоставляет с ним категории уже загруженных данных
+func (s *Service) importCategories(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "categories.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 4 {
+			return ErrInvalidDump
+		}
+		category := &types.Category{
+			ID:     types.PaymentCategory(row[0]),
+			Name:   row[1],
+			Parent: types.PaymentCategory(row[2]),
+		}
+		if category.Enabled, err = strconv.ParseBool(row[3]); err != nil {
+			return err
+		}
+
+		if existing, err := s.FindCategoryByID(category.ID); err == nil {
+			*existing = *category
+			continue
+		}
+		s.categories = append(s.categories, category)
+	}
+
+	// родитель должен быть в каталоге, а цепочка предков - без циклов, иначе проверка платежа не завершится
+	for _, category := range s.categories {
+		if category.Parent != "" && s.findCategory(string(category.Parent)) == nil {
+			return ErrCategoryNotFound
+		}
+		if _, err := s.categoryPath(category); err != nil {
+			return err
+		}
+	}
+
+	s.mapCategories()
+	return nil
+}
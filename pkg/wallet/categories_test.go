@@ -0,0 +1,213 @@
+package wallet
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// catalogService сервис с аккаунтом и каталогом Food -> Cafe, Transport
+func catalogService(t *testing.T) *Service {
+	t.Helper()
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	if err := svc.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct{ id, name, parent string }{
+		{"food", "Food", ""},
+		{"cafe", "Cafe", "Food"},
+		{"transport", "", ""},
+	} {
+		if _, err := svc.RegisterCategory(types.PaymentCategory(v.id), v.name, types.PaymentCategory(v.parent)); err != nil {
+			t.Fatalf("RegisterCategory(%q): error = %v", v.id, err)
+		}
+	}
+	return svc
+}
+
+func TestService_RegisterCategory(t *testing.T) {
+	svc := catalogService(t)
+
+	tests := []struct {
+		name   string
+		id     types.PaymentCategory
+		parent types.PaymentCategory
+		want   error
+	}{
+		{"duplicate id in other case", "CAFE", "", ErrCategoryExists},
+		{"duplicate of a name", "Transport", "", ErrCategoryExists},
+		{"unknown parent", "taxi", "cars", ErrCategoryNotFound},
+		{"empty id", "  ", "", ErrInvalidCategory},
+		{"separator", "a;b", "", ErrInvalidCategory},
+		{"child of child", "Coffee Shop", "cafe", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.RegisterCategory(test.id, "", test.parent); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+
+	children, err := svc.Subcategories("cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Category{{ID: "coffee-shop", Name: "coffee-shop", Parent: "cafe", Enabled: true}}
+	if !reflect.DeepEqual(children, want) {
+		t.Errorf("Subcategories() = %+v, want %+v", children, want)
+	}
+}
+
+func TestService_Pay_category(t *testing.T) {
+	svc := catalogService(t)
+
+	for _, value := range []types.PaymentCategory{"Cafe", "cafe", " CAFE "} {
+		payment, err := svc.Pay(1, 1_00, value)
+		if err != nil {
+			t.Fatalf("Pay(%q): error = %v", value, err)
+		}
+		if payment.Category != "cafe" {
+			t.Errorf("Pay(%q): category = %q, want cafe", value, payment.Category)
+		}
+	}
+	if _, err := svc.Pay(1, 1_00, "casino"); err != ErrUnknownCategory {
+		t.Errorf("unknown: error = %v, want %v", err, ErrUnknownCategory)
+	}
+
+	payment, _ := svc.Pay(1, 1_00, "cafe")
+	if err := svc.DisableCategory("food"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(1, 1_00, "cafe"); err != ErrCategoryDisabled {
+		t.Errorf("disabled parent: error = %v, want %v", err, ErrCategoryDisabled)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, "coffee"); err != ErrCategoryDisabled {
+		t.Errorf("favorite of disabled: error = %v, want %v", err, ErrCategoryDisabled)
+	}
+	if _, err := svc.Pay(1, 1_00, "transport"); err != nil {
+		t.Errorf("other category: error = %v", err)
+	}
+
+	if err := svc.EnableCategory("Food"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, "coffee"); err != nil {
+		t.Errorf("favorite after enable: error = %v", err)
+	}
+}
+
+func TestService_Import_mapsCategories(t *testing.T) {
+	dir := t.TempDir()
+	legacy := &Service{}
+	account, _ := legacy.RegisterAccount("+992000000001")
+	legacy.Deposit(account.ID, 1_000_00)
+	for i, category := range []types.PaymentCategory{"Cafe", "CAFE", "Fast Food"} {
+		payment, err := legacy.Pay(account.ID, 1_00, category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := legacy.FavoritePayment(payment.ID, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := legacy.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := &Service{}
+	svc.RegisterCategory("cafe", "Cafe", "")
+	if err := svc.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := svc.QueryPayments(PaymentQuery{Categories: []types.PaymentCategory{"cafe"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Payments) != 2 {
+		t.Errorf("cafe payments = %d, want 2", len(page.Payments))
+	}
+	for _, favorite := range svc.Favorites() {
+		if favorite.Category != "cafe" && favorite.Category != "fast-food" {
+			t.Errorf("favorite %q category = %q", favorite.Name, favorite.Category)
+		}
+	}
+	if _, err := svc.FindCategoryByID("fast-food"); err != nil {
+		t.Errorf("unknown legacy category was not registered: %v", err)
+	}
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.Categories(), svc.Categories(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored catalog = %+v, want %+v", got, want)
+	}
+}
+
+func TestService_Import_categoryParents(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want error
+	}{
+		{"valid", [][]string{{"food", "Food", "", "true"}, {"cafe", "Cafe", "food", "true"}}, nil},
+		{"unknown parent", [][]string{{"cafe", "Cafe", "food", "true"}}, ErrCategoryNotFound},
+		{"self parent", [][]string{{"cafe", "Cafe", "cafe", "true"}}, ErrCategoryCycle},
+		{"cycle", [][]string{{"food", "Food", "cafe", "true"}, {"cafe", "Cafe", "food", "true"}}, ErrCategoryCycle},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := writeDump(filepath.Join(dir, "categories.dump"), test.rows); err != nil {
+				t.Fatal(err)
+			}
+			svc := &Service{}
+			if err := svc.Import(dir); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestService_Pay_categoryCycle(t *testing.T) {
+	svc := catalogService(t)
+	// цикл, который мог попасть в каталог в обход Import
+	food, _ := svc.FindCategoryByID("food")
+	food.Parent = "cafe"
+
+	if _, err := svc.Pay(1, 1_00, "cafe"); err != ErrCategoryCycle {
+		t.Errorf("error = %v, want %v", err, ErrCategoryCycle)
+	}
+	if svc.inCategory("cafe", "transport") {
+		t.Errorf("cafe must not be in transport")
+	}
+}
+
+func TestService_Categories_rebuild(t *testing.T) {
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+
+	svc.RegisterCategory("food", "Food", "")
+	svc.RegisterCategory("cafe", "Cafe", "food")
+	svc.DisableCategory("cafe")
+
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rebuilt.Categories(), svc.Categories(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rebuilt catalog = %+v, want %+v", got, want)
+	}
+}
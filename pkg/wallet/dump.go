@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrInvalidDump возвращается, если строка dump-файла не удалось разобрать
+var ErrInvalidDump = errors.New("invalid dump record")
+
+// writeDump записывает строки в dump-файл, поля разделяются ";"
+func writeDump(path string, rows [][]string) error {
+	var builder strings.Builder
+	for _, row := range rows {
+		builder.WriteString(strings.Join(row, ";"))
+		builder.WriteString("\n")
+	}
+	return ioutil.WriteFile(path, []byte(builder.String()), 0666)
+}
+
+// readDump читает dump-файл, записанный writeDump; если файла нет, возвращает nil
+func readDump(path string) ([][]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		rows = append(rows, strings.Split(line, ";"))
+	}
+	return rows, nil
+}
+
+// encodeField кодирует произвольный текст в base64, чтобы ";" и переводы строк не ломали dump-файл
+func encodeField(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// decodeField декодирует поле, записанное encodeField
+func decodeField(value string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrInvalidDump
+	}
+	return string(data), nil
+}
@@ -0,0 +1,387 @@
+package wallet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// EventType тип доменного события
+type EventType string
+
+// типы событий
+const (
+	EventAccountRegistered      EventType = "ACCOUNT_REGISTERED"
+	EventDeposited              EventType = "DEPOSITED"
+	EventPaymentCreated         EventType = "PAYMENT_CREATED"
+	EventPaymentRejected        EventType = "PAYMENT_REJECTED"
+	EventFavoriteCreated        EventType = "FAVORITE_CREATED"
+	EventTransferCreated        EventType = "TRANSFER_CREATED"
+	EventTierChanged            EventType = "TIER_CHANGED"
+	EventFavoriteUpdated        EventType = "FAVORITE_UPDATED"
+	EventFavoriteDeleted        EventType = "FAVORITE_DELETED"
+	EventFavoriteMoved          EventType = "FAVORITE_MOVED"
+	EventCategoryRegistered     EventType = "CATEGORY_REGISTERED"
+	EventCategoryChanged        EventType = "CATEGORY_CHANGED"
+	EventMerchantRegistered     EventType = "MERCHANT_REGISTERED"
+	EventMerchantSettled        EventType = "MERCHANT_SETTLED"
+	EventWithdrawn              EventType = "WITHDRAWN"
+	EventPaymentConfirmed       EventType = "PAYMENT_CONFIRMED"
+	EventBudgetSet              EventType = "BUDGET_SET"
+	EventBudgetDeleted          EventType = "BUDGET_DELETED"
+	EventBudgetThresholdReached EventType = "BUDGET_THRESHOLD_REACHED"
+)
+
+// EventHeader общие поля всех событий
+type EventHeader struct {
+	Type      EventType
+	AccountID int64
+	Sequence  int64 // порядковый номер события в сервисе, начиная с 1
+	Time      time.Time
+}
+
+// Header возвращает общие поля события
+func (h EventHeader) Header() EventHeader {
+	return h
+}
+
+// Event доменное событие; конкретный тип определяется через type switch
+type Event interface {
+	Header() EventHeader
+}
+
+// AccountRegistered зарегистрирован аккаунт
+type AccountRegistered struct {
+	EventHeader
+	Account types.Account
+}
+
+// Deposited счёт пополнен, Balance - баланс после пополнения
+type Deposited struct {
+	EventHeader
+	Amount  types.Money
+	Balance types.Money
+}
+
+// PaymentCreated создан платёж; RepeatOf заполнен для Repeat, FavoriteID - для PayFromFavorite
+type PaymentCreated struct {
+	EventHeader
+	Payment    types.Payment
+	Balance    types.Money
+	RepeatOf   string
+	FavoriteID string
+}
+
+// PaymentRejected платёж отменён и деньги возвращены на счёт
+type PaymentRejected struct {
+	EventHeader
+	Payment types.Payment
+	Balance types.Money
+}
+
+// PaymentConfirmed платёж подтверждён, Rewards - начисленные за него кэшбэк и баллы
+type PaymentConfirmed struct {
+	EventHeader
+	Payment types.Payment
+	Rewards []types.Reward
+	Balance types.Money
+}
+
+// FavoriteCreated платёж добавлен в Избранное
+type FavoriteCreated struct {
+	EventHeader
+	Favorite  types.Favorite
+	PaymentID string
+}
+
+// FavoriteUpdated изменён избранный платёж, Favorite - новое состояние
+type FavoriteUpdated struct {
+	EventHeader
+	Favorite types.Favorite
+}
+
+// FavoriteDeleted удалён избранный платёж
+type FavoriteDeleted struct {
+	EventHeader
+	FavoriteID string
+}
+
+// FavoriteMoved избранный платёж перемещён на позицию Position в списке аккаунта
+type FavoriteMoved struct {
+	EventHeader
+	FavoriteID string
+	Position   int
+}
+
+// TransferCreated выполнен перевод, AccountID в заголовке - счёт отправителя
+type TransferCreated struct {
+	EventHeader
+	Transfer types.Transfer
+}
+
+// TierChanged изменён уровень верификации аккаунта
+type TierChanged struct {
+	EventHeader
+	Change types.TierChange
+}
+
+// CategoryRegistered категория добавлена в каталог; AccountID в заголовке нулевой
+type CategoryRegistered struct {
+	EventHeader
+	Category types.Category
+}
+
+// CategoryChanged категория включена или отключена, Category - новое состояние
+type CategoryChanged struct {
+	EventHeader
+	Category types.Category
+}
+
+// MerchantRegistered зарегистрирован мерчант; AccountID в заголовке - счёт для выплат
+type MerchantRegistered struct {
+	EventHeader
+	Merchant types.Merchant
+}
+
+// MerchantSettled баланс мерчанта перечислен на его счёт
+type MerchantSettled struct {
+	EventHeader
+	Settlement types.Settlement
+}
+
+// Withdrawn деньги выведены со счёта, Balance - баланс после вывода и комиссий
+type Withdrawn struct {
+	EventHeader
+	Withdrawal types.Withdrawal
+	Balance    types.Money
+}
+
+// BudgetSet бюджет создан или изменён
+type BudgetSet struct {
+	EventHeader
+	Budget types.Budget
+}
+
+// BudgetDeleted бюджет удалён
+type BudgetDeleted struct {
+	EventHeader
+	BudgetID string
+}
+
+// BudgetThresholdReached расход бюджета достиг Threshold процентов лимита. Оповещение
+// следует за событием платежа и состояние не меняет: проектор пересчитывает бюджет сам
+type BudgetThresholdReached struct {
+	EventHeader
+	Budget    types.Budget
+	Threshold int
+}
+
+// DeliveryMode способ доставки событий подписчику
+type DeliveryMode int
+
+// способы доставки
+const (
+	// DeliverSync обработчик вызывается в горутине, выполняющей операцию, до возврата из метода сервиса
+	DeliverSync DeliveryMode = iota
+	// DeliverAsync обработчик вызывается в горутинах подписки, операция не ждёт обработки
+	DeliverAsync
+)
+
+// DefaultEventBuffer размер очереди асинхронного обработчика по умолчанию
+const DefaultEventBuffer = 64
+
+// EventHandler обработчик событий
+type EventHandler func(event Event)
+
+// SubscribeOptions настройки подписки
+type SubscribeOptions struct {
+	Mode DeliveryMode
+	// Types типы событий подписки, пусто - все события
+	Types []EventType
+	// Workers количество горутин асинхронной подписки, по умолчанию 1;
+	// события одного аккаунта всегда обрабатывает одна и та же горутина в порядке публикации
+	Workers int
+	// Buffer размер очереди каждой горутины, по умолчанию DefaultEventBuffer;
+	// при заполненной очереди публикация ждёт, события не теряются
+	Buffer int
+}
+
+// EventBus рассылает события подписчикам, безопасен для конкурентного использования
+type EventBus struct {
+	mu            sync.RWMutex
+	subscriptions []*Subscription
+}
+
+// Subscription подписка на события
+type Subscription struct {
+	bus     *EventBus
+	handler EventHandler
+	types   map[EventType]bool
+	mode    DeliveryMode
+
+	mu     sync.RWMutex
+	closed bool
+	queues []chan Event
+	wg     sync.WaitGroup
+	// done закрывается первым при остановке и освобождает публикацию, ждущую места в очереди
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// NewEventBus создаёт шину событий
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe подписывает handler на события
+func (b *EventBus) Subscribe(handler EventHandler, opts SubscribeOptions) *Subscription {
+	sub := &Subscription{bus: b, handler: handler, mode: opts.Mode, done: make(chan struct{})}
+	if len(opts.Types) > 0 {
+		sub.types = make(map[EventType]bool, len(opts.Types))
+		for _, eventType := range opts.Types {
+			sub.types[eventType] = true
+		}
+	}
+
+	if opts.Mode == DeliverAsync {
+		workers := opts.Workers
+		if workers <= 0 {
+			workers = 1
+		}
+		buffer := opts.Buffer
+		if buffer <= 0 {
+			buffer = DefaultEventBuffer
+		}
+		sub.queues = make([]chan Event, workers)
+		for i := range sub.queues {
+			queue := make(chan Event, buffer)
+			sub.queues[i] = queue
+			sub.wg.Add(1)
+			go func() {
+				defer sub.wg.Done()
+				for event := range queue {
+					handler(event)
+				}
+			}()
+		}
+	}
+
+	b.mu.Lock()
+	b.subscriptions = append(b.subscriptions, sub)
+	b.mu.Unlock()
+	return sub
+}
+
+// Publish доставляет событие всем подходящим подписчикам
+func (b *EventBus) Publish(event Event) {
+	b.mu.RLock()
+	subscriptions := make([]*Subscription, len(b.subscriptions))
+	copy(subscriptions, b.subscriptions)
+	b.mu.RUnlock()
+
+	for _, sub := range subscriptions {
+		sub.deliver(event)
+	}
+}
+
+// Close отписывает всех подписчиков и ждёт обработки уже поставленных в очередь событий.
+// Из обработчика асинхронной подписки Close не вызывается: он ждал бы сам себя
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	subscriptions := b.subscriptions
+	b.subscriptions = nil
+	b.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		sub.stop()
+	}
+	for _, sub := range subscriptions {
+		sub.wg.Wait()
+	}
+}
+
+// Unsubscribe прекращает доставку новых событий. События, уже стоящие в очереди асинхронной
+// подписки, обрабатываются в фоне: Unsubscribe их не ждёт, поэтому её можно вызвать из обработчика
+func (sub *Subscription) Unsubscribe() {
+	b := sub.bus
+	b.mu.Lock()
+	for i, v := range b.subscriptions {
+		if v == sub {
+			b.subscriptions = append(b.subscriptions[:i], b.subscriptions[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	sub.stop()
+}
+
+func (sub *Subscription) deliver(event Event) {
+	header := event.Header()
+	if sub.types != nil && !sub.types[header.Type] {
+		return
+	}
+
+	sub.mu.RLock()
+	if sub.closed {
+		sub.mu.RUnlock()
+		return
+	}
+	if sub.mode != DeliverAsync {
+		// обработчик может отписаться сам, поэтому вызывается без блокировки
+		sub.mu.RUnlock()
+		sub.handler(event)
+		return
+	}
+
+	shard := header.AccountID % int64(len(sub.queues))
+	if shard < 0 {
+		shard = -shard
+	}
+	// при заполненной очереди ждём места, пока подписку не остановят: stop закрывает done
+	// до захвата блокировки, иначе он ждал бы эту публикацию, а она - обработчик
+	select {
+	case sub.queues[shard] <- event:
+	case <-sub.done:
+	}
+	sub.mu.RUnlock()
+}
+
+// stop закрывает очереди; горутины подписки завершаются, обработав уже принятые события
+func (sub *Subscription) stop() {
+	sub.doneOnce.Do(func() { close(sub.done) })
+	sub.mu.Lock()
+	if !sub.closed {
+		sub.closed = true
+		for _, queue := range sub.queues {
+			close(queue)
+		}
+	}
+	sub.mu.Unlock()
+}
+
+// SetEventBus задаёт шину, в которую сервис публикует события об изменениях; nil - не публиковать
+func (s *Service) SetEventBus(bus *EventBus) {
+	s.events = bus
+}
+
+// header заполняет общие поля следующего события; без шины событие не публикуется,
+// поэтому номер и время не назначаются
+func (s *Service) header(eventType EventType, accountID int64) EventHeader {
+	if s.events == nil {
+		return EventHeader{Type: eventType, AccountID: accountID}
+	}
+	s.eventSequence++
+	return EventHeader{
+		Type:      eventType,
+		AccountID: accountID,
+		Sequence:  s.eventSequence,
+		Time:      s.now(),
+	}
+}
+
+func (s *Service) publish(event Event) {
+	if s.events != nil {
+		s.events.Publish(event)
+	}
+}
@@ -0,0 +1,202 @@
+package wallet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// eventRecorder собирает события, безопасен для асинхронной доставки
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) handle(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]EventType, 0, len(r.events))
+	for _, event := range r.events {
+		result = append(result, event.Header().Type)
+	}
+	return result
+}
+
+func TestService_events_sync(t *testing.T) {
+	svc := &Service{}
+	bus := NewEventBus()
+	svc.SetEventBus(bus)
+	recorder := &eventRecorder{}
+	bus.Subscribe(recorder.handle, SubscribeOptions{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 10_000_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite, err := svc.FavoritePayment(payment.ID, "fuel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.PayFromFavorite(favorite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Repeat(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(account.ID, 1_000_000_00, "auto"); err != ErrNotEnoughtBalance {
+		t.Fatalf("Pay error = %v, want %v", err, ErrNotEnoughtBalance)
+	}
+
+	want := []EventType{
+		EventAccountRegistered,
+		EventDeposited,
+		EventPaymentCreated,
+		EventFavoriteCreated,
+		EventPaymentCreated,
+		EventPaymentCreated,
+		EventPaymentRejected,
+	}
+	got := recorder.types()
+	if len(got) != len(want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %v, want %v", i, got[i], want[i])
+		}
+		if header := recorder.events[i].Header(); header.Sequence != int64(i+1) || header.AccountID != account.ID {
+			t.Errorf("event %d header = %+v", i, header)
+		}
+	}
+
+	fromFavorite := recorder.events[4].(PaymentCreated)
+	if fromFavorite.FavoriteID != favorite.ID || fromFavorite.RepeatOf != "" {
+		t.Errorf("PayFromFavorite event = %+v", fromFavorite)
+	}
+	repeated := recorder.events[5].(PaymentCreated)
+	if repeated.RepeatOf != payment.ID || repeated.Balance != 10_000_00-300_00 {
+		t.Errorf("Repeat event = %+v", repeated)
+	}
+	rejected := recorder.events[6].(PaymentRejected)
+	if rejected.Payment.Status != types.PaymentStatusFail || rejected.Balance != 10_000_00-200_00 {
+		t.Errorf("Reject event = %+v", rejected)
+	}
+}
+
+func TestService_events_idempotentReplay(t *testing.T) {
+	svc := &Service{}
+	bus := NewEventBus()
+	svc.SetEventBus(bus)
+	account, _ := svc.RegisterAccount("+992000000001")
+	recorder := &eventRecorder{}
+	bus.Subscribe(recorder.handle, SubscribeOptions{Types: []EventType{EventDeposited}})
+
+	for i := 0; i < 3; i++ {
+		if err := svc.DepositWithKey("key", account.ID, 100_00); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := recorder.types(); len(got) != 1 {
+		t.Errorf("got events %v, want one %v", got, EventDeposited)
+	}
+}
+
+func TestEventBus_asyncOrderPerAccount(t *testing.T) {
+	bus := NewEventBus()
+	const accounts = 5
+	const perAccount = 200
+
+	var mu sync.Mutex
+	last := make(map[int64]int64)
+	outOfOrder := 0
+	bus.Subscribe(func(event Event) {
+		header := event.Header()
+		mu.Lock()
+		defer mu.Unlock()
+		if header.Sequence <= last[header.AccountID] {
+			outOfOrder++
+		}
+		last[header.AccountID] = header.Sequence
+	}, SubscribeOptions{Mode: DeliverAsync, Workers: 3, Buffer: 4})
+
+	sequence := int64(0)
+	for i := 0; i < perAccount; i++ {
+		for account := int64(1); account <= accounts; account++ {
+			sequence++
+			bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: account, Sequence: sequence}})
+		}
+	}
+	bus.Close()
+
+	if outOfOrder != 0 {
+		t.Errorf("%d events delivered out of order", outOfOrder)
+	}
+	for account := int64(1); account <= accounts; account++ {
+		if want := sequence - accounts + account; last[account] != want {
+			t.Errorf("last event of account %d = %d, want %d", account, last[account], want)
+		}
+	}
+}
+
+func TestEventBus_unsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	recorder := &eventRecorder{}
+	var sub *Subscription
+	sub = bus.Subscribe(func(event Event) {
+		recorder.handle(event)
+		sub.Unsubscribe()
+	}, SubscribeOptions{})
+
+	bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1}})
+	bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1}})
+
+	if got := recorder.types(); len(got) != 1 {
+		t.Errorf("got %d events after unsubscribe, want 1", len(got))
+	}
+}
+
+func TestEventBus_unsubscribeFromAsyncHandler(t *testing.T) {
+	bus := NewEventBus()
+	release := make(chan struct{})
+	var sub *Subscription
+	sub = bus.Subscribe(func(event Event) {
+		<-release
+		sub.Unsubscribe()
+	}, SubscribeOptions{Mode: DeliverAsync, Buffer: 1})
+
+	// первое событие занимает обработчик, второе - очередь, третья публикация ждёт места
+	bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1}})
+	bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1}})
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1}})
+		close(published)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked after the handler unsubscribed")
+	}
+	bus.Close()
+}
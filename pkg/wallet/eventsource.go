@@ -0,0 +1,500 @@
+package wallet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrInvalidEventStream возвращается, если событие нельзя применить к восстановленному состоянию
+var ErrInvalidEventStream = errors.New("invalid event stream")
+
+// EventStore хранит опубликованные события в порядке поступления;
+// метод Append можно подписать на шину синхронно
+type EventStore struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Append добавляет событие в конец
+func (st *EventStore) Append(event Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.events = append(st.events, event)
+}
+
+// Events возвращает копию всех событий
+func (st *EventStore) Events() []Event {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	events := make([]Event, len(st.events))
+	copy(events, st.events)
+	return events
+}
+
+// Projector восстанавливает состояние сервиса, применяя события по одному
+type Projector struct {
+	svc  *Service
+	last EventHeader
+}
+
+// NewProjector создаёт проектор с пустым состоянием
+func NewProjector() *Projector {
+	return &Projector{svc: &Service{}}
+}
+
+// Apply применяет следующее событие. Операции не проверяются повторно
+// (лимиты, достаточность баланса): событие - это уже совершившийся факт
+func (p *Projector) Apply(event Event) error {
+	header := event.Header()
+	if header.Sequence != 0 && header.Sequence <= p.last.Sequence {
+		return fmt.Errorf("%w: event %d after %d", ErrInvalidEventStream, header.Sequence, p.last.Sequence)
+	}
+
+	svc := p.svc
+	// журнал движений получает время события, а не время восстановления
+	svc.clock = func() time.Time {
+		return header.Time
+	}
+	defer func() {
+		svc.clock = nil
+	}()
+
+	var err error
+	switch event := event.(type) {
+	case AccountRegistered:
+		err = p.registerAccount(event.Account)
+	case Deposited:
+		err = p.credit(header.AccountID, event.Amount, types.EntryDeposit, "", "")
+	case PaymentCreated:
+		err = p.createPayment(event.Payment)
+	case PaymentRejected:
+		err = p.rejectPayment(event.Payment.ID)
+	case FavoriteCreated:
+		err = p.createFavorite(event.Favorite)
+	case FavoriteUpdated:
+		err = p.updateFavorite(event.Favorite)
+	case FavoriteDeleted:
+		err = p.deleteFavorite(event.FavoriteID)
+	case FavoriteMoved:
+		err = p.moveFavorite(event.FavoriteID, event.Position)
+	case TransferCreated:
+		err = p.transfer(event.Transfer)
+	case TierChanged:
+		err = p.changeTier(event.Change)
+	case CategoryRegistered:
+		err = p.registerCategory(event.Category)
+	case CategoryChanged:
+		err = p.changeCategory(event.Category)
+	case MerchantRegistered:
+		err = p.registerMerchant(event.Merchant)
+	case MerchantSettled:
+		err = p.settle(event.Settlement)
+	case Withdrawn:
+		err = p.withdraw(event.Withdrawal)
+	case PaymentConfirmed:
+		err = p.confirmPayment(event.Payment.ID, event.Rewards)
+	case BudgetSet:
+		err = p.setBudget(event.Budget)
+	case BudgetDeleted:
+		err = p.deleteBudget(event.BudgetID)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %d: %v", ErrInvalidEventStream, header.Type, header.Sequence, err)
+	}
+
+	p.last = header
+	if header.Sequence > svc.eventSequence {
+		svc.eventSequence = header.Sequence
+	}
+	return nil
+}
+
+// Service возвращает восстановленный сервис; дальнейшие события применяются к нему же
+func (p *Projector) Service() *Service {
+	return p.svc
+}
+
+func (p *Projector) registerAccount(account types.Account) error {
+	if _, err := p.svc.FindAccountByID(account.ID); err == nil {
+		return errors.New("account already registered")
+	}
+	account.Balance = 0
+	p.svc.accounts = append(p.svc.accounts, &account)
+	if account.ID > p.svc.NextAccountID {
+		p.svc.NextAccountID = account.ID
+	}
+	return nil
+}
+
+func (p *Projector) credit(accountID int64, amount types.Money, kind types.EntryKind, referenceID string, category types.PaymentCategory) error {
+	account, err := p.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	account.Balance += amount
+	p.svc.record(account.ID, kind, amount, referenceID, category)
+	return nil
+}
+
+func (p *Projector) createPayment(payment types.Payment) error {
+	if _, err := p.svc.FindPaymentByID(payment.ID); err == nil {
+		return errors.New("payment already created")
+	}
+	if err := p.credit(payment.AccountID, -payment.Amount, types.EntryPayment, payment.ID, payment.Category); err != nil {
+		return err
+	}
+	p.chargeFees(payment.AccountID, payment.Fees, payment.ID, payment.Category)
+	payment.Status = types.PaymentStatusInProgress
+	p.svc.payments = append(p.svc.payments, &payment)
+	p.svc.trackBudgets(&payment, payment.Amount)
+	if payment.MerchantID != "" {
+		merchant, err := p.svc.FindMerchantByID(payment.MerchantID)
+		if err != nil {
+			return err
+		}
+		p.svc.creditMerchant(merchant, &payment)
+	}
+	return nil
+}
+
+func (p *Projector) rejectPayment(paymentID string) error {
+	payment, err := p.svc.FindPaymentByID(paymentID)
+	if err != nil {
+		return err
+	}
+	if err := p.credit(payment.AccountID, payment.Amount, types.EntryRefund, payment.ID, payment.Category); err != nil {
+		return err
+	}
+	account, _ := p.svc.FindAccountByID(payment.AccountID)
+	p.svc.refundPaymentFees(account, payment)
+	p.svc.reverseRewards(account, payment)
+	p.svc.trackBudgets(payment, -payment.Amount)
+	payment.Status = types.PaymentStatusFail
+	p.svc.reverseMerchant(payment)
+	return nil
+}
+
+func (p *Projector) confirmPayment(paymentID string, rewards []types.Reward) error {
+	payment, err := p.svc.FindPaymentByID(paymentID)
+	if err != nil {
+		return err
+	}
+	account, err := p.svc.FindAccountByID(payment.AccountID)
+	if err != nil {
+		return err
+	}
+	payment.Status = types.PaymentStatusOk
+	for i := range rewards {
+		reward := rewards[i]
+		p.svc.applyReward(account, &reward)
+	}
+	return nil
+}
+
+func (p *Projector) setBudget(budget types.Budget) error {
+	if _, err := p.svc.FindAccountByID(budget.AccountID); err != nil {
+		return err
+	}
+	if existing := p.svc.findBudgetByID(budget.ID); existing != nil {
+		*existing = budget
+		return nil
+	}
+	p.svc.budgets = append(p.svc.budgets, &budget)
+	return nil
+}
+
+func (p *Projector) deleteBudget(budgetID string) error {
+	for i, budget := range p.svc.budgets {
+		if budget.ID == budgetID {
+			p.svc.budgets = append(p.svc.budgets[:i], p.svc.budgets[i+1:]...)
+			return nil
+		}
+	}
+	return ErrBudgetNotFound
+}
+
+func (p *Projector) createFavorite(favorite types.Favorite) error {
+	if _, err := p.svc.FindAccountByID(favorite.AccountID); err != nil {
+		return err
+	}
+	p.svc.favorites = append(p.svc.favorites, &favorite)
+	return nil
+}
+
+func (p *Projector) updateFavorite(favorite types.Favorite) error {
+	existing, err := p.svc.FindFavoriteByID(favorite.ID)
+	if err != nil {
+		return err
+	}
+	*existing = favorite
+	return nil
+}
+
+func (p *Projector) deleteFavorite(favoriteID string) error {
+	index := p.svc.favoriteIndex(favoriteID)
+	if index < 0 {
+		return ErrFavoriteNotFound
+	}
+	p.svc.favorites = append(p.svc.favorites[:index], p.svc.favorites[index+1:]...)
+	return nil
+}
+
+func (p *Projector) moveFavorite(favoriteID string, position int) error {
+	favorite, err := p.svc.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return err
+	}
+	return p.svc.moveFavorite(favorite, position)
+}
+
+func (p *Projector) transfer(transfer types.Transfer) error {
+	if _, err := p.svc.FindAccountByID(transfer.ToAccountID); err != nil {
+		return err
+	}
+	if err := p.credit(transfer.FromAccountID, -transfer.Amount, types.EntryTransferOut, transfer.ID, ""); err != nil {
+		return err
+	}
+	p.credit(transfer.ToAccountID, transfer.Amount, types.EntryTransferIn, transfer.ID, "")
+	p.chargeFees(transfer.FromAccountID, transfer.Fees, transfer.ID, "")
+	p.svc.transfers = append(p.svc.transfers, &transfer)
+	return nil
+}
+
+func (p *Projector) withdraw(withdrawal types.Withdrawal) error {
+	if _, err := p.svc.FindWithdrawalByID(withdrawal.ID); err == nil {
+		return errors.New("withdrawal already created")
+	}
+	account, err := p.svc.FindAccountByID(withdrawal.AccountID)
+	if err != nil {
+		return err
+	}
+	p.svc.applyWithdrawal(account, &withdrawal)
+	return nil
+}
+
+// chargeFees списывает комиссии операции; счёт уже проверен вызывающим
+func (p *Projector) chargeFees(accountID int64, fees []types.FeeLine, referenceID string, category types.PaymentCategory) {
+	if account, err := p.svc.FindAccountByID(accountID); err == nil {
+		p.svc.chargeFees(account, fees, referenceID, category)
+	}
+}
+
+func (p *Projector) changeTier(change types.TierChange) error {
+	account, err := p.svc.FindAccountByID(change.AccountID)
+	if err != nil {
+		return err
+	}
+	account.Tier = change.To
+	p.svc.tierChanges = append(p.svc.tierChanges, &change)
+	return nil
+}
+
+func (p *Projector) registerCategory(category types.Category) error {
+	if _, err := p.svc.FindCategoryByID(category.ID); err == nil {
+		return ErrCategoryExists
+	}
+	p.svc.categories = append(p.svc.categories, &category)
+	return nil
+}
+
+func (p *Projector) changeCategory(category types.Category) error {
+	existing, err := p.svc.FindCategoryByID(category.ID)
+	if err != nil {
+		return err
+	}
+	*existing = category
+	return nil
+}
+
+func (p *Projector) registerMerchant(merchant types.Merchant) error {
+	if _, err := p.svc.FindMerchantByID(merchant.ID); err == nil {
+		return errors.New("merchant already registered")
+	}
+	if _, err := p.svc.FindAccountByID(merchant.SettlementAccountID); err != nil {
+		return err
+	}
+	merchant.Balance = 0
+	p.svc.merchants = append(p.svc.merchants, &merchant)
+	return nil
+}
+
+func (p *Projector) settle(settlement types.Settlement) error {
+	merchant, err := p.svc.FindMerchantByID(settlement.MerchantID)
+	if err != nil {
+		return err
+	}
+	account, err := p.svc.FindAccountByID(settlement.AccountID)
+	if err != nil {
+		return err
+	}
+	settlement.Gross, settlement.Rejected, settlement.Amount = 0, 0, 0
+	p.svc.applySettlement(merchant, account, &settlement)
+	return nil
+}
+
+// Rebuild восстанавливает сервис по упорядоченному потоку событий
+func Rebuild(events []Event) (*Service, error) {
+	return RebuildAt(events, time.Time{})
+}
+
+// RebuildAt восстанавливает состояние на момент at: применяются события не позже at,
+// нулевое at - все события
+func RebuildAt(events []Event, at time.Time) (*Service, error) {
+	projector := NewProjector()
+	for _, event := range events {
+		if !at.IsZero() && event.Header().Time.After(at) {
+			break
+		}
+		if err := projector.Apply(event); err != nil {
+			return nil, err
+		}
+	}
+	return projector.Service(), nil
+}
+
+// BalanceAt возвращает баланс аккаунта на момент at
+func BalanceAt(events []Event, accountID int64, at time.Time) (types.Money, error) {
+	svc, err := RebuildAt(events, at)
+	if err != nil {
+		return 0, err
+	}
+	account, err := svc.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// WriteEvents записывает события в w в формате JSON, по одному на строку
+func WriteEvents(w io.Writer, events []Event) error {
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEvents читает события, записанные WriteEvents
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		event, err := decodeEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func decodeEvent(data []byte) (Event, error) {
+	var header EventHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	var event Event
+	var err error
+	switch header.Type {
+	case EventAccountRegistered:
+		var v AccountRegistered
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventDeposited:
+		var v Deposited
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventPaymentCreated:
+		var v PaymentCreated
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventPaymentRejected:
+		var v PaymentRejected
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventFavoriteCreated:
+		var v FavoriteCreated
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventTransferCreated:
+		var v TransferCreated
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventTierChanged:
+		var v TierChanged
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventFavoriteUpdated:
+		var v FavoriteUpdated
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventFavoriteDeleted:
+		var v FavoriteDeleted
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventFavoriteMoved:
+		var v FavoriteMoved
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventCategoryRegistered:
+		var v CategoryRegistered
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventCategoryChanged:
+		var v CategoryChanged
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventMerchantRegistered:
+		var v MerchantRegistered
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventMerchantSettled:
+		var v MerchantSettled
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventWithdrawn:
+		var v Withdrawn
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventPaymentConfirmed:
+		var v PaymentConfirmed
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventBudgetSet:
+		var v BudgetSet
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventBudgetDeleted:
+		var v BudgetDeleted
+		err = json.Unmarshal(data, &v)
+		event = v
+	case EventBudgetThresholdReached:
+		var v BudgetThresholdReached
+		err = json.Unmarshal(data, &v)
+		event = v
+	default:
+		return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidEventStream, header.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,163 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// recordedService сервис, все события которого сохраняются в store; время задаётся через *now
+func recordedService(now *time.Time) (*Service, *EventStore) {
+	svc := &Service{}
+	svc.SetClock(func() time.Time {
+		return *now
+	})
+	bus := NewEventBus()
+	svc.SetEventBus(bus)
+	store := &EventStore{}
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	return svc, store
+}
+
+func TestRebuild_matchesService(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	svc, store := recordedService(&now)
+
+	first, _ := svc.RegisterAccount("+992000000001")
+	second, _ := svc.RegisterAccount("+992000000002")
+	if _, err := svc.SetAccountTier(first.ID, types.TierFull, "passport"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(first.ID, 500_00); err != nil {
+		t.Fatal(err)
+	}
+	now = now.AddDate(0, 0, 1)
+	payment, err := svc.Pay(first.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite, err := svc.FavoritePayment(payment.ID, "fuel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.AddDate(0, 0, 1)
+	if _, err := svc.PayFromFavorite(favorite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Transfer(first.ID, second.ID, 50_00); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rebuilt.Accounts(), svc.Accounts()) {
+		t.Errorf("accounts = %v, want %v", rebuilt.Accounts(), svc.Accounts())
+	}
+	if !reflect.DeepEqual(rebuilt.Favorites(), svc.Favorites()) {
+		t.Errorf("favorites = %v, want %v", rebuilt.Favorites(), svc.Favorites())
+	}
+	for _, want := range svc.payments {
+		got, err := rebuilt.FindPaymentByID(want.ID)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("payment = %v, want %v", got, want)
+		}
+	}
+	if !reflect.DeepEqual(rebuilt.TierChanges(first.ID), svc.TierChanges(first.ID)) {
+		t.Errorf("tier changes = %v, want %v", rebuilt.TierChanges(first.ID), svc.TierChanges(first.ID))
+	}
+	gotEntries, _ := rebuilt.AccountEntries(first.ID)
+	wantEntries, _ := svc.AccountEntries(first.ID)
+	if len(gotEntries) != len(wantEntries) {
+		t.Fatalf("got %d entries, want %d", len(gotEntries), len(wantEntries))
+	}
+	for i := range wantEntries {
+		if gotEntries[i].Amount != wantEntries[i].Amount || !gotEntries[i].Created.Equal(wantEntries[i].Created) {
+			t.Errorf("entry %d = %+v, want %+v", i, gotEntries[i], wantEntries[i])
+		}
+	}
+
+	// восстановленный сервис продолжает нумерацию аккаунтов
+	third, err := rebuilt.RegisterAccount("+992000000003")
+	if err != nil || third.ID != second.ID+1 {
+		t.Errorf("RegisterAccount on rebuilt service = %v, %v", third, err)
+	}
+}
+
+func TestBalanceAt(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	svc, store := recordedService(&now)
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 500_00)
+	now = time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)
+	payment, _ := svc.Pay(account.ID, 100_00, "auto")
+	now = time.Date(2021, 3, 10, 10, 0, 0, 0, time.UTC)
+	svc.Reject(payment.ID)
+
+	tests := []struct {
+		at   time.Time
+		want types.Money
+	}{
+		{time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC), 500_00},
+		{time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC), 400_00},
+		{time.Date(2021, 3, 9, 0, 0, 0, 0, time.UTC), 400_00},
+		{time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), 500_00},
+	}
+	for _, tt := range tests {
+		got, err := BalanceAt(store.Events(), account.ID, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("BalanceAt(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	if _, err := BalanceAt(store.Events(), account.ID, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)); err != ErrAccountNotFound {
+		t.Errorf("BalanceAt before registration error = %v, want %v", err, ErrAccountNotFound)
+	}
+}
+
+func TestWriteEvents_roundTrip(t *testing.T) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	svc, store := recordedService(&now)
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 500_00)
+	payment, _ := svc.Pay(account.ID, 100_00, "auto")
+	svc.FavoritePayment(payment.ID, "fuel")
+
+	var buf bytes.Buffer
+	if err := WriteEvents(&buf, store.Events()); err != nil {
+		t.Fatal(err)
+	}
+	events, err := ReadEvents(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events, store.Events()) {
+		t.Errorf("events after round trip = %v, want %v", events, store.Events())
+	}
+}
+
+func TestRebuild_invalidStream(t *testing.T) {
+	header := EventHeader{Type: EventPaymentCreated, AccountID: 1, Sequence: 1}
+	_, err := Rebuild([]Event{PaymentCreated{EventHeader: header, Payment: types.Payment{ID: "p", AccountID: 1, Amount: 1}}})
+	if !errors.Is(err, ErrInvalidEventStream) {
+		t.Errorf("payment without account error = %v, want %v", err, ErrInvalidEventStream)
+	}
+
+	registered := AccountRegistered{EventHeader: EventHeader{Type: EventAccountRegistered, AccountID: 1, Sequence: 2}, Account: types.Account{ID: 1}}
+	deposited := Deposited{EventHeader: EventHeader{Type: EventDeposited, AccountID: 1, Sequence: 1}, Amount: 1}
+	if _, err := Rebuild([]Event{registered, deposited}); !errors.Is(err, ErrInvalidEventStream) {
+		t.Errorf("out of order error = %v, want %v", err, ErrInvalidEventStream)
+	}
+}
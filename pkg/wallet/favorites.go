@@ -0,0 +1,269 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки избранного
+var ErrFavoriteNameTaken = errors.New("favorite name already used by the account")
+var ErrInvalidFavoriteName = errors.New("favorite name must not contain ';' or line breaks")
+var ErrInvalidFavoritePosition = errors.New("favorite position out of range")
+var ErrFavoriteAmountFixed = errors.New("favorite amount is fixed")
+
+// FavoriteUpdate изменения избранного платежа, nil - поле не меняется
+type FavoriteUpdate struct {
+	Name           *string
+	Amount         *types.Money
+	Category       *types.PaymentCategory
+	VariableAmount *bool
+}
+
+// CreateFavorite создаёт избранный платёж без исходного платежа.
+// Для шаблона с переменной суммой amount - сумма по умолчанию и может быть 0
+func (s *Service) CreateFavorite(accountID int64, name string, amount types.Money, category types.PaymentCategory, variableAmount bool) (*types.Favorite, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	if err := checkFavoriteAmount(amount, variableAmount); err != nil {
+		return nil, err
+	}
+	if err := s.checkFavoriteName(accountID, name, ""); err != nil {
+		return nil, err
+	}
+	category, err := s.checkCategory(category)
+	if err != nil {
+		return nil, err
+	}
+
+	favorite := &types.Favorite{
+		ID:             uuid.New().String(),
+		AccountID:      accountID,
+		Name:           name,
+		Amount:         amount,
+		Category:       category,
+		VariableAmount: variableAmount,
+	}
+	s.favorites = append(s.favorites, favorite)
+
+	after := *favorite
+	s.audit(AuditCreateFavorite, AuditState{}, AuditState{Favorite: &after},
+		accountTarget(favorite.AccountID), favoriteTarget(favorite.ID))
+	s.publish(FavoriteCreated{EventHeader: s.header(EventFavoriteCreated, favorite.AccountID), Favorite: after})
+	return favorite, nil
+}
+
+// PayFromFavoriteWithAmount платит по шаблону с переменной суммой на сумму amount
+func (s *Service) PayFromFavoriteWithAmount(favoriteID string, amount types.Money) (*types.Payment, error) {
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	if !favorite.VariableAmount {
+		return nil, ErrFavoriteAmountFixed
+	}
+	return s.payFromFavorite(favorite, amount)
+}
+
+func (s *Service) payFromFavorite(favorite *types.Favorite, amount types.Money) (*types.Payment, error) {
+	payment, err := s.pay(AuditPayFromFavorite, favorite.AccountID, amount, favorite.Category, favoriteTarget(favorite.ID))
+	if err != nil {
+		return nil, err
+	}
+	s.publishPaymentCreated(payment, "", favorite.ID)
+	return payment, nil
+}
+
+// ListFavorites возвращает избранные платежи аккаунта в пользовательском порядке
+func (s *Service) ListFavorites(accountID int64) ([]types.Favorite, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	favorites := []types.Favorite{}
+	for _, favorite := range s.favorites {
+		if favorite.AccountID == accountID {
+			favorites = append(favorites, *favorite)
+		}
+	}
+	return favorites, nil
+}
+
+// UpdateFavorite меняет название, сумму или категорию избранного платежа
+func (s *Service) UpdateFavorite(favoriteID string, update FavoriteUpdate) (*types.Favorite, error) {
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		if err := s.checkFavoriteName(favorite.AccountID, *update.Name, favorite.ID); err != nil {
+			return nil, err
+		}
+	}
+	amount, variable := favorite.Amount, favorite.VariableAmount
+	if update.Amount != nil {
+		amount = *update.Amount
+	}
+	if update.VariableAmount != nil {
+		variable = *update.VariableAmount
+	}
+	if err := checkFavoriteAmount(amount, variable); err != nil {
+		return nil, err
+	}
+	if update.Category != nil {
+		category, err := s.checkCategory(*update.Category)
+		if err != nil {
+			return nil, err
+		}
+		update.Category = &category
+	}
+
+	before := *favorite
+	if update.Name != nil {
+		favorite.Name = *update.Name
+	}
+	if update.Amount != nil {
+		favorite.Amount = *update.Amount
+	}
+	if update.Category != nil {
+		favorite.Category = *update.Category
+	}
+	favorite.VariableAmount = variable
+
+	after := *favorite
+	s.audit(AuditUpdateFavorite, AuditState{Favorite: &before}, AuditState{Favorite: &after},
+		accountTarget(favorite.AccountID), favoriteTarget(favorite.ID))
+	s.publish(FavoriteUpdated{EventHeader: s.header(EventFavoriteUpdated, favorite.AccountID), Favorite: after})
+	return favorite, nil
+}
+
+// DeleteFavorite удаляет избранный платёж и отключает его расписания
+func (s *Service) DeleteFavorite(favoriteID string) error {
+	index := s.favoriteIndex(favoriteID)
+	if index < 0 {
+		return ErrFavoriteNotFound
+	}
+	favorite := s.favorites[index]
+	s.favorites = append(s.favorites[:index], s.favorites[index+1:]...)
+	for _, schedule := range s.schedules {
+		if schedule.FavoriteID == favoriteID && schedule.Active {
+			deactivate(schedule)
+		}
+	}
+
+	before := *favorite
+	s.audit(AuditDeleteFavorite, AuditState{Favorite: &before}, AuditState{},
+		accountTarget(favorite.AccountID), favoriteTarget(favorite.ID))
+	s.publish(FavoriteDeleted{EventHeader: s.header(EventFavoriteDeleted, favorite.AccountID), FavoriteID: favorite.ID})
+	return nil
+}
+
+// MoveFavorite перемещает избранный платёж на позицию position (с 0) в списке аккаунта
+func (s *Service) MoveFavorite(favoriteID string, position int) error {
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return err
+	}
+	if err := s.moveFavorite(favorite, position); err != nil {
+		return err
+	}
+
+	s.audit(AuditMoveFavorite, AuditState{}, AuditState{Favorite: &types.Favorite{ID: favorite.ID, AccountID: favorite.AccountID}},
+		accountTarget(favorite.AccountID), favoriteTarget(favorite.ID))
+	s.publish(FavoriteMoved{EventHeader: s.header(EventFavoriteMoved, favorite.AccountID), FavoriteID: favorite.ID, Position: position})
+	return nil
+}
+
+func (s *Service) moveFavorite(favorite *types.Favorite, position int) error {
+	count := 0
+	for _, v := range s.favorites {
+		if v.AccountID == favorite.AccountID {
+			count++
+		}
+	}
+	if position < 0 || position >= count {
+		return ErrInvalidFavoritePosition
+	}
+
+	index := s.favoriteIndex(favorite.ID)
+	rest := append(s.favorites[:index:index], s.favorites[index+1:]...)
+
+	// место вставки - перед position-м избранным аккаунта, либо сразу после последнего
+	insert := len(rest)
+	seen := 0
+	for i, v := range rest {
+		if v.AccountID != favorite.AccountID {
+			continue
+		}
+		if seen == position {
+			insert = i
+			break
+		}
+		seen++
+		insert = i + 1
+	}
+
+	favorites := make([]*types.Favorite, 0, len(s.favorites))
+	favorites = append(favorites, rest[:insert]...)
+	favorites = append(favorites, favorite)
+	favorites = append(favorites, rest[insert:]...)
+	s.favorites = favorites
+	return nil
+}
+
+// checkFavoriteAmount сумма фиксированного шаблона должна быть положительной,
+// у шаблона с переменной суммой сумма по умолчанию может быть нулевой
+func checkFavoriteAmount(amount types.Money, variableAmount bool) error {
+	if amount < 0 || amount == 0 && !variableAmount {
+		return ErrAmountMustBePositive
+	}
+	return nil
+}
+
+func (s *Service) favoriteIndex(favoriteID string) int {
+	for i, favorite := range s.favorites {
+		if favorite.ID == favoriteID {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkFavoriteName проверяет, что название можно сохранить в dump и что у аккаунта
+// нет другого избранного (кроме exceptID) с таким же названием без учёта регистра
+func (s *Service) checkFavoriteName(accountID int64, name string, exceptID string) error {
+	if strings.ContainsAny(name, ";\r\n") {
+		return ErrInvalidFavoriteName
+	}
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		return nil
+	}
+	for _, favorite := range s.favorites {
+		if favorite.AccountID == accountID && favorite.ID != exceptID && strings.ToLower(strings.TrimSpace(favorite.Name)) == key {
+			return ErrFavoriteNameTaken
+		}
+	}
+	return nil
+}
+
+// exportFavorites перезаписывает favorites.dump даже пустым списком, иначе удалённое
+// последним избранное вернулось бы при импорте
+func (s *Service) exportFavorites(dir string) error {
+	rows := make([][]string, 0, len(s.favorites))
+	for _, v := range s.favorites {
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.AccountID, 10),
+			strconv.FormatInt(int64(v.Amount), 10),
+			string(v.Category),
+			v.Name,
+			strconv.FormatBool(v.VariableAmount),
+		})
+	}
+	return writeDump(filepath.Join(dir, "favorites.dump"), rows)
+}
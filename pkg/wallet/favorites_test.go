@@ -0,0 +1,343 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// favoritesService сервис с двумя аккаунтами и избранными платежами names у первого
+func favoritesService(t *testing.T, names ...string) (*Service, []*types.Favorite) {
+	t.Helper()
+	svc := &Service{}
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Deposit(account.ID, 1_000_00); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other, err := svc.Pay(2, 10_00, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FavoritePayment(other.ID, names[0]); err != nil {
+		t.Fatalf("same name for another account: %v", err)
+	}
+
+	var favorites []*types.Favorite
+	for _, name := range names {
+		payment, err := svc.Pay(1, 10_00, types.PaymentCategory(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		favorite, err := svc.FavoritePayment(payment.ID, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		favorites = append(favorites, favorite)
+	}
+	return svc, favorites
+}
+
+func favoriteNames(t *testing.T, svc *Service, accountID int64) []string {
+	t.Helper()
+	favorites, err := svc.ListFavorites(accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, favorite := range favorites {
+		names = append(names, favorite.Name)
+	}
+	return names
+}
+
+func TestService_FavoritePayment_duplicateName(t *testing.T) {
+	svc, favorites := favoritesService(t, "internet")
+	payment, err := svc.Pay(1, 5_00, "mobile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, " Internet "); err != ErrFavoriteNameTaken {
+		t.Errorf("duplicate name error = %v, want %v", err, ErrFavoriteNameTaken)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, "a;b"); err != ErrInvalidFavoriteName {
+		t.Errorf("invalid name error = %v, want %v", err, ErrInvalidFavoriteName)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, ""); err != nil {
+		t.Errorf("unnamed favorite error = %v", err)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, ""); err != nil {
+		t.Errorf("second unnamed favorite error = %v", err)
+	}
+	if favorites[0].Name != "internet" {
+		t.Errorf("favorite was changed: %+v", favorites[0])
+	}
+}
+
+func TestService_UpdateFavorite(t *testing.T) {
+	svc, favorites := favoritesService(t, "internet", "mobile")
+
+	name := "home internet"
+	amount := types.Money(25_00)
+	category := types.PaymentCategory("isp")
+	favorite, err := svc.UpdateFavorite(favorites[0].ID, FavoriteUpdate{Name: &name, Amount: &amount, Category: &category})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.Favorite{ID: favorites[0].ID, AccountID: 1, Name: name, Amount: amount, Category: category}
+	if *favorite != want {
+		t.Errorf("updated favorite = %+v, want %+v", *favorite, want)
+	}
+
+	taken := "MOBILE"
+	if _, err := svc.UpdateFavorite(favorites[0].ID, FavoriteUpdate{Name: &taken}); err != ErrFavoriteNameTaken {
+		t.Errorf("taken name error = %v, want %v", err, ErrFavoriteNameTaken)
+	}
+	same := "Home Internet"
+	if _, err := svc.UpdateFavorite(favorites[0].ID, FavoriteUpdate{Name: &same}); err != nil {
+		t.Errorf("renaming to own name in another case error = %v", err)
+	}
+	zero := types.Money(0)
+	if _, err := svc.UpdateFavorite(favorites[0].ID, FavoriteUpdate{Amount: &zero}); err != ErrAmountMustBePositive {
+		t.Errorf("zero amount error = %v, want %v", err, ErrAmountMustBePositive)
+	}
+	if _, err := svc.UpdateFavorite("missing", FavoriteUpdate{}); err != ErrFavoriteNotFound {
+		t.Errorf("missing favorite error = %v, want %v", err, ErrFavoriteNotFound)
+	}
+
+	payment, err := svc.PayFromFavorite(favorites[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Amount != amount || payment.Category != category {
+		t.Errorf("payment from updated favorite = %+v", payment)
+	}
+}
+
+func TestService_MoveAndDeleteFavorite(t *testing.T) {
+	svc, favorites := favoritesService(t, "a", "b", "c", "d")
+
+	if err := svc.MoveFavorite(favorites[3].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := favoriteNames(t, svc, 1), []string{"d", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after move to start = %v, want %v", got, want)
+	}
+	if err := svc.MoveFavorite(favorites[0].ID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := favoriteNames(t, svc, 1), []string{"d", "b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after move to end = %v, want %v", got, want)
+	}
+	if err := svc.MoveFavorite(favorites[2].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := favoriteNames(t, svc, 1), []string{"d", "c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after move to middle = %v, want %v", got, want)
+	}
+	if err := svc.MoveFavorite(favorites[2].ID, 4); err != ErrInvalidFavoritePosition {
+		t.Errorf("out of range error = %v, want %v", err, ErrInvalidFavoritePosition)
+	}
+	if got := favoriteNames(t, svc, 2); len(got) != 1 {
+		t.Errorf("favorites of another account = %v", got)
+	}
+
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	schedule, err := svc.ScheduleFavorite(favorites[1].ID, types.ScheduleDaily, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteFavorite(favorites[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := favoriteNames(t, svc, 1), []string{"d", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after delete = %v, want %v", got, want)
+	}
+	if schedule.Active {
+		t.Errorf("schedule of deleted favorite is active")
+	}
+	if err := svc.DeleteFavorite(favorites[1].ID); err != ErrFavoriteNotFound {
+		t.Errorf("second delete error = %v, want %v", err, ErrFavoriteNotFound)
+	}
+	if _, err := svc.ListFavorites(42); err != ErrAccountNotFound {
+		t.Errorf("ListFavorites of missing account error = %v, want %v", err, ErrAccountNotFound)
+	}
+}
+
+func TestService_Favorites_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	var favorites []*types.Favorite
+	for _, name := range []string{"a", "b", "c"} {
+		payment, _ := svc.Pay(account.ID, 10_00, "auto")
+		favorite, err := svc.FavoritePayment(payment.ID, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		favorites = append(favorites, favorite)
+	}
+
+	name := "renamed"
+	if _, err := svc.UpdateFavorite(favorites[1].ID, FavoriteUpdate{Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.MoveFavorite(favorites[2].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteFavorite(favorites[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"c", "renamed"}
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := favoriteNames(t, restored, account.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported favorites = %v, want %v", got, want)
+	}
+
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := favoriteNames(t, rebuilt, account.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("rebuilt favorites = %v, want %v", got, want)
+	}
+}
+
+func TestService_Favorites_exportAfterDeletingLast(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+	payment, _ := svc.Pay(account.ID, 10_00, "auto")
+	favorite, _ := svc.FavoritePayment(payment.ID, "auto")
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteFavorite(favorite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.FindFavoriteByID(favorite.ID); err != ErrFavoriteNotFound {
+		t.Errorf("error = %v, want %v", err, ErrFavoriteNotFound)
+	}
+}
+
+func TestService_CreateFavorite(t *testing.T) {
+	svc, _ := favoritesService(t, "rent")
+
+	tests := []struct {
+		name     string
+		account  int64
+		favorite string
+		amount   types.Money
+		variable bool
+		want     error
+	}{
+		{"fixed", 1, "phone", 5_00, false, nil},
+		{"variable without default", 1, "electricity", 0, true, nil},
+		{"fixed without amount", 1, "water", 0, false, ErrAmountMustBePositive},
+		{"negative default", 1, "gas", -1, true, ErrAmountMustBePositive},
+		{"duplicate name", 1, "Rent", 5_00, false, ErrFavoriteNameTaken},
+		{"unknown account", 42, "tv", 5_00, false, ErrAccountNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			favorite, err := svc.CreateFavorite(test.account, test.favorite, test.amount, "utilities", test.variable)
+			if err != test.want {
+				t.Fatalf("error = %v, want %v", err, test.want)
+			}
+			if err == nil && (favorite.Amount != test.amount || favorite.VariableAmount != test.variable) {
+				t.Errorf("favorite = %+v", favorite)
+			}
+		})
+	}
+}
+
+func TestService_PayFromFavoriteWithAmount(t *testing.T) {
+	svc, favorites := favoritesService(t, "rent")
+	variable, err := svc.CreateFavorite(1, "electricity", 0, "utilities", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.PayFromFavoriteWithAmount(favorites[0].ID, 1_00); err != ErrFavoriteAmountFixed {
+		t.Errorf("override fixed: error = %v, want %v", err, ErrFavoriteAmountFixed)
+	}
+	if _, err := svc.PayFromFavorite(variable.ID); err != ErrAmountMustBePositive {
+		t.Errorf("pay without default: error = %v, want %v", err, ErrAmountMustBePositive)
+	}
+
+	payment, err := svc.PayFromFavoriteWithAmount(variable.ID, 42_00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Amount != 42_00 || payment.Category != "utilities" {
+		t.Errorf("payment = %+v", payment)
+	}
+
+	fixed := false
+	if _, err := svc.UpdateFavorite(variable.ID, FavoriteUpdate{VariableAmount: &fixed}); err != ErrAmountMustBePositive {
+		t.Errorf("fix without amount: error = %v, want %v", err, ErrAmountMustBePositive)
+	}
+}
+
+func TestService_CreateFavorite_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	favorite, err := svc.CreateFavorite(account.ID, "internet", 15_00, "utilities", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Favorite{*favorite}
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := restored.ListFavorites(account.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported favorites = %+v, want %+v", got, want)
+	}
+
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rebuilt.ListFavorites(account.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("rebuilt favorites = %+v, want %+v", got, want)
+	}
+}
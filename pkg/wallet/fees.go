@@ -0,0 +1,321 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrInvalidFeeRule возвращается SetFeeSchedule для некорректного правила
+var ErrInvalidFeeRule = errors.New("invalid fee rule")
+
+// basisPointsDivisor 10000 базисных пунктов = 100%
+const basisPointsDivisor = 10_000
+
+// SetFeeSchedule задаёт правила комиссий. К операции применяются все подходящие правила,
+// каждое даёт отдельную строку комиссии. Пустое Name заменяется на операцию и категорию
+func (s *Service) SetFeeSchedule(rules []types.FeeRule) error {
+	schedule := make([]types.FeeRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := checkFeeRule(rule); err != nil {
+			return err
+		}
+		if rule.Name == "" {
+			rule.Name = string(rule.Operation)
+			if rule.Category != "" {
+				rule.Name += ":" + string(rule.Category)
+			}
+		}
+		rule.Tiers = append([]types.FeeTier(nil), rule.Tiers...)
+		schedule = append(schedule, rule)
+	}
+
+	before := AuditState{Fees: s.FeeSchedule()}
+	s.feeSchedule = schedule
+	s.audit(AuditSetFeeSchedule, before, AuditState{Fees: s.FeeSchedule()})
+	return nil
+}
+
+// FeeSchedule возвращает действующие правила комиссий
+func (s *Service) FeeSchedule() []types.FeeRule {
+	return append([]types.FeeRule{}, s.feeSchedule...)
+}
+
+// QuoteFees рассчитывает комиссии операции на сумму amount, не списывая их
+func (s *Service) QuoteFees(operation types.FeeOperation, amount types.Money, category types.PaymentCategory) (types.Money, []types.FeeLine) {
+	lines := s.fees(operation, amount, category)
+	return totalFees(lines), lines
+}
+
+func checkFeeRule(rule types.FeeRule) error {
+	switch rule.Operation {
+	case types.FeePayment:
+	case types.FeeTransfer, types.FeeWithdrawal:
+		if rule.Category != "" {
+			return ErrInvalidFeeRule
+		}
+	default:
+		return ErrInvalidFeeRule
+	}
+	if strings.ContainsAny(rule.Name, ";\r\n") {
+		return ErrInvalidFeeRule
+	}
+	if rule.Flat < 0 || rule.Min < 0 || rule.Max < 0 || rule.Max > 0 && rule.Max < rule.Min {
+		return ErrInvalidFeeRule
+	}
+	if rule.BasisPoints < 0 || rule.BasisPoints > basisPointsDivisor {
+		return ErrInvalidFeeRule
+	}
+	for i, tier := range rule.Tiers {
+		if tier.From < 0 || tier.Flat < 0 || tier.BasisPoints < 0 || tier.BasisPoints > basisPointsDivisor {
+			return ErrInvalidFeeRule
+		}
+		if i > 0 && tier.From <= rule.Tiers[i-1].From {
+			return ErrInvalidFeeRule
+		}
+	}
+	return nil
+}
+
+// fees строки комиссий операции; nil, если ни одно правило не дало комиссии
+func (s *Service) fees(operation types.FeeOperation, amount types.Money, category types.PaymentCategory) []types.FeeLine {
+	var lines []types.FeeLine
+	for _, rule := range s.feeSchedule {
+		if rule.Operation != operation {
+			continue
+		}
+		if rule.Category != "" && s.categoryKey(rule.Category) != s.categoryKey(category) {
+			continue
+		}
+		if fee := feeByRule(rule, amount); fee > 0 {
+			lines = append(lines, types.FeeLine{Rule: rule.Name, Amount: fee})
+		}
+	}
+	return lines
+}
+
+func feeByRule(rule types.FeeRule, amount types.Money) types.Money {
+	flat, basisPoints := rule.Flat, rule.BasisPoints
+	for _, tier := range rule.Tiers {
+		if amount >= tier.From {
+			flat, basisPoints = tier.Flat, tier.BasisPoints
+		}
+	}
+
+	// процент округляется до ближайшей дирамы, половина - вверх
+	fee := flat + (amount*types.Money(basisPoints)+basisPointsDivisor/2)/basisPointsDivisor
+	if fee < rule.Min {
+		fee = rule.Min
+	}
+	if rule.Max > 0 && fee > rule.Max {
+		fee = rule.Max
+	}
+	return fee
+}
+
+func totalFees(lines []types.FeeLine) types.Money {
+	total := types.Money(0)
+	for _, line := range lines {
+		total += line.Amount - line.Refunded
+	}
+	return total
+}
+
+// refundFees возвращает часть каждой строки комиссий, пропорциональную доле refunded
+// от суммы операции amount (с округлением вниз); при полном возврате строки
+// возвращаются целиком. Результат - общая сумма возврата
+func refundFees(lines []types.FeeLine, refunded types.Money, amount types.Money) types.Money {
+	if amount <= 0 || refunded <= 0 {
+		return 0
+	}
+	if refunded > amount {
+		refunded = amount
+	}
+
+	total := types.Money(0)
+	for i := range lines {
+		line := &lines[i]
+		remaining := line.Amount - line.Refunded
+		refund := line.Amount * refunded / amount
+		if refunded == amount || refund > remaining {
+			refund = remaining
+		}
+		line.Refunded += refund
+		total += refund
+	}
+	return total
+}
+
+// refundPaymentFees возвращает комиссии отменённого платежа
+func (s *Service) refundPaymentFees(account *types.Account, payment *types.Payment) {
+	if len(payment.Fees) == 0 {
+		return
+	}
+	// строки уже могли попасть в события и аудит, поэтому меняется копия
+	payment.Fees = cloneFees(payment.Fees)
+	if refund := refundFees(payment.Fees, payment.Amount, payment.Amount); refund > 0 {
+		account.Balance += refund
+		s.record(account.ID, types.EntryFeeRefund, refund, payment.ID, payment.Category)
+	}
+}
+
+// exportFeeSchedule сохраняет правила комиссий в fee_schedule.dump, ступени
+// правила записываются как from:flat:basisPoints через ","
+func (s *Service) exportFeeSchedule(dir string) error {
+	rows := make([][]string, 0, len(s.feeSchedule))
+	for _, rule := range s.feeSchedule {
+		tiers := make([]string, 0, len(rule.Tiers))
+		for _, tier := range rule.Tiers {
+			tiers = append(tiers, strconv.FormatInt(int64(tier.From), 10)+":"+
+				strconv.FormatInt(int64(tier.Flat), 10)+":"+
+				strconv.FormatInt(tier.BasisPoints, 10))
+		}
+		rows = append(rows, []string{
+			encodeField(rule.Name),
+			string(rule.Operation),
+			encodeField(string(rule.Category)),
+			strconv.FormatInt(int64(rule.Flat), 10),
+			strconv.FormatInt(rule.BasisPoints, 10),
+			strings.Join(tiers, ","),
+			strconv.FormatInt(int64(rule.Min), 10),
+			strconv.FormatInt(int64(rule.Max), 10),
+		})
+	}
+	return writeDump(filepath.Join(dir, "fee_schedule.dump"), rows)
+}
+
+// importFeeSchedule заменяет правила комиссий правилами из fee_schedule.dump, если они там есть
+func (s *Service) importFeeSchedule(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "fee_schedule.dump"))
+	if err != nil {
+		return err
+	}
+	if rows == nil {
+		return nil
+	}
+
+	schedule := make([]types.FeeRule, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 8 {
+			return ErrInvalidDump
+		}
+		name, err := decodeField(row[0])
+		if err != nil {
+			return err
+		}
+		category, err := decodeField(row[2])
+		if err != nil {
+			return err
+		}
+		var amounts [4]int64
+		for i, field := range []string{row[3], row[4], row[6], row[7]} {
+			amounts[i], err = strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+		rule := types.FeeRule{
+			Name:        name,
+			Operation:   types.FeeOperation(row[1]),
+			Category:    types.PaymentCategory(category),
+			Flat:        types.Money(amounts[0]),
+			BasisPoints: amounts[1],
+			Min:         types.Money(amounts[2]),
+			Max:         types.Money(amounts[3]),
+		}
+		if row[5] != "" {
+			for _, field := range strings.Split(row[5], ",") {
+				parts := strings.Split(field, ":")
+				if len(parts) != 3 {
+					return ErrInvalidDump
+				}
+				var values [3]int64
+				for i, part := range parts {
+					values[i], err = strconv.ParseInt(part, 10, 64)
+					if err != nil {
+						return err
+					}
+				}
+				rule.Tiers = append(rule.Tiers, types.FeeTier{From: types.Money(values[0]), Flat: types.Money(values[1]), BasisPoints: values[2]})
+			}
+		}
+		if err := checkFeeRule(rule); err != nil {
+			return err
+		}
+		schedule = append(schedule, rule)
+	}
+	s.feeSchedule = schedule
+	return nil
+}
+
+// exportFees сохраняет строки комиссий платежей, переводов и выводов
+func (s *Service) exportFees(dir string) error {
+	var rows [][]string
+	add := func(referenceID string, lines []types.FeeLine) {
+		for _, line := range lines {
+			rows = append(rows, []string{
+				referenceID,
+				line.Rule,
+				strconv.FormatInt(int64(line.Amount), 10),
+				strconv.FormatInt(int64(line.Refunded), 10),
+			})
+		}
+	}
+	for _, v := range s.payments {
+		add(v.ID, v.Fees)
+	}
+	for _, v := range s.transfers {
+		add(v.ID, v.Fees)
+	}
+	for _, v := range s.withdrawals {
+		add(v.ID, v.Fees)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return writeDump(filepath.Join(dir, "fees.dump"), rows)
+}
+
+// importFees заменяет строки комиссий операций, упомянутых в fees.dump
+func (s *Service) importFees(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "fees.dump"))
+	if err != nil {
+		return err
+	}
+
+	lines := make(map[string][]types.FeeLine)
+	for _, row := range rows {
+		if len(row) < 4 {
+			return ErrInvalidDump
+		}
+		amount, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		refunded, err := strconv.ParseInt(row[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		lines[row[0]] = append(lines[row[0]], types.FeeLine{Rule: row[1], Amount: types.Money(amount), Refunded: types.Money(refunded)})
+	}
+
+	for _, v := range s.payments {
+		if fees, ok := lines[v.ID]; ok {
+			v.Fees = fees
+		}
+	}
+	for _, v := range s.transfers {
+		if fees, ok := lines[v.ID]; ok {
+			v.Fees = fees
+		}
+	}
+	for _, v := range s.withdrawals {
+		if fees, ok := lines[v.ID]; ok {
+			v.Fees = fees
+		}
+	}
+	return nil
+}
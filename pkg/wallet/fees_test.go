@@ -0,0 +1,255 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// testFeeSchedule платежи - 1% не меньше 1 сомони, кафе - ещё 50 дирам,
+// переводы - 1 сомони до 100 и 0.5% от 100, вывод - 2% не больше 5 сомони
+var testFeeSchedule = []types.FeeRule{
+	{Operation: types.FeePayment, BasisPoints: 100, Min: 1_00},
+	{Operation: types.FeePayment, Category: "cafe", Flat: 50},
+	{Operation: types.FeeTransfer, Tiers: []types.FeeTier{{From: 0, Flat: 1_00}, {From: 100_00, BasisPoints: 50}}},
+	{Operation: types.FeeWithdrawal, BasisPoints: 200, Max: 5_00},
+}
+
+// feeService сервис с двумя аккаунтами по 1000 сомони и расписанием testFeeSchedule
+func feeService(t *testing.T) *Service {
+	t.Helper()
+	svc := &Service{}
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, _ := svc.RegisterAccount(phone)
+		if err := svc.Deposit(account.ID, 1_000_00); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := svc.SetFeeSchedule(testFeeSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestFeeByRule(t *testing.T) {
+	tiered := types.FeeRule{Tiers: []types.FeeTier{{From: 0, Flat: 1_00}, {From: 100_00, BasisPoints: 50}, {From: 1_000_00, Flat: 2_00, BasisPoints: 10}}}
+	tests := []struct {
+		name   string
+		rule   types.FeeRule
+		amount types.Money
+		want   types.Money
+	}{
+		{"flat", types.FeeRule{Flat: 1_50}, 10_00, 1_50},
+		{"percentage", types.FeeRule{BasisPoints: 150}, 10_00, 15},
+		{"percentage rounds half up", types.FeeRule{BasisPoints: 50}, 1_01, 1},
+		{"flat and percentage", types.FeeRule{Flat: 1_00, BasisPoints: 100}, 50_00, 1_50},
+		{"min", types.FeeRule{BasisPoints: 100, Min: 1_00}, 10_00, 1_00},
+		{"max", types.FeeRule{BasisPoints: 200, Max: 5_00}, 1_000_00, 5_00},
+		{"first tier", tiered, 99_99, 1_00},
+		{"middle tier", tiered, 200_00, 1_00},
+		{"last tier", tiered, 2_000_00, 4_00},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := feeByRule(test.rule, test.amount); got != test.want {
+				t.Errorf("fee = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestService_SetFeeSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule types.FeeRule
+		want error
+	}{
+		{"valid", types.FeeRule{Operation: types.FeePayment, Category: "cafe", Flat: 1_00}, nil},
+		{"unknown operation", types.FeeRule{Operation: "REFUND", Flat: 1_00}, ErrInvalidFeeRule},
+		{"category on transfer", types.FeeRule{Operation: types.FeeTransfer, Category: "cafe"}, ErrInvalidFeeRule},
+		{"negative flat", types.FeeRule{Operation: types.FeePayment, Flat: -1}, ErrInvalidFeeRule},
+		{"over 100 percent", types.FeeRule{Operation: types.FeePayment, BasisPoints: 10_001}, ErrInvalidFeeRule},
+		{"max below min", types.FeeRule{Operation: types.FeePayment, Min: 2_00, Max: 1_00}, ErrInvalidFeeRule},
+		{"unordered tiers", types.FeeRule{Operation: types.FeePayment, Tiers: []types.FeeTier{{From: 10_00}, {From: 10_00}}}, ErrInvalidFeeRule},
+		{"separator in name", types.FeeRule{Name: "a;b", Operation: types.FeePayment}, ErrInvalidFeeRule},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &Service{}
+			if err := svc.SetFeeSchedule([]types.FeeRule{test.rule}); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestService_SetFeeSchedule_audit(t *testing.T) {
+	svc := &Service{}
+	operator := Actor{ID: "aziz", Role: "operator"}
+	if err := svc.As(operator).SetFeeSchedule(testFeeSchedule); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetFeeSchedule([]types.FeeRule{{Operation: types.FeePayment, Flat: -1}}); err != ErrInvalidFeeRule {
+		t.Fatalf("error = %v, want %v", err, ErrInvalidFeeRule)
+	}
+	if err := svc.SetFeeSchedule(testFeeSchedule[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	records := svc.AuditLog(AuditQuery{Action: AuditSetFeeSchedule})
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].Actor != operator || len(records[0].Before.Fees) != 0 || len(records[0].After.Fees) != len(testFeeSchedule) {
+		t.Errorf("first record = %+v", records[0])
+	}
+	if len(records[1].Before.Fees) != len(testFeeSchedule) || !reflect.DeepEqual(records[1].After.Fees, svc.FeeSchedule()) {
+		t.Errorf("second record = %+v", records[1])
+	}
+}
+
+func TestService_Pay_fees(t *testing.T) {
+	svc := feeService(t)
+
+	payment, err := svc.Pay(1, 200_00, "cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.FeeLine{{Rule: "PAYMENT", Amount: 2_00}, {Rule: "PAYMENT:cafe", Amount: 50}}
+	if !reflect.DeepEqual(payment.Fees, want) {
+		t.Errorf("fees = %+v, want %+v", payment.Fees, want)
+	}
+	account, _ := svc.FindAccountByID(1)
+	if account.Balance != 797_50 {
+		t.Errorf("balance = %v, want %v", account.Balance, 797_50)
+	}
+
+	// 790 + 7.90 комиссии больше остатка, хотя сама сумма в него помещается
+	if _, err := svc.Pay(1, 790_00, "shop"); err != ErrNotEnoughtBalance {
+		t.Errorf("error = %v, want %v", err, ErrNotEnoughtBalance)
+	}
+	if _, err := svc.Pay(1, 789_60, "shop"); err != nil {
+		t.Errorf("error = %v, want nil", err)
+	}
+
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	payment, _ = svc.FindPaymentByID(payment.ID)
+	for _, line := range payment.Fees {
+		if line.Refunded != line.Amount {
+			t.Errorf("fee line not refunded: %+v", line)
+		}
+	}
+	if account.Balance != 200_00+2_50 {
+		t.Errorf("balance after reject = %v, want %v", account.Balance, 200_00+2_50)
+	}
+}
+
+func TestRefundFees(t *testing.T) {
+	lines := []types.FeeLine{{Rule: "a", Amount: 3_00}, {Rule: "b", Amount: 1}}
+	if got := refundFees(lines, 50_00, 100_00); got != 1_50 {
+		t.Errorf("refund = %v, want %v", got, 1_50)
+	}
+	if got := refundFees(lines, 100_00, 100_00); got != 1_51 {
+		t.Errorf("refund = %v, want %v", got, 1_51)
+	}
+	if got := totalFees(lines); got != 0 {
+		t.Errorf("remaining = %v, want 0", got)
+	}
+}
+
+func TestService_TransferAndWithdraw_fees(t *testing.T) {
+	svc := feeService(t)
+
+	transfer, err := svc.Transfer(1, 2, 200_00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := totalFees(transfer.Fees); got != 1_00 {
+		t.Errorf("transfer fee = %v, want %v", got, 1_00)
+	}
+	withdrawal, err := svc.Withdraw(1, 500_00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := totalFees(withdrawal.Fees); got != 5_00 {
+		t.Errorf("withdrawal fee = %v, want %v", got, 5_00)
+	}
+	account, _ := svc.FindAccountByID(1)
+	if account.Balance != 294_00 {
+		t.Errorf("balance = %v, want %v", account.Balance, 294_00)
+	}
+	if _, err := svc.Withdraw(1, 290_00); err != ErrNotEnoughtBalance {
+		t.Errorf("error = %v, want %v", err, ErrNotEnoughtBalance)
+	}
+	if _, err := svc.Transfer(1, 2, 294_00); err != ErrNotEnoughtBalance {
+		t.Errorf("error = %v, want %v", err, ErrNotEnoughtBalance)
+	}
+}
+
+func TestService_Fees_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+	if err := svc.SetFeeSchedule(testFeeSchedule); err != nil {
+		t.Fatal(err)
+	}
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, _ := svc.RegisterAccount(phone)
+		svc.Deposit(account.ID, 1_000_00)
+	}
+
+	payment, _ := svc.Pay(1, 200_00, "cafe")
+	svc.Pay(1, 10_00, "shop")
+	svc.Reject(payment.ID)
+	transfer, _ := svc.Transfer(1, 2, 50_00)
+	withdrawal, _ := svc.Withdraw(2, 100_00)
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]*Service{"imported": restored, "rebuilt": rebuilt} {
+		for _, id := range []int64{1, 2} {
+			account, _ := got.FindAccountByID(id)
+			want, _ := svc.FindAccountByID(id)
+			if account.Balance != want.Balance {
+				t.Errorf("%s account %d balance = %v, want %v", name, id, account.Balance, want.Balance)
+			}
+		}
+		gotPayment, _ := got.FindPaymentByID(payment.ID)
+		wantPayment, _ := svc.FindPaymentByID(payment.ID)
+		if !reflect.DeepEqual(gotPayment.Fees, wantPayment.Fees) {
+			t.Errorf("%s payment fees = %+v, want %+v", name, gotPayment.Fees, wantPayment.Fees)
+		}
+		gotTransfer, _ := got.FindTransferByID(transfer.ID)
+		if !reflect.DeepEqual(gotTransfer.Fees, transfer.Fees) {
+			t.Errorf("%s transfer fees = %+v, want %+v", name, gotTransfer.Fees, transfer.Fees)
+		}
+		gotWithdrawal, err := got.FindWithdrawalByID(withdrawal.ID)
+		if err != nil || gotWithdrawal.Amount != withdrawal.Amount || !reflect.DeepEqual(gotWithdrawal.Fees, withdrawal.Fees) {
+			t.Errorf("%s withdrawal = %+v, %v, want %+v", name, gotWithdrawal, err, withdrawal)
+		}
+	}
+	if got, want := restored.FeeSchedule(), svc.FeeSchedule(); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported fee schedule = %+v, want %+v", got, want)
+	}
+	fee, _ := restored.QuoteFees(types.FeeTransfer, 200_00, "")
+	if want, _ := svc.QuoteFees(types.FeeTransfer, 200_00, ""); fee != want {
+		t.Errorf("imported transfer fee = %v, want %v", fee, want)
+	}
+}
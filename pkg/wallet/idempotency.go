@@ -0,0 +1,239 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrIdempotencyConflict возвращается, если ключ уже использован с другими параметрами
+var ErrIdempotencyConflict = errors.New("idempotency key reused with different parameters")
+
+// DefaultIdempotencyTTL время жизни ключа идемпотентности по умолчанию
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// операции, для которых поддерживаются ключи идемпотентности
+const (
+	operationPay         = "pay"
+	operationDeposit     = "deposit"
+	operationTransfer    = "transfer"
+	operationPayMerchant = "pay_merchant"
+)
+
+// idempotencyRecord запоминает результат операции, выполненной с ключом
+type idempotencyRecord struct {
+	Key       string
+	Operation string
+	Params    string
+	ResultID  string
+	Created   time.Time
+}
+
+// SetIdempotencyTTL задаёт, сколько времени хранятся ключи идемпотентности
+func (s *Service) SetIdempotencyTTL(ttl time.Duration) {
+	s.idempotencyTTL = ttl
+}
+
+func (s *Service) idempotencyWindow() time.Duration {
+	if s.idempotencyTTL > 0 {
+		return s.idempotencyTTL
+	}
+	return DefaultIdempotencyTTL
+}
+
+// PayWithKey работает как Pay, но повторный вызов с тем же ключом возвращает исходный платёж
+func (s *Service) PayWithKey(key string, accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	if key == "" {
+		return s.Pay(accountID, amount, category)
+	}
+
+	params := fmt.Sprintf("%d,%d,%s", accountID, amount, category)
+	record, err := s.lookupKey(key, operationPay, params)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		return s.FindPaymentByID(record.ResultID)
+	}
+
+	payment, err := s.Pay(accountID, amount, category)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberKey(key, operationPay, params, payment.ID)
+	return payment, nil
+}
+
+// PayMerchantWithKey работает как PayMerchant, но повторный вызов с тем же ключом возвращает исходный платёж
+func (s *Service) PayMerchantWithKey(key string, accountID int64, merchantID string, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	if key == "" {
+		return s.PayMerchant(accountID, merchantID, amount, category)
+	}
+
+	params := fmt.Sprintf("%d,%s,%d,%s", accountID, merchantID, amount, category)
+	record, err := s.lookupKey(key, operationPayMerchant, params)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		return s.FindPaymentByID(record.ResultID)
+	}
+
+	payment, err := s.PayMerchant(accountID, merchantID, amount, category)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberKey(key, operationPayMerchant, params, payment.ID)
+	return payment, nil
+}
+
+// DepositWithKey работает как Deposit, но повторный вызов с тем же ключом не пополняет счёт ещё раз
+func (s *Service) DepositWithKey(key string, accountID int64, amount types.Money) error {
+	if key == "" {
+		return s.Deposit(accountID, amount)
+	}
+
+	params := fmt.Sprintf("%d,%d", accountID, amount)
+	record, err := s.lookupKey(key, operationDeposit, params)
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return nil
+	}
+
+	err = s.Deposit(accountID, amount)
+	if err != nil {
+		return err
+	}
+	s.rememberKey(key, operationDeposit, params, "")
+	return nil
+}
+
+// TransferWithKey работает как Transfer, но повторный вызов с тем же ключом возвращает исходный перевод
+func (s *Service) TransferWithKey(key string, fromAccountID int64, toAccountID int64, amount types.Money) (*types.Transfer, error) {
+	if key == "" {
+		return s.Transfer(fromAccountID, toAccountID, amount)
+	}
+
+	params := fmt.Sprintf("%d,%d,%d", fromAccountID, toAccountID, amount)
+	record, err := s.lookupKey(key, operationTransfer, params)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		return s.FindTransferByID(record.ResultID)
+	}
+
+	transfer, err := s.Transfer(fromAccountID, toAccountID, amount)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberKey(key, operationTransfer, params, transfer.ID)
+	return transfer, nil
+}
+
+// lookupKey возвращает запись по ключу, если она ещё не истекла;
+// ключ, использованный с другой операцией или параметрами, даёт ErrIdempotencyConflict
+func (s *Service) lookupKey(key string, operation string, params string) (*idempotencyRecord, error) {
+	record, ok := s.idempotency[key]
+	if !ok {
+		return nil, nil
+	}
+	if s.keyExpired(record) {
+		delete(s.idempotency, key)
+		return nil, nil
+	}
+	if record.Operation != operation || record.Params != params {
+		return nil, ErrIdempotencyConflict
+	}
+	return record, nil
+}
+
+func (s *Service) rememberKey(key string, operation string, params string, resultID string) {
+	if s.idempotency == nil {
+		s.idempotency = make(map[string]*idempotencyRecord)
+	}
+	s.idempotency[key] = &idempotencyRecord{
+		Key:       key,
+		Operation: operation,
+		Params:    params,
+		ResultID:  resultID,
+		Created:   s.now(),
+	}
+}
+
+func (s *Service) keyExpired(record *idempotencyRecord) bool {
+	return s.now().Sub(record.Created) >= s.idempotencyWindow()
+}
+
+func (s *Service) exportIdempotency(dir string) error {
+	keys := make([]string, 0, len(s.idempotency))
+	for key, record := range s.idempotency {
+		if !s.keyExpired(record) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		record := s.idempotency[key]
+		// ключ задаёт клиент, а параметры содержат категорию, поэтому оба кодируются
+		rows = append(rows, []string{
+			encodeField(record.Key),
+			record.Operation,
+			encodeField(record.Params),
+			record.ResultID,
+			formatTime(record.Created),
+		})
+	}
+	return writeDump(filepath.Join(dir, "idempotency.dump"), rows)
+}
+
+func (s *Service) importIdempotency(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "idempotency.dump"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 5 {
+			return ErrInvalidDump
+		}
+		key, err := decodeField(row[0])
+		if err != nil {
+			return err
+		}
+		params, err := decodeField(row[2])
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[4])
+		if err != nil {
+			return err
+		}
+		record := &idempotencyRecord{
+			Key:       key,
+			Operation: row[1],
+			Params:    params,
+			ResultID:  row[3],
+			Created:   created,
+		}
+		if s.keyExpired(record) {
+			continue
+		}
+		if s.idempotency == nil {
+			s.idempotency = make(map[string]*idempotencyRecord)
+		}
+		s.idempotency[record.Key] = record
+	}
+	return nil
+}
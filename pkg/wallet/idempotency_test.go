@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestService_PayWithKey_retry(t *testing.T) {
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+
+	first, err := svc.PayWithKey("key-1", account.ID, 10_00, "Cafe")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	second, err := svc.PayWithKey("key-1", account.ID, 10_00, "Cafe")
+	if err != nil {
+		t.Fatalf("PayWithKey() retry: error = %v", err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("retry created new payment: %v != %v", first.ID, second.ID)
+	}
+	if account.Balance != 90_00 {
+		t.Errorf("\ngot > %v \nwant > %v", account.Balance, 90_00)
+	}
+
+	_, err = svc.PayWithKey("key-1", account.ID, 20_00, "Cafe")
+	if err != ErrIdempotencyConflict {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrIdempotencyConflict)
+	}
+	err = svc.DepositWithKey("key-1", account.ID, 10_00)
+	if err != ErrIdempotencyConflict {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrIdempotencyConflict)
+	}
+}
+
+func TestService_DepositWithKey_expires(t *testing.T) {
+	svc := Service{}
+	now := time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time { return now })
+	svc.SetIdempotencyTTL(time.Hour)
+	account, _ := svc.RegisterAccount("+992000000001")
+
+	svc.DepositWithKey("dep", account.ID, 10_00)
+	svc.DepositWithKey("dep", account.ID, 10_00)
+	if account.Balance != 10_00 {
+		t.Errorf("\ngot > %v \nwant > %v", account.Balance, 10_00)
+	}
+
+	now = now.Add(time.Hour)
+	svc.DepositWithKey("dep", account.ID, 10_00)
+	if account.Balance != 20_00 {
+		t.Errorf("expired key was not released: balance %v", account.Balance)
+	}
+}
+
+func TestService_TransferWithKey_exportImport(t *testing.T) {
+	dir := t.TempDir()
+	svc := Service{}
+	from, _ := svc.RegisterAccount("+992000000001")
+	to, _ := svc.RegisterAccount("+992000000002")
+	svc.Deposit(from.ID, 100_00)
+
+	transfer, err := svc.TransferWithKey("tr", from.ID, to.ID, 30_00)
+	if err != nil {
+		t.Fatalf("TransferWithKey(): error = %v", err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatalf("Export(): error = %v", err)
+	}
+
+	imported := Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+	again, err := imported.TransferWithKey("tr", from.ID, to.ID, 30_00)
+	if err != nil {
+		t.Fatalf("TransferWithKey() after import: error = %v", err)
+	}
+	if again.ID != transfer.ID {
+		t.Errorf("\ngot > %v \nwant > %v", again.ID, transfer.ID)
+	}
+	account, _ := imported.FindAccountByID(to.ID)
+	if account.Balance != 30_00 {
+		t.Errorf("\ngot > %v \nwant > %v", account.Balance, 30_00)
+	}
+}
+
+func TestService_PayWithKey_separatorInKey(t *testing.T) {
+	dir := t.TempDir()
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 100_00)
+
+	key := "order;42\nretry"
+	payment, err := svc.PayWithKey(key, account.ID, 10_00, "Cafe")
+	if err != nil {
+		t.Fatalf("PayWithKey(): error = %v", err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatalf("Export(): error = %v", err)
+	}
+
+	imported := Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+	again, err := imported.PayWithKey(key, account.ID, 10_00, "Cafe")
+	if err != nil {
+		t.Fatalf("PayWithKey() after import: error = %v", err)
+	}
+	if again.ID != payment.ID {
+		t.Errorf("\ngot > %v \nwant > %v", again.ID, payment.ID)
+	}
+}
+
+func TestService_Transfer_errors(t *testing.T) {
+	svc := Service{}
+	from, _ := svc.RegisterAccount("+992000000001")
+	to, _ := svc.RegisterAccount("+992000000002")
+	svc.Deposit(from.ID, 10_00)
+
+	if _, err := svc.Transfer(from.ID, from.ID, 1); err != ErrSameAccount {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrSameAccount)
+	}
+	if _, err := svc.Transfer(from.ID, to.ID, 11_00); err != ErrNotEnoughtBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughtBalance)
+	}
+	if _, err := svc.Transfer(from.ID, 42, 1); err != ErrAccountNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// record добавляет в журнал движение по балансу аккаунта
+func (s *Service) record(accountID int64, kind types.EntryKind, amount types.Money, referenceID string, category types.PaymentCategory) *types.Entry {
+	entry := &types.Entry{
+		ID:          uuid.New().String(),
+		AccountID:   accountID,
+		Kind:        kind,
+		Amount:      amount,
+		ReferenceID: referenceID,
+		Category:    category,
+		Created:     s.now(),
+	}
+	s.entries = append(s.entries, entry)
+	return entry
+}
+
+// AccountEntries возвращает движения по балансу аккаунта в порядке их совершения
+func (s *Service) AccountEntries(accountID int64) ([]types.Entry, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	var entries []types.Entry
+	for _, entry := range s.entries {
+		if entry.AccountID == accountID {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *Service) exportEntries(dir string) error {
+	if len(s.entries) == 0 {
+		return nil
+	}
+
+	rows := make([][]string, 0, len(s.entries))
+	for _, v := range s.entries {
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.AccountID, 10),
+			string(v.Kind),
+			strconv.FormatInt(int64(v.Amount), 10),
+			v.ReferenceID,
+			string(v.Category),
+			formatTime(v.Created),
+		})
+	}
+	return writeDump(filepath.Join(dir, "entries.dump"), rows)
+}
+
+func (s *Service) importEntries(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "entries.dump"))
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(s.entries))
+	for _, entry := range s.entries {
+		known[entry.ID] = true
+	}
+	for _, row := range rows {
+		if len(row) < 7 {
+			return ErrInvalidDump
+		}
+		if known[row[0]] {
+			continue
+		}
+		accountID, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(row[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[6])
+		if err != nil {
+			return err
+		}
+		s.entries = append(s.entries, &types.Entry{
+			ID:          row[0],
+			AccountID:   accountID,
+			Kind:        types.EntryKind(row[2]),
+			Amount:      types.Money(amount),
+			ReferenceID: row[4],
+			Category:    types.PaymentCategory(row[5]),
+			Created:     created,
+		})
+		known[row[0]] = true
+	}
+	return nil
+}
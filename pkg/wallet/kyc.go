@@ -0,0 +1,296 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки, связанные с уровнями верификации
+var ErrUnknownTier = errors.New("unknown verification tier")
+var ErrBalanceLimitExceeded = errors.New("balance limit for tier exceeded")
+var ErrPaymentLimitExceeded = errors.New("payment limit for tier exceeded")
+var ErrTurnoverLimitExceeded = errors.New("monthly turnover limit for tier exceeded")
+
+// DefaultTierPolicies ограничения по умолчанию для каждого уровня верификации
+var DefaultTierPolicies = map[types.AccountTier]types.TierPolicy{
+	types.TierAnonymous: {
+		MaxBalance:      10_000_00,
+		MaxPayment:      5_000_00,
+		MonthlyTurnover: 30_000_00,
+	},
+	types.TierBasic: {
+		MaxBalance:      50_000_00,
+		MaxPayment:      20_000_00,
+		MonthlyTurnover: 100_000_00,
+	},
+	types.TierFull: {},
+}
+
+// legacyTier уровень аккаунтов из файлов без колонки уровня: до появления уровней
+// лимитов не было, поэтому такие аккаунты сохраняют прежнее поведение
+const legacyTier = types.TierFull
+
+// SetClock подменяет источник текущего времени (нужно для тестов)
+func (s *Service) SetClock(clock func() time.Time) {
+	s.clock = clock
+}
+
+func (s *Service) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// SetTierPolicy задаёт ограничения для уровня верификации
+func (s *Service) SetTierPolicy(tier types.AccountTier, policy types.TierPolicy) error {
+	if !validTier(tier) {
+		return ErrUnknownTier
+	}
+	if s.tierPolicies == nil {
+		s.tierPolicies = make(map[types.AccountTier]types.TierPolicy)
+	}
+	before, _ := s.TierPolicy(tier)
+	s.tierPolicies[tier] = policy
+	s.audit(AuditSetTierPolicy, AuditState{TierPolicy: &before}, AuditState{TierPolicy: &policy}, tierTarget(tier))
+	return nil
+}
+
+// TierPolicy возвращает действующие ограничения для уровня верификации
+func (s *Service) TierPolicy(tier types.AccountTier) (types.TierPolicy, error) {
+	if tier == "" {
+		tier = types.TierAnonymous
+	}
+	if policy, ok := s.tierPolicies[tier]; ok {
+		return policy, nil
+	}
+	policy, ok := DefaultTierPolicies[tier]
+	if !ok {
+		return types.TierPolicy{}, ErrUnknownTier
+	}
+	return policy, nil
+}
+
+// SetAccountTier повышает или понижает уровень верификации аккаунта и сохраняет запись об изменении
+func (s *Service) SetAccountTier(accountID int64, tier types.AccountTier, reason string) (*types.TierChange, error) {
+	if !validTier(tier) {
+		return nil, ErrUnknownTier
+	}
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := s.TierPolicy(tier)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaxBalance > 0 && account.Balance > policy.MaxBalance {
+		return nil, ErrBalanceLimitExceeded
+	}
+
+	change := &types.TierChange{
+		AccountID: account.ID,
+		From:      account.Tier,
+		To:        tier,
+		Reason:    reason,
+		Created:   s.now(),
+	}
+	before := AuditState{Account: auditAccount(account)}
+	account.Tier = tier
+	s.audit(AuditSetAccountTier, before, AuditState{Account: auditAccount(account)}, accountTarget(account.ID))
+	s.tierChanges = append(s.tierChanges, change)
+	s.publish(TierChanged{EventHeader: s.header(EventTierChanged, account.ID), Change: *change})
+	return change, nil
+}
+
+// TierChanges возвращает историю изменений уровня верификации аккаунта
+func (s *Service) TierChanges(accountID int64) []types.TierChange {
+	var changes []types.TierChange
+	for _, change := range s.tierChanges {
+		if change.AccountID == accountID {
+			changes = append(changes, *change)
+		}
+	}
+	return changes
+}
+
+// exportTiers сохраняет историю изменений уровней в tiers.dump и заданные
+// SetTierPolicy ограничения в tier_policies.dump
+func (s *Service) exportTiers(dir string) error {
+	rows := make([][]string, 0, len(s.tierChanges))
+	for _, v := range s.tierChanges {
+		rows = append(rows, []string{
+			strconv.FormatInt(v.AccountID, 10),
+			string(v.From),
+			string(v.To),
+			encodeField(v.Reason),
+			formatTime(v.Created),
+		})
+	}
+	if err := writeDump(filepath.Join(dir, "tiers.dump"), rows); err != nil {
+		return err
+	}
+
+	tiers := make([]string, 0, len(s.tierPolicies))
+	for tier := range s.tierPolicies {
+		tiers = append(tiers, string(tier))
+	}
+	sort.Strings(tiers)
+	rows = make([][]string, 0, len(tiers))
+	for _, tier := range tiers {
+		policy := s.tierPolicies[types.AccountTier(tier)]
+		rows = append(rows, []string{
+			tier,
+			strconv.FormatInt(int64(policy.MaxBalance), 10),
+			strconv.FormatInt(int64(policy.MaxPayment), 10),
+			strconv.FormatInt(int64(policy.MonthlyTurnover), 10),
+		})
+	}
+	return writeDump(filepath.Join(dir, "tier_policies.dump"), rows)
+}
+
+// importTiers загружает историю уровней и ограничения; уже известные изменения
+// (тот же аккаунт, уровень и время) не дублируются
+func (s *Service) importTiers(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "tiers.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 5 {
+			return ErrInvalidDump
+		}
+		accountID, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		reason, err := decodeField(row[3])
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[4])
+		if err != nil {
+			return err
+		}
+		change := &types.TierChange{
+			AccountID: accountID,
+			From:      types.AccountTier(row[1]),
+			To:        types.AccountTier(row[2]),
+			Reason:    reason,
+			Created:   created,
+		}
+		if !validTier(change.From) || !validTier(change.To) {
+			return ErrUnknownTier
+		}
+		if s.hasTierChange(change) {
+			continue
+		}
+		s.tierChanges = append(s.tierChanges, change)
+	}
+
+	rows, err = readDump(filepath.Join(dir, "tier_policies.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 4 {
+			return ErrInvalidDump
+		}
+		tier := types.AccountTier(row[0])
+		if !validTier(tier) {
+			return ErrUnknownTier
+		}
+		var limits [3]int64
+		for i := range limits {
+			limits[i], err = strconv.ParseInt(row[i+1], 10, 64)
+			if err != nil {
+				return err
+			}
+		}
+		if s.tierPolicies == nil {
+			s.tierPolicies = make(map[types.AccountTier]types.TierPolicy)
+		}
+		s.tierPolicies[tier] = types.TierPolicy{
+			MaxBalance:      types.Money(limits[0]),
+			MaxPayment:      types.Money(limits[1]),
+			MonthlyTurnover: types.Money(limits[2]),
+		}
+	}
+	return nil
+}
+
+func (s *Service) hasTierChange(change *types.TierChange) bool {
+	for _, v := range s.tierChanges {
+		if v.AccountID == change.AccountID && v.To == change.To && v.Created.Equal(change.Created) {
+			return true
+		}
+	}
+	return false
+}
+
+func validTier(tier types.AccountTier) bool {
+	_, ok := DefaultTierPolicies[tier]
+	return ok
+}
+
+// checkDeposit проверяет, что пополнение не выведет баланс за лимит уровня
+func (s *Service) checkDeposit(account *types.Account, amount types.Money) error {
+	policy, err := s.TierPolicy(account.Tier)
+	if err != nil {
+		return err
+	}
+	if policy.MaxBalance > 0 && account.Balance+amount > policy.MaxBalance {
+		return ErrBalanceLimitExceeded
+	}
+	return nil
+}
+
+// checkPayment проверяет лимит разового платежа и месячного оборота
+func (s *Service) checkPayment(account *types.Account, amount types.Money) error {
+	policy, err := s.TierPolicy(account.Tier)
+	if err != nil {
+		return err
+	}
+	if policy.MaxPayment > 0 && amount > policy.MaxPayment {
+		return ErrPaymentLimitExceeded
+	}
+	if policy.MonthlyTurnover > 0 && s.monthlyTurnover(account.ID)+amount > policy.MonthlyTurnover {
+		return ErrTurnoverLimitExceeded
+	}
+	return nil
+}
+
+// monthlyTurnover считает сумму неотменённых платежей, исходящих переводов и выводов аккаунта за текущий календарный месяц
+func (s *Service) monthlyTurnover(accountID int64) types.Money {
+	now := s.now()
+	year, month, _ := now.Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+
+	total := types.Money(0)
+	for _, payment := range s.payments {
+		if payment.AccountID != accountID || payment.Status == types.PaymentStatusFail {
+			continue
+		}
+		if payment.Created.Before(start) {
+			continue
+		}
+		total += payment.Amount
+	}
+	for _, transfer := range s.transfers {
+		if transfer.FromAccountID == accountID && !transfer.Created.Before(start) {
+			total += transfer.Amount
+		}
+	}
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.AccountID == accountID && !withdrawal.Created.Before(start) {
+			total += withdrawal.Amount
+		}
+	}
+	return total
+}
@@ -0,0 +1,245 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestService_RegisterAccount_anonymousTier(t *testing.T) {
+	svc := Service{}
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatalf("RegisterAccount(): error = %v", err)
+	}
+	if account.Tier != types.TierAnonymous {
+		t.Errorf("\ngot > %v \nwant > %v", account.Tier, types.TierAnonymous)
+	}
+}
+
+func TestService_Deposit_balanceLimit(t *testing.T) {
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+
+	err := svc.Deposit(account.ID, DefaultTierPolicies[types.TierAnonymous].MaxBalance+1)
+	if err != ErrBalanceLimitExceeded {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrBalanceLimitExceeded)
+	}
+	if account.Balance != 0 {
+		t.Errorf("balance changed after rejected deposit: %v", account.Balance)
+	}
+}
+
+func TestService_Pay_limits(t *testing.T) {
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.SetTierPolicy(types.TierAnonymous, types.TierPolicy{
+		MaxBalance:      1000,
+		MaxPayment:      300,
+		MonthlyTurnover: 500,
+	})
+	now := time.Date(2021, 3, 15, 12, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time { return now })
+
+	if err := svc.Deposit(account.ID, 1000); err != nil {
+		t.Fatalf("Deposit(): error = %v", err)
+	}
+	if _, err := svc.Pay(account.ID, 301, "Cafe"); err != ErrPaymentLimitExceeded {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentLimitExceeded)
+	}
+	if _, err := svc.Pay(account.ID, 300, "Cafe"); err != nil {
+		t.Fatalf("Pay(): error = %v", err)
+	}
+	payment, err := svc.Pay(account.ID, 200, "Cafe")
+	if err != nil {
+		t.Fatalf("Pay(): error = %v", err)
+	}
+	if _, err := svc.Pay(account.ID, 1, "Cafe"); err != ErrTurnoverLimitExceeded {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrTurnoverLimitExceeded)
+	}
+
+	// отменённые платежи не входят в оборот
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatalf("Reject(): error = %v", err)
+	}
+	if _, err := svc.Pay(account.ID, 100, "Cafe"); err != nil {
+		t.Errorf("Pay() after reject: error = %v", err)
+	}
+
+	// в новом месяце оборот обнуляется
+	now = now.AddDate(0, 1, 0)
+	if _, err := svc.Pay(account.ID, 300, "Cafe"); err != nil {
+		t.Errorf("Pay() next month: error = %v", err)
+	}
+}
+
+func TestService_SetAccountTier(t *testing.T) {
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+
+	for _, tier := range []types.AccountTier{"GOLD", ""} {
+		if _, err := svc.SetAccountTier(account.ID, tier, ""); err != ErrUnknownTier {
+			t.Errorf("SetAccountTier(%q)\ngot > %v \nwant > %v", tier, err, ErrUnknownTier)
+		}
+	}
+
+	change, err := svc.SetAccountTier(account.ID, types.TierFull, "passport checked")
+	if err != nil {
+		t.Fatalf("SetAccountTier(): error = %v", err)
+	}
+	if change.From != types.TierAnonymous || change.To != types.TierFull {
+		t.Errorf("wrong change record: %+v", change)
+	}
+	if err := svc.Deposit(account.ID, 1_000_000_00); err != nil {
+		t.Errorf("Deposit() on full tier: error = %v", err)
+	}
+
+	_, err = svc.SetAccountTier(account.ID, types.TierBasic, "downgrade")
+	if err != ErrBalanceLimitExceeded {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrBalanceLimitExceeded)
+	}
+	if account.Tier != types.TierFull {
+		t.Errorf("tier changed after failed downgrade: %v", account.Tier)
+	}
+	if got := len(svc.TierChanges(account.ID)); got != 1 {
+		t.Errorf("TierChanges(): got %v records, want 1", got)
+	}
+}
+
+func TestService_SetTierPolicy_audit(t *testing.T) {
+	svc := &Service{}
+	operator := Actor{ID: "aziz", Role: "operator"}
+	policy := types.TierPolicy{MaxBalance: 1_000_00}
+	if err := svc.As(operator).SetTierPolicy(types.TierBasic, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetTierPolicy("GOLD", policy); err != ErrUnknownTier {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrUnknownTier)
+	}
+
+	records := svc.AuditLog(AuditQuery{Action: AuditSetTierPolicy})
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	if record.Actor != operator || !containsString(record.Targets, tierTarget(types.TierBasic)) {
+		t.Errorf("record = %+v", record)
+	}
+	if *record.Before.TierPolicy != DefaultTierPolicies[types.TierBasic] || *record.After.TierPolicy != policy {
+		t.Errorf("policy %+v -> %+v", record.Before.TierPolicy, record.After.TierPolicy)
+	}
+}
+
+func TestService_Import_tier(t *testing.T) {
+	tests := []struct {
+		name string
+		row  string
+		tier types.AccountTier
+		want error
+	}{
+		{"stored tier", "1;+992000000001;100;BASIC\n", types.TierBasic, nil},
+		{"legacy row without tier", "1;+992000000001;100\n", types.TierFull, nil},
+		{"unknown tier", "1;+992000000001;100;GOLD\n", "", ErrUnknownTier},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, "accounts.dump"), []byte(test.row), 0666); err != nil {
+				t.Fatal(err)
+			}
+			svc := &Service{}
+			if err := svc.Import(dir); err != test.want {
+				t.Fatalf("error = %v, want %v", err, test.want)
+			}
+			if test.want != nil {
+				return
+			}
+			account, _ := svc.FindAccountByID(1)
+			if account.Tier != test.tier {
+				t.Errorf("tier = %v, want %v", account.Tier, test.tier)
+			}
+		})
+	}
+}
+
+func TestService_Import_legacyAccountKeepsNoLimits(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "accounts.dump"), []byte("1;+992000000001;900000\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	svc := &Service{}
+	if err := svc.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	// до появления уровней лимитов не было, лимит анонимного уровня к старому аккаунту не применяется
+	if err := svc.Deposit(1, DefaultTierPolicies[types.TierAnonymous].MaxBalance); err != nil {
+		t.Errorf("Deposit(): error = %v", err)
+	}
+}
+
+func TestService_Export_keepsTier(t *testing.T) {
+	dir := t.TempDir()
+	svc := Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.SetAccountTier(account.ID, types.TierBasic, "")
+	svc.Deposit(account.ID, 100)
+	svc.Pay(account.ID, 10, "Cafe")
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatalf("Export(): error = %v", err)
+	}
+
+	imported := Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+	got, err := imported.FindAccountByID(account.ID)
+	if err != nil {
+		t.Fatalf("FindAccountByID(): error = %v", err)
+	}
+	if got.Tier != types.TierBasic {
+		t.Errorf("\ngot > %v \nwant > %v", got.Tier, types.TierBasic)
+	}
+	if imported.payments[0].Created.IsZero() {
+		t.Errorf("payment time was not imported")
+	}
+}
+
+func TestService_Export_tierHistoryAndPolicies(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	if _, err := svc.SetAccountTier(account.ID, types.TierBasic, "passport; selfie"); err != nil {
+		t.Fatal(err)
+	}
+	policy := types.TierPolicy{MaxBalance: 70_000_00, MaxPayment: 30_000_00, MonthlyTurnover: 150_000_00}
+	if err := svc.SetTierPolicy(types.TierBasic, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Service{}
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("Import(): error = %v", err)
+	}
+	// повторный импорт не дублирует историю
+	if err := imported.Import(dir); err != nil {
+		t.Fatalf("second Import(): error = %v", err)
+	}
+	changes := imported.TierChanges(account.ID)
+	want := svc.TierChanges(account.ID)
+	if len(changes) != 1 || changes[0].Reason != want[0].Reason || changes[0].To != types.TierBasic || !changes[0].Created.Equal(want[0].Created) {
+		t.Errorf("TierChanges() = %+v, want %+v", changes, want)
+	}
+	if got, _ := imported.TierPolicy(types.TierBasic); got != policy {
+		t.Errorf("TierPolicy(BASIC) = %+v, want %+v", got, policy)
+	}
+	if got, _ := imported.TierPolicy(types.TierAnonymous); got != DefaultTierPolicies[types.TierAnonymous] {
+		t.Errorf("TierPolicy(ANONYMOUS) = %+v, want default", got)
+	}
+}
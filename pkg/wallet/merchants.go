@@ -0,0 +1,443 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки мерчантов
+var ErrMerchantNotFound = errors.New("merchant not found")
+var ErrInvalidMerchant = errors.New("merchant name and categories must be non-empty and must not contain ';', ',' or line breaks")
+var ErrMerchantCategory = errors.New("category is not served by the merchant")
+var ErrNothingToSettle = errors.New("merchant has nothing to settle")
+var ErrSettlementNotFound = errors.New("settlement not found")
+
+// SettlementReport выплата мерчанту и вошедшие в неё платежи и отмены
+type SettlementReport struct {
+	Settlement types.Settlement
+	Entries    []types.MerchantEntry
+}
+
+// RegisterMerchant регистрирует мерчанта, выплаты которому поступают на счёт settlementAccountID.
+// Пустой categories - мерчант принимает платежи по любой категории
+func (s *Service) RegisterMerchant(name string, categories []types.PaymentCategory, settlementAccountID int64) (*types.Merchant, error) {
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ";\r\n") {
+		return nil, ErrInvalidMerchant
+	}
+	account, err := s.FindAccountByID(settlementAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	merchant := &types.Merchant{
+		ID:                  uuid.New().String(),
+		Name:                name,
+		Categories:          []types.PaymentCategory{},
+		SettlementAccountID: account.ID,
+	}
+	for _, value := range categories {
+		if strings.TrimSpace(string(value)) == "" || strings.ContainsAny(string(value), ";,\r\n") {
+			return nil, ErrInvalidMerchant
+		}
+		category, err := s.checkCategory(value)
+		if err != nil {
+			return nil, err
+		}
+		merchant.Categories = append(merchant.Categories, category)
+	}
+	s.merchants = append(s.merchants, merchant)
+
+	after := cloneMerchant(merchant)
+	s.audit(AuditRegisterMerchant, AuditState{}, AuditState{Merchant: after}, merchantTarget(merchant.ID), accountTarget(account.ID))
+	s.publish(MerchantRegistered{EventHeader: s.header(EventMerchantRegistered, account.ID), Merchant: *after})
+	return merchant, nil
+}
+
+// FindMerchantByID ищет мерчанта по ID
+func (s *Service) FindMerchantByID(merchantID string) (*types.Merchant, error) {
+	for _, merchant := range s.merchants {
+		if merchant.ID == merchantID {
+			return merchant, nil
+		}
+	}
+	return nil, ErrMerchantNotFound
+}
+
+// Merchants возвращает всех мерчантов в порядке регистрации
+func (s *Service) Merchants() []types.Merchant {
+	merchants := make([]types.Merchant, 0, len(s.merchants))
+	for _, merchant := range s.merchants {
+		merchants = append(merchants, *cloneMerchant(merchant))
+	}
+	return merchants
+}
+
+// PayMerchant платит мерчанту; пустая category - первая категория мерчанта
+func (s *Service) PayMerchant(accountID int64, merchantID string, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	payment, err := s.payMerchant(AuditPayMerchant, accountID, merchantID, amount, category)
+	if err != nil {
+		return nil, err
+	}
+	s.publishPaymentCreated(payment, "", "")
+	return payment, nil
+}
+
+// payMerchant создаёт платёж мерчанту без публикации события, см. pay
+func (s *Service) payMerchant(action AuditAction, accountID int64, merchantID string, amount types.Money, category types.PaymentCategory, targets ...string) (*types.Payment, error) {
+	merchant, err := s.FindMerchantByID(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	category, err = s.merchantCategory(merchant, category)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := s.pay(action, accountID, amount, category, append(targets, merchantTarget(merchant.ID))...)
+	if err != nil {
+		return nil, err
+	}
+	payment.MerchantID = merchant.ID
+	s.creditMerchant(merchant, payment)
+	return payment, nil
+}
+
+// MerchantEntries возвращает движения баланса мерчанта в хронологическом порядке
+func (s *Service) MerchantEntries(merchantID string) ([]types.MerchantEntry, error) {
+	if _, err := s.FindMerchantByID(merchantID); err != nil {
+		return nil, err
+	}
+	entries := []types.MerchantEntry{}
+	for _, entry := range s.merchantEntries {
+		if entry.MerchantID == merchantID {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+// Settle перечисляет баланс мерчанта на его счёт
+func (s *Service) Settle(merchantID string) (*SettlementReport, error) {
+	merchant, err := s.FindMerchantByID(merchantID)
+	if err != nil {
+		return nil, err
+	}
+	if merchant.Balance <= 0 {
+		return nil, ErrNothingToSettle
+	}
+	account, err := s.FindAccountByID(merchant.SettlementAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	before := AuditState{Account: auditAccount(account), Merchant: cloneMerchant(merchant)}
+	settlement := &types.Settlement{
+		ID:         uuid.New().String(),
+		MerchantID: merchant.ID,
+		AccountID:  account.ID,
+		Created:    s.now(),
+	}
+	report := s.applySettlement(merchant, account, settlement)
+
+	settlementCopy := *settlement
+	s.audit(AuditSettleMerchant, before, AuditState{Account: auditAccount(account), Merchant: cloneMerchant(merchant), Settlement: &settlementCopy},
+		merchantTarget(merchant.ID), accountTarget(account.ID), settlementTarget(settlement.ID))
+	s.publish(MerchantSettled{EventHeader: s.header(EventMerchantSettled, account.ID), Settlement: *settlement})
+	return report, nil
+}
+
+// RunSettlement перечисляет балансы всех мерчантов, у которых он положительный
+func (s *Service) RunSettlement() ([]SettlementReport, error) {
+	reports := []SettlementReport{}
+	for _, merchant := range s.merchants {
+		if merchant.Balance <= 0 {
+			continue
+		}
+		report, err := s.Settle(merchant.ID)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// Settlements возвращает выплаты мерчанту, пустой merchantID - всем мерчантам
+func (s *Service) Settlements(merchantID string) []types.Settlement {
+	settlements := []types.Settlement{}
+	for _, settlement := range s.settlements {
+		if merchantID == "" || settlement.MerchantID == merchantID {
+			settlements = append(settlements, *settlement)
+		}
+	}
+	return settlements
+}
+
+// SettlementReport восстанавливает отчёт по ранее выполненной выплате
+func (s *Service) SettlementReport(settlementID string) (*SettlementReport, error) {
+	for _, settlement := range s.settlements {
+		if settlement.ID == settlementID {
+			report := &SettlementReport{Settlement: *settlement, Entries: []types.MerchantEntry{}}
+			for _, entry := range s.merchantEntries {
+				if entry.SettlementID == settlementID {
+					report.Entries = append(report.Entries, *entry)
+				}
+			}
+			return report, nil
+		}
+	}
+	return nil, ErrSettlementNotFound
+}
+
+// applySettlement включает в выплату все неперечисленные движения мерчанта и зачисляет сумму на счёт
+func (s *Service) applySettlement(merchant *types.Merchant, account *types.Account, settlement *types.Settlement) *SettlementReport {
+	report := &SettlementReport{}
+	for _, entry := range s.merchantEntries {
+		if entry.MerchantID != merchant.ID || entry.SettlementID != "" {
+			continue
+		}
+		entry.SettlementID = settlement.ID
+		if entry.Amount > 0 {
+			settlement.Gross += entry.Amount
+		} else {
+			settlement.Rejected -= entry.Amount
+		}
+		report.Entries = append(report.Entries, *entry)
+	}
+	settlement.Amount = settlement.Gross - settlement.Rejected
+
+	merchant.Balance -= settlement.Amount
+	account.Balance += settlement.Amount
+	s.settlements = append(s.settlements, settlement)
+	s.record(account.ID, types.EntrySettlement, settlement.Amount, settlement.ID, "")
+	report.Settlement = *settlement
+	return report
+}
+
+// merchantCategory проверяет, что мерчант принимает платежи по категории
+func (s *Service) merchantCategory(merchant *types.Merchant, category types.PaymentCategory) (types.PaymentCategory, error) {
+	if len(merchant.Categories) == 0 {
+		return category, nil
+	}
+	if category == "" {
+		return merchant.Categories[0], nil
+	}
+	key := s.categoryKey(category)
+	for _, v := range merchant.Categories {
+		if s.categoryKey(v) == key {
+			return v, nil
+		}
+	}
+	return "", ErrMerchantCategory
+}
+
+// categoryKey ID категории в каталоге, а без каталога - каноническое написание
+func (s *Service) categoryKey(value types.PaymentCategory) types.PaymentCategory {
+	if category := s.findCategory(string(value)); category != nil {
+		return category.ID
+	}
+	return CanonicalCategory(string(value))
+}
+
+func (s *Service) creditMerchant(merchant *types.Merchant, payment *types.Payment) {
+	merchant.Balance += payment.Amount
+	s.merchantEntries = append(s.merchantEntries, &types.MerchantEntry{
+		MerchantID: merchant.ID,
+		PaymentID:  payment.ID,
+		Amount:     payment.Amount,
+		Created:    payment.Created,
+	})
+}
+
+// reverseMerchant уменьшает баланс мерчанта на сумму отменённого платежа
+func (s *Service) reverseMerchant(payment *types.Payment) {
+	if payment.MerchantID == "" {
+		return
+	}
+	merchant, err := s.FindMerchantByID(payment.MerchantID)
+	if err != nil {
+		return
+	}
+	merchant.Balance -= payment.Amount
+	s.merchantEntries = append(s.merchantEntries, &types.MerchantEntry{
+		MerchantID: merchant.ID,
+		PaymentID:  payment.ID,
+		Amount:     -payment.Amount,
+		Created:    s.now(),
+	})
+}
+
+func cloneMerchant(merchant *types.Merchant) *types.Merchant {
+	clone := *merchant
+	clone.Categories = append([]types.PaymentCategory{}, merchant.Categories...)
+	return &clone
+}
+
+func (s *Service) exportMerchants(dir string) error {
+	if len(s.merchants) > 0 {
+		rows := make([][]string, 0, len(s.merchants))
+		for _, v := range s.merchants {
+			categories := make([]string, 0, len(v.Categories))
+			for _, category := range v.Categories {
+				categories = append(categories, string(category))
+			}
+			rows = append(rows, []string{
+				v.ID,
+				v.Name,
+				strings.Join(categories, ","),
+				strconv.FormatInt(v.SettlementAccountID, 10),
+			})
+		}
+		if err := writeDump(filepath.Join(dir, "merchants.dump"), rows); err != nil {
+			return err
+		}
+	}
+
+	if len(s.merchantEntries) > 0 {
+		rows := make([][]string, 0, len(s.merchantEntries))
+		for _, v := range s.merchantEntries {
+			rows = append(rows, []string{
+				v.MerchantID,
+				v.PaymentID,
+				strconv.FormatInt(int64(v.Amount), 10),
+				formatTime(v.Created),
+				v.SettlementID,
+			})
+		}
+		if err := writeDump(filepath.Join(dir, "merchant_entries.dump"), rows); err != nil {
+			return err
+		}
+	}
+
+	if len(s.settlements) > 0 {
+		rows := make([][]string, 0, len(s.settlements))
+		for _, v := range s.settlements {
+			rows = append(rows, []string{
+				v.ID,
+				v.MerchantID,
+				strconv.FormatInt(v.AccountID, 10),
+				strconv.FormatInt(int64(v.Gross), 10),
+				strconv.FormatInt(int64(v.Rejected), 10),
+				strconv.FormatInt(int64(v.Amount), 10),
+				formatTime(v.Created),
+			})
+		}
+		if err := writeDump(filepath.Join(dir, "settlements.dump"), rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importMerchants читает мерчантов, их движения и выплаты; баланс мерчанта пересчитывается
+// по неперечисленным движениям
+func (s *Service) importMerchants(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "merchants.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 4 {
+			return ErrInvalidDump
+		}
+		merchant := &types.Merchant{ID: row[0], Name: row[1], Categories: []types.PaymentCategory{}}
+		if row[2] != "" {
+			for _, category := range strings.Split(row[2], ",") {
+				merchant.Categories = append(merchant.Categories, types.PaymentCategory(category))
+			}
+		}
+		if merchant.SettlementAccountID, err = strconv.ParseInt(row[3], 10, 64); err != nil {
+			return err
+		}
+
+		if existing, err := s.FindMerchantByID(merchant.ID); err == nil {
+			*existing = *merchant
+			continue
+		}
+		s.merchants = append(s.merchants, merchant)
+	}
+
+	rows, err = readDump(filepath.Join(dir, "merchant_entries.dump"))
+	if err != nil {
+		return err
+	}
+	// движение однозначно задаётся платежом и знаком суммы
+	known := make(map[string]*types.MerchantEntry, len(s.merchantEntries))
+	key := func(entry *types.MerchantEntry) string {
+		if entry.Amount < 0 {
+			return entry.PaymentID + "-"
+		}
+		return entry.PaymentID + "+"
+	}
+	for _, entry := range s.merchantEntries {
+		known[key(entry)] = entry
+	}
+	for _, row := range rows {
+		if len(row) < 5 {
+			return ErrInvalidDump
+		}
+		entry := &types.MerchantEntry{MerchantID: row[0], PaymentID: row[1], SettlementID: row[4]}
+		amount, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		entry.Amount = types.Money(amount)
+		if entry.Created, err = parseTime(row[3]); err != nil {
+			return err
+		}
+
+		if existing, ok := known[key(entry)]; ok {
+			*existing = *entry
+			continue
+		}
+		s.merchantEntries = append(s.merchantEntries, entry)
+		known[key(entry)] = entry
+	}
+
+	rows, err = readDump(filepath.Join(dir, "settlements.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 7 {
+			return ErrInvalidDump
+		}
+		settlement := &types.Settlement{ID: row[0], MerchantID: row[1]}
+		if settlement.AccountID, err = strconv.ParseInt(row[2], 10, 64); err != nil {
+			return err
+		}
+		var amounts [3]int64
+		for i := range amounts {
+			if amounts[i], err = strconv.ParseInt(row[3+i], 10, 64); err != nil {
+				return err
+			}
+		}
+		settlement.Gross, settlement.Rejected, settlement.Amount = types.Money(amounts[0]), types.Money(amounts[1]), types.Money(amounts[2])
+		if settlement.Created, err = parseTime(row[6]); err != nil {
+			return err
+		}
+
+		if _, err := s.SettlementReport(settlement.ID); err == nil {
+			continue
+		}
+		s.settlements = append(s.settlements, settlement)
+	}
+
+	for _, merchant := range s.merchants {
+		merchant.Balance = 0
+	}
+	for _, entry := range s.merchantEntries {
+		if entry.SettlementID != "" {
+			continue
+		}
+		if merchant, err := s.FindMerchantByID(entry.MerchantID); err == nil {
+			merchant.Balance += entry.Amount
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// merchantService сервис с покупателем (аккаунт 1), счётом мерчанта (аккаунт 2) и мерчантом кафе
+func merchantService(t *testing.T) (*Service, *types.Merchant) {
+	t.Helper()
+	svc := &Service{}
+	buyer, _ := svc.RegisterAccount("+992000000001")
+	seller, _ := svc.RegisterAccount("+992000000002")
+	if err := svc.Deposit(buyer.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	merchant, err := svc.RegisterMerchant("Coffee House", []types.PaymentCategory{"cafe", "food"}, seller.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, merchant
+}
+
+func TestService_RegisterMerchant(t *testing.T) {
+	svc, _ := merchantService(t)
+
+	tests := []struct {
+		name       string
+		merchant   string
+		categories []types.PaymentCategory
+		account    int64
+		want       error
+	}{
+		{"no categories", "Anything", nil, 2, nil},
+		{"empty name", " ", nil, 2, ErrInvalidMerchant},
+		{"separator in category", "Shop", []types.PaymentCategory{"a,b"}, 2, ErrInvalidMerchant},
+		{"unknown account", "Shop", nil, 42, ErrAccountNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.RegisterMerchant(test.merchant, test.categories, test.account); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestService_PayMerchant(t *testing.T) {
+	svc, merchant := merchantService(t)
+
+	payment, err := svc.PayMerchant(1, merchant.ID, 10_00, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.MerchantID != merchant.ID || payment.Category != "cafe" {
+		t.Errorf("payment = %+v", payment)
+	}
+	if _, err := svc.PayMerchant(1, merchant.ID, 5_00, "Food"); err != nil {
+		t.Errorf("second category: error = %v", err)
+	}
+	if _, err := svc.PayMerchant(1, merchant.ID, 5_00, "taxi"); err != ErrMerchantCategory {
+		t.Errorf("foreign category: error = %v, want %v", err, ErrMerchantCategory)
+	}
+	if _, err := svc.PayMerchant(1, "unknown", 5_00, ""); err != ErrMerchantNotFound {
+		t.Errorf("unknown merchant: error = %v, want %v", err, ErrMerchantNotFound)
+	}
+
+	repeated, err := svc.Repeat(payment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeated.MerchantID != merchant.ID {
+		t.Errorf("repeat lost merchant: %+v", repeated)
+	}
+
+	svc.Reject(payment.ID)
+	if err := svc.Reject(payment.ID); err != ErrPaymentRejected {
+		t.Errorf("error = %v, want %v", err, ErrPaymentRejected)
+	}
+	if merchant.Balance != 15_00 {
+		t.Errorf("balance = %v, want %v", merchant.Balance, 15_00)
+	}
+	if account, _ := svc.FindAccountByID(1); account.Balance != 1_000_00-15_00 {
+		t.Errorf("buyer balance = %v, want %v", account.Balance, 1_000_00-15_00)
+	}
+}
+
+func TestService_Settle(t *testing.T) {
+	svc, merchant := merchantService(t)
+	first, _ := svc.PayMerchant(1, merchant.ID, 10_00, "")
+	svc.PayMerchant(1, merchant.ID, 20_00, "")
+	svc.Reject(first.ID)
+
+	reports, err := svc.RunSettlement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	settlement := reports[0].Settlement
+	if settlement.Gross != 30_00 || settlement.Rejected != 10_00 || settlement.Amount != 20_00 {
+		t.Errorf("settlement = %+v", settlement)
+	}
+	if len(reports[0].Entries) != 3 {
+		t.Errorf("report has %d entries, want 3", len(reports[0].Entries))
+	}
+	account, _ := svc.FindAccountByID(merchant.SettlementAccountID)
+	if account.Balance != 20_00 || merchant.Balance != 0 {
+		t.Errorf("account balance = %v, merchant balance = %v", account.Balance, merchant.Balance)
+	}
+	if _, err := svc.Settle(merchant.ID); err != ErrNothingToSettle {
+		t.Errorf("second settle: error = %v, want %v", err, ErrNothingToSettle)
+	}
+
+	// отмена после выплаты уменьшает следующую выплату
+	svc.PayMerchant(1, merchant.ID, 5_00, "")
+	svc.Reject(reports[0].Entries[1].PaymentID)
+	if merchant.Balance != -15_00 {
+		t.Errorf("balance after late reject = %v, want %v", merchant.Balance, -15_00)
+	}
+	if late, _ := svc.RunSettlement(); len(late) != 0 {
+		t.Errorf("negative balance was settled: %+v", late)
+	}
+
+	report, err := svc.SettlementReport(settlement.ID)
+	if err != nil || !reflect.DeepEqual(report.Entries, reports[0].Entries) {
+		t.Errorf("SettlementReport() = %+v, %v", report, err)
+	}
+}
+
+func TestService_Merchants_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+
+	buyer, _ := svc.RegisterAccount("+992000000001")
+	seller, _ := svc.RegisterAccount("+992000000002")
+	svc.Deposit(buyer.ID, 1_000_00)
+	merchant, _ := svc.RegisterMerchant("Coffee House", []types.PaymentCategory{"cafe"}, seller.ID)
+	first, _ := svc.PayMerchant(buyer.ID, merchant.ID, 10_00, "")
+	svc.PayMerchant(buyer.ID, merchant.ID, 20_00, "")
+	svc.Reject(first.ID)
+	svc.Settle(merchant.ID)
+	svc.PayMerchant(buyer.ID, merchant.ID, 7_00, "")
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]*Service{"imported": restored, "rebuilt": rebuilt} {
+		if !reflect.DeepEqual(got.Merchants(), svc.Merchants()) {
+			t.Errorf("%s merchants = %+v, want %+v", name, got.Merchants(), svc.Merchants())
+		}
+		if got, want := len(got.Settlements(merchant.ID)), 1; got != want {
+			t.Errorf("%s settlements = %d, want %d", name, got, want)
+		}
+		account, _ := got.FindAccountByID(seller.ID)
+		if account.Balance != 20_00 {
+			t.Errorf("%s seller balance = %v, want %v", name, account.Balance, 20_00)
+		}
+		payment, _ := got.FindPaymentByID(first.ID)
+		if payment.MerchantID != merchant.ID {
+			t.Errorf("%s payment lost merchant: %+v", name, payment)
+		}
+	}
+}
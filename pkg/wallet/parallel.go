@@ -0,0 +1,149 @@
+package wallet
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// maxChunkSize максимальный размер куска, между кусками воркеры проверяют отмену контекста
+const maxChunkSize = 4096
+
+// ScanOptions настройки параллельного обхода платежей
+type ScanOptions struct {
+	// Goroutines количество воркеров, 0 или меньше - по числу процессоров
+	Goroutines int
+	// Ordered объединять частичные результаты строго в порядке следования платежей
+	Ordered bool
+	// ChunkSize размер куска, 0 - делить платежи поровну между воркерами
+	ChunkSize int
+}
+
+// MapFunc обрабатывает кусок платежей и возвращает частичный результат
+type MapFunc func(payments []*types.Payment) interface{}
+
+// ReduceFunc добавляет частичный результат к накопленному и возвращает новый накопленный результат
+type ReduceFunc func(acc interface{}, part interface{}) interface{}
+
+// MapReduce делит платежи на куски, обрабатывает их параллельно через mapFn и объединяет через reduceFn.
+// При Ordered reduceFn вызывается в порядке кусков, иначе - по мере готовности (но никогда одновременно).
+// При отмене ctx воркеры останавливаются и возвращается ctx.Err()
+func (s *Service) MapReduce(ctx context.Context, opts ScanOptions, mapFn MapFunc, reduceFn ReduceFunc, initial interface{}) (interface{}, error) {
+	return scanPayments(ctx, s.payments, opts, mapFn, reduceFn, initial)
+}
+
+func scanPayments(ctx context.Context, payments []*types.Payment, opts ScanOptions, mapFn MapFunc, reduceFn ReduceFunc, initial interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	chunks := opts.chunks(len(payments))
+	if len(chunks) == 0 {
+		return initial, nil
+	}
+
+	workers := workerCount(opts.Goroutines, len(chunks))
+	jobs := make(chan int)
+	results := make([]interface{}, len(chunks))
+	acc := initial
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				chunk := chunks[index]
+				part := mapFn(payments[chunk.from:chunk.to])
+				if opts.Ordered {
+					results[index] = part
+					continue
+				}
+				mu.Lock()
+				acc = reduceFn(acc, part)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for index := range chunks {
+		select {
+		case jobs <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Ordered {
+		for _, part := range results {
+			acc = reduceFn(acc, part)
+		}
+	}
+	return acc, nil
+}
+
+// chunks делит n платежей на куски согласно настройкам
+func (opts ScanOptions) chunks(n int) []chunkBounds {
+	if opts.ChunkSize > 0 {
+		return splitBySize(n, opts.ChunkSize)
+	}
+	return splitChunks(n, workerCount(opts.Goroutines, n))
+}
+
+// workerCount возвращает число воркеров, но не больше числа задач
+func workerCount(goroutines int, tasks int) int {
+	if goroutines <= 0 {
+		goroutines = runtime.NumCPU()
+	}
+	if goroutines > tasks {
+		goroutines = tasks
+	}
+	return goroutines
+}
+
+type chunkBounds struct {
+	from int
+	to   int
+}
+
+// splitChunks делит n элементов примерно поровну между parts частями,
+// дополнительно ограничивая размер куска maxChunkSize
+func splitChunks(n int, parts int) []chunkBounds {
+	if n == 0 || parts <= 0 {
+		return nil
+	}
+	size := (n + parts - 1) / parts
+	if size > maxChunkSize {
+		size = maxChunkSize
+	}
+	return splitBySize(n, size)
+}
+
+// splitBySize делит n элементов на куски по size элементов, последний кусок может быть меньше
+func splitBySize(n int, size int) []chunkBounds {
+	if n == 0 || size <= 0 {
+		return nil
+	}
+
+	chunks := make([]chunkBounds, 0, (n+size-1)/size)
+	for from := 0; from < n; from += size {
+		to := from + size
+		if to > n {
+			to = n
+		}
+		chunks = append(chunks, chunkBounds{from: from, to: to})
+	}
+	return chunks
+}
@@ -0,0 +1,93 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestService_SumPayments_goroutines(t *testing.T) {
+	svc := &Service{}
+	want := types.Money(0)
+	for i := 1; i <= 10_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: types.Money(i)})
+		want += types.Money(i)
+	}
+
+	for _, goroutines := range []int{-1, 0, 1, 3, 7, 10_000, 20_000} {
+		if got := svc.SumPayments(goroutines); got != want {
+			t.Errorf("SumPayments(%v): got > %v want > %v", goroutines, got, want)
+		}
+	}
+
+	empty := &Service{}
+	if got := empty.SumPayments(5); got != 0 {
+		t.Errorf("SumPayments() on empty service: got > %v want > 0", got)
+	}
+}
+
+func TestService_FilterPaymentsByFn_order(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 10_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: types.Money(i)})
+	}
+
+	payments, err := svc.FilterPaymentsByFn(func(payment types.Payment) bool {
+		return payment.Amount%2 == 0
+	}, 8)
+	if err != nil {
+		t.Fatalf("FilterPaymentsByFn(): error = %v", err)
+	}
+	if len(payments) != 5_000 {
+		t.Fatalf("got %v payments, want 5000", len(payments))
+	}
+	for i, payment := range payments {
+		if payment.Amount != types.Money(i*2) {
+			t.Fatalf("payment %v out of order: amount %v", i, payment.Amount)
+		}
+	}
+}
+
+func TestService_MapReduce_ordered(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 9_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: types.Money(i)})
+	}
+
+	result, err := svc.MapReduce(context.Background(), ScanOptions{Goroutines: 4, Ordered: true},
+		func(payments []*types.Payment) interface{} {
+			return payments[0].Amount
+		},
+		func(acc interface{}, part interface{}) interface{} {
+			return append(acc.([]types.Money), part.(types.Money))
+		}, []types.Money(nil))
+	if err != nil {
+		t.Fatalf("MapReduce(): error = %v", err)
+	}
+
+	firsts := result.([]types.Money)
+	for i := 1; i < len(firsts); i++ {
+		if firsts[i] <= firsts[i-1] {
+			t.Fatalf("chunks reduced out of order: %v", firsts)
+		}
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	chunks := splitChunks(10, 3)
+	if len(chunks) != 3 || chunks[0].from != 0 || chunks[2].to != 10 {
+		t.Errorf("splitChunks(10, 3): got %v", chunks)
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].from != chunks[i-1].to {
+			t.Errorf("chunks are not contiguous: %v", chunks)
+		}
+	}
+	if chunks := splitChunks(0, 3); len(chunks) != 0 {
+		t.Errorf("splitChunks(0, 3): got %v", chunks)
+	}
+	if chunks := splitChunks(maxChunkSize*2+1, 1); len(chunks) != 3 {
+		t.Errorf("chunk size is not limited: got %v chunks", len(chunks))
+	}
+}
@@ -0,0 +1,286 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки запросов
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSortField = errors.New("invalid sort field")
+
+// SortField поле, по которому сортируются платежи
+type SortField string
+
+// поля сортировки
+const (
+	SortByCreated   SortField = "created"
+	SortByAmount    SortField = "amount"
+	SortByCategory  SortField = "category"
+	SortByStatus    SortField = "status"
+	SortByAccountID SortField = "account"
+)
+
+// SortKey ключ сортировки
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// PaymentQuery условия выборки платежей; пустые поля не ограничивают выборку
+type PaymentQuery struct {
+	AccountID        int64
+	Categories       []types.PaymentCategory
+	Statuses         []types.PaymentStatus
+	MinAmount        types.Money
+	MaxAmount        types.Money
+	From             time.Time // включительно
+	To               time.Time // не включительно
+	CategoryContains string    // поиск подстроки в категории без учёта регистра
+
+	// Sort ключи сортировки, без них платежи идут в порядке создания
+	Sort   []SortKey
+	Limit  int
+	Offset int
+	// Cursor продолжение выборки после страницы, вернувшей этот курсор
+	Cursor string
+}
+
+// PaymentPage страница результатов запроса
+type PaymentPage struct {
+	Payments []types.Payment
+	// Total сколько всего платежей подходит под условия
+	Total int
+	// NextCursor курсор следующей страницы, пустой если страница последняя
+	NextCursor string
+}
+
+// paymentIndex индексы платежей по позициям в s.payments; пополняется лениво
+type paymentIndex struct {
+	indexed    int
+	byAccount  map[int64][]int
+	byCategory map[types.PaymentCategory][]int
+}
+
+// refreshIndex добавляет в индекс платежи, появившиеся после прошлого обновления
+func (s *Service) refreshIndex() {
+	if s.index.byAccount == nil || s.index.indexed > len(s.payments) {
+		s.index = paymentIndex{
+			byAccount:  make(map[int64][]int),
+			byCategory: make(map[types.PaymentCategory][]int),
+		}
+	}
+	for i := s.index.indexed; i < len(s.payments); i++ {
+		payment := s.payments[i]
+		s.index.byAccount[payment.AccountID] = append(s.index.byAccount[payment.AccountID], i)
+		s.index.byCategory[payment.Category] = append(s.index.byCategory[payment.Category], i)
+	}
+	s.index.indexed = len(s.payments)
+}
+
+// resetIndex сбрасывает индекс, если платежи изменились на месте
+func (s *Service) resetIndex() {
+	s.index = paymentIndex{}
+}
+
+// QueryPayments выбирает платежи по условиям запроса, сортирует и возвращает одну страницу
+func (s *Service) QueryPayments(query PaymentQuery) (*PaymentPage, error) {
+	for _, key := range query.Sort {
+		if _, ok := sortFields[key.Field]; !ok {
+			return nil, ErrInvalidSortField
+		}
+	}
+
+	positions := s.candidates(query)
+	matched := make([]int, 0, len(positions))
+	for _, position := range positions {
+		if query.matches(s.payments[position]) {
+			matched = append(matched, position)
+		}
+	}
+
+	less := func(a, b int) bool {
+		return s.lessPayment(query.Sort, a, b)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+
+	start := 0
+	if query.Cursor != "" {
+		after, err := s.decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(matched), func(i int) bool {
+			return less(after, matched[i])
+		})
+	}
+	if query.Offset > 0 {
+		start += query.Offset
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := len(matched)
+	if query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+	}
+
+	page := &PaymentPage{Total: len(matched)}
+	for _, position := range matched[start:end] {
+		page.Payments = append(page.Payments, *s.payments[position])
+	}
+	if end < len(matched) && end > start {
+		page.NextCursor = encodeCursor(s.payments[matched[end-1]].ID)
+	}
+	return page, nil
+}
+
+// candidates возвращает позиции платежей, которые могут подойти под запрос, в порядке создания
+func (s *Service) candidates(query PaymentQuery) []int {
+	s.refreshIndex()
+
+	if query.AccountID != 0 {
+		return s.index.byAccount[query.AccountID]
+	}
+	if len(query.Categories) > 0 {
+		var positions []int
+		seen := make(map[types.PaymentCategory]bool)
+		for _, category := range query.Categories {
+			if seen[category] {
+				continue
+			}
+			seen[category] = true
+			positions = append(positions, s.index.byCategory[category]...)
+		}
+		sort.Ints(positions)
+		return positions
+	}
+
+	positions := make([]int, len(s.payments))
+	for i := range positions {
+		positions[i] = i
+	}
+	return positions
+}
+
+// matches проверяет платёж на соответствие условиям запроса
+func (query PaymentQuery) matches(payment *types.Payment) bool {
+	if query.AccountID != 0 && payment.AccountID != query.AccountID {
+		return false
+	}
+	if len(query.Categories) > 0 && !containsCategory(query.Categories, payment.Category) {
+		return false
+	}
+	if len(query.Statuses) > 0 && !containsStatus(query.Statuses, payment.Status) {
+		return false
+	}
+	if query.MinAmount > 0 && payment.Amount < query.MinAmount {
+		return false
+	}
+	if query.MaxAmount > 0 && payment.Amount > query.MaxAmount {
+		return false
+	}
+	if !query.From.IsZero() && payment.Created.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !payment.Created.Before(query.To) {
+		return false
+	}
+	if query.CategoryContains != "" &&
+		!strings.Contains(strings.ToLower(string(payment.Category)), strings.ToLower(query.CategoryContains)) {
+		return false
+	}
+	return true
+}
+
+func containsCategory(categories []types.PaymentCategory, category types.PaymentCategory) bool {
+	for _, v := range categories {
+		if v == category {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(statuses []types.PaymentStatus, status types.PaymentStatus) bool {
+	for _, v := range statuses {
+		if v == status {
+			return true
+		}
+	}
+	return false
+}
+
+// sortFields сравнивает платежи по полю: -1, 0 или 1
+var sortFields = map[SortField]func(a, b *types.Payment) int{
+	SortByCreated: func(a, b *types.Payment) int {
+		switch {
+		case a.Created.Before(b.Created):
+			return -1
+		case a.Created.After(b.Created):
+			return 1
+		}
+		return 0
+	},
+	SortByAmount: func(a, b *types.Payment) int {
+		return compareInt64(int64(a.Amount), int64(b.Amount))
+	},
+	SortByCategory: func(a, b *types.Payment) int {
+		return strings.Compare(string(a.Category), string(b.Category))
+	},
+	SortByStatus: func(a, b *types.Payment) int {
+		return strings.Compare(string(a.Status), string(b.Status))
+	},
+	SortByAccountID: func(a, b *types.Payment) int {
+		return compareInt64(a.AccountID, b.AccountID)
+	},
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// lessPayment сравнивает платежи на позициях a и b по ключам, при равенстве - по порядку создания
+func (s *Service) lessPayment(keys []SortKey, a, b int) bool {
+	for _, key := range keys {
+		cmp := sortFields[key.Field](s.payments[a], s.payments[b])
+		if key.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return a < b
+}
+
+func encodeCursor(paymentID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(paymentID))
+}
+
+// decodeCursor возвращает позицию платежа, на котором закончилась предыдущая страница
+func (s *Service) decodeCursor(cursor string) (int, error) {
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	for position, payment := range s.payments {
+		if payment.ID == string(id) {
+			return position, nil
+		}
+	}
+	return 0, ErrInvalidCursor
+}
@@ -0,0 +1,109 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func queryService(t *testing.T) (*Service, *types.Account) {
+	t.Helper()
+	svc := &Service{}
+	now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	})
+	account, _ := svc.RegisterAccount("+992000000001")
+	other, _ := svc.RegisterAccount("+992000000002")
+	svc.Deposit(account.ID, 1_000_00)
+	svc.Deposit(other.ID, 1_000_00)
+
+	categories := []types.PaymentCategory{"Cafe", "auto", "Cafe-bar", "food"}
+	for i := 1; i <= 20; i++ {
+		if _, err := svc.Pay(account.ID, types.Money(i*100), categories[i%len(categories)]); err != nil {
+			t.Fatalf("Pay(): error = %v", err)
+		}
+	}
+	svc.Pay(other.ID, 100, "Cafe")
+	return svc, account
+}
+
+func TestService_QueryPayments_filters(t *testing.T) {
+	svc, account := queryService(t)
+	svc.Reject(svc.payments[3].ID)
+
+	page, err := svc.QueryPayments(PaymentQuery{
+		AccountID:  account.ID,
+		Categories: []types.PaymentCategory{"Cafe", "auto"},
+		Statuses:   []types.PaymentStatus{types.PaymentStatusInProgress},
+		MinAmount:  300,
+		MaxAmount:  1_700,
+	})
+	if err != nil {
+		t.Fatalf("QueryPayments(): error = %v", err)
+	}
+	// Cafe: 400, 800, 1200, 1600; auto: 500, 900, 1300, 1700 (400 отменён)
+	if page.Total != 7 {
+		t.Errorf("got > %v want > 7: %v", page.Total, page.Payments)
+	}
+
+	page, _ = svc.QueryPayments(PaymentQuery{CategoryContains: "cafe"})
+	if page.Total != 11 {
+		t.Errorf("text match: got > %v want > 11", page.Total)
+	}
+
+	page, _ = svc.QueryPayments(PaymentQuery{From: svc.payments[5].Created, To: svc.payments[7].Created})
+	if page.Total != 2 || page.Payments[0].ID != svc.payments[5].ID {
+		t.Errorf("time range: got > %v", page.Payments)
+	}
+}
+
+func TestService_QueryPayments_pagination(t *testing.T) {
+	svc, account := queryService(t)
+	query := PaymentQuery{
+		AccountID: account.ID,
+		Sort:      []SortKey{{Field: SortByAmount, Desc: true}},
+		Limit:     6,
+	}
+
+	var amounts []types.Money
+	for {
+		page, err := svc.QueryPayments(query)
+		if err != nil {
+			t.Fatalf("QueryPayments(): error = %v", err)
+		}
+		for _, payment := range page.Payments {
+			amounts = append(amounts, payment.Amount)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if len(amounts) != 20 {
+		t.Fatalf("got %v payments, want 20", len(amounts))
+	}
+	for i, amount := range amounts {
+		if amount != types.Money((20-i)*100) {
+			t.Fatalf("wrong order at %v: %v", i, amounts)
+		}
+	}
+
+	page, _ := svc.QueryPayments(PaymentQuery{AccountID: account.ID, Offset: 18, Limit: 5})
+	if len(page.Payments) != 2 || page.NextCursor != "" {
+		t.Errorf("offset page: got %v payments, cursor %q", len(page.Payments), page.NextCursor)
+	}
+}
+
+func TestService_QueryPayments_errors(t *testing.T) {
+	svc, _ := queryService(t)
+	if _, err := svc.QueryPayments(PaymentQuery{Cursor: "bm90LWZvdW5k"}); err != ErrInvalidCursor {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidCursor)
+	}
+	if _, err := svc.QueryPayments(PaymentQuery{Sort: []SortKey{{Field: "phone"}}}); err != ErrInvalidSortField {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidSortField)
+	}
+}
@@ -0,0 +1,360 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки программы лояльности
+var ErrInvalidRewardRule = errors.New("invalid reward rule")
+var ErrPaymentNotInProgress = errors.New("payment is not in progress")
+
+// RewardBalance баллы и кэшбэк аккаунта с историей начислений
+type RewardBalance struct {
+	AccountID int64
+	Points    int64
+	Cashback  types.Money
+	History   []types.Reward
+}
+
+// SetRewardRules задаёт правила кэшбэка и баллов. К подтверждённому платежу применяются
+// все подходящие правила. Пустое Name заменяется на вид начисления и категорию
+func (s *Service) SetRewardRules(rules []types.RewardRule) error {
+	checked := make([]types.RewardRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := checkRewardRule(rule); err != nil {
+			return err
+		}
+		if rule.Name == "" {
+			rule.Name = string(rule.Kind)
+			if rule.Category != "" {
+				rule.Name += ":" + string(rule.Category)
+			}
+		}
+		checked = append(checked, rule)
+	}
+
+	before := AuditState{RewardRules: s.RewardRules()}
+	s.rewardRules = checked
+	s.audit(AuditSetRewardRules, before, AuditState{RewardRules: s.RewardRules()})
+	return nil
+}
+
+// RewardRules возвращает действующие правила начислений
+func (s *Service) RewardRules() []types.RewardRule {
+	return append([]types.RewardRule{}, s.rewardRules...)
+}
+
+func checkRewardRule(rule types.RewardRule) error {
+	if rule.Kind != types.RewardCashback && rule.Kind != types.RewardPoints {
+		return ErrInvalidRewardRule
+	}
+	if strings.ContainsAny(rule.Name, ";\r\n") {
+		return ErrInvalidRewardRule
+	}
+	if rule.BasisPoints <= 0 || rule.Kind == types.RewardCashback && rule.BasisPoints > basisPointsDivisor {
+		return ErrInvalidRewardRule
+	}
+	if rule.Period != "" && !validPeriod(rule.Period) {
+		return ErrInvalidRewardRule
+	}
+	// лимит без периода не с чем сравнивать
+	if rule.Cap < 0 || rule.Cap > 0 && rule.Period == "" {
+		return ErrInvalidRewardRule
+	}
+	return nil
+}
+
+// Confirm переводит платёж в статус OK и начисляет по нему кэшбэк и баллы
+func (s *Service) Confirm(paymentID string) error {
+	payment, err := s.FindPaymentByID(paymentID)
+	if err != nil {
+		return err
+	}
+	if payment.Status != types.PaymentStatusInProgress {
+		return ErrPaymentNotInProgress
+	}
+	account, err := s.FindAccountByID(payment.AccountID)
+	if err != nil {
+		return err
+	}
+
+	before := AuditState{Account: auditAccount(account), Payment: auditPayment(payment)}
+	payment.Status = types.PaymentStatusOk
+	var rewards []types.Reward
+	for _, reward := range s.rewardsFor(account, payment) {
+		s.applyReward(account, reward)
+		rewards = append(rewards, *reward)
+	}
+
+	s.audit(AuditConfirm, before, AuditState{Account: auditAccount(account), Payment: auditPayment(payment), Rewards: rewards},
+		accountTarget(account.ID), paymentTarget(payment.ID))
+	s.publish(PaymentConfirmed{EventHeader: s.header(EventPaymentConfirmed, account.ID), Payment: *payment, Rewards: rewards, Balance: account.Balance})
+	return nil
+}
+
+// Rewards возвращает баланс баллов, сумму действующего кэшбэка и историю начислений аккаунта
+func (s *Service) Rewards(accountID int64) (*RewardBalance, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	balance := &RewardBalance{AccountID: accountID, History: []types.Reward{}}
+	for _, reward := range s.rewards {
+		if reward.AccountID != accountID {
+			continue
+		}
+		balance.History = append(balance.History, *reward)
+		if reward.Reversed {
+			continue
+		}
+		if reward.Kind == types.RewardPoints {
+			balance.Points += reward.Amount
+		} else {
+			balance.Cashback += types.Money(reward.Amount)
+		}
+	}
+	return balance, nil
+}
+
+// rewardsFor рассчитывает начисления за платёж с учётом лимитов правил за период.
+// Кэшбэк урезается так, чтобы баланс не превысил MaxBalance уровня аккаунта
+func (s *Service) rewardsFor(account *types.Account, payment *types.Payment) []*types.Reward {
+	now := s.now()
+	policy, _ := s.TierPolicy(account.Tier)
+	balance := account.Balance
+	var rewards []*types.Reward
+	for _, rule := range s.rewardRules {
+		if rule.Category != "" && s.categoryKey(rule.Category) != s.categoryKey(payment.Category) {
+			continue
+		}
+		amount := int64(payment.Amount) * rule.BasisPoints / basisPointsDivisor
+		if rule.Cap > 0 {
+			start, _ := periodBounds(rule.Period, now)
+			if left := rule.Cap - s.rewarded(payment.AccountID, rule.Name, start); amount > left {
+				amount = left
+			}
+		}
+		if rule.Kind == types.RewardCashback && policy.MaxBalance > 0 {
+			if left := int64(policy.MaxBalance - balance); amount > left {
+				amount = left
+			}
+			balance += types.Money(amount)
+		}
+		if amount <= 0 {
+			continue
+		}
+		rewards = append(rewards, &types.Reward{
+			ID:        uuid.New().String(),
+			AccountID: payment.AccountID,
+			PaymentID: payment.ID,
+			Rule:      rule.Name,
+			Kind:      rule.Kind,
+			Amount:    amount,
+			Created:   now,
+		})
+	}
+	return rewards
+}
+
+// rewarded сумма неотменённых начислений аккаунта по правилу начиная с since
+func (s *Service) rewarded(accountID int64, rule string, since time.Time) int64 {
+	total := int64(0)
+	for _, reward := range s.rewards {
+		if reward.AccountID == accountID && reward.Rule == rule && !reward.Reversed && !reward.Created.Before(since) {
+			total += reward.Amount
+		}
+	}
+	return total
+}
+
+func (s *Service) applyReward(account *types.Account, reward *types.Reward) {
+	s.rewards = append(s.rewards, reward)
+	if reward.Kind == types.RewardCashback {
+		account.Balance += types.Money(reward.Amount)
+		s.record(account.ID, types.EntryCashback, types.Money(reward.Amount), reward.PaymentID, "")
+	}
+}
+
+// reverseRewards списывает начисления за отменённый платёж. Кэшбэк списывается
+// со счёта даже если он уже потрачен, баланс при этом может стать отрицательным
+func (s *Service) reverseRewards(account *types.Account, payment *types.Payment) {
+	for _, reward := range s.rewards {
+		if reward.PaymentID != payment.ID || reward.Reversed {
+			continue
+		}
+		reward.Reversed = true
+		if reward.Kind == types.RewardCashback {
+			account.Balance -= types.Money(reward.Amount)
+			s.record(account.ID, types.EntryCashbackOut, -types.Money(reward.Amount), reward.PaymentID, "")
+		}
+	}
+}
+
+func validPeriod(period types.Period) bool {
+	return period == types.PeriodDay || period == types.PeriodWeek || period == types.PeriodMonth
+}
+
+// periodBounds возвращает начало и конец (не включительно) периода, в который попадает t
+func periodBounds(period types.Period, t time.Time) (time.Time, time.Time) {
+	year, month, day := t.Date()
+	switch period {
+	case types.PeriodDay:
+		start := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 1)
+	case types.PeriodWeek:
+		// неделя начинается с понедельника
+		offset := (int(t.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 7)
+	default:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// exportRewardRules сохраняет правила начислений в reward_rules.dump
+func (s *Service) exportRewardRules(dir string) error {
+	rows := make([][]string, 0, len(s.rewardRules))
+	for _, rule := range s.rewardRules {
+		rows = append(rows, []string{
+			encodeField(rule.Name),
+			string(rule.Kind),
+			encodeField(string(rule.Category)),
+			strconv.FormatInt(rule.BasisPoints, 10),
+			strconv.FormatInt(rule.Cap, 10),
+			string(rule.Period),
+		})
+	}
+	return writeDump(filepath.Join(dir, "reward_rules.dump"), rows)
+}
+
+// importRewardRules заменяет правила начислений правилами из reward_rules.dump, если они там есть
+func (s *Service) importRewardRules(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "reward_rules.dump"))
+	if err != nil {
+		return err
+	}
+	if rows == nil {
+		return nil
+	}
+
+	rules := make([]types.RewardRule, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 6 {
+			return ErrInvalidDump
+		}
+		name, err := decodeField(row[0])
+		if err != nil {
+			return err
+		}
+		category, err := decodeField(row[2])
+		if err != nil {
+			return err
+		}
+		basisPoints, err := strconv.ParseInt(row[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		limit, err := strconv.ParseInt(row[4], 10, 64)
+		if err != nil {
+			return err
+		}
+		rule := types.RewardRule{
+			Name:        name,
+			Kind:        types.RewardKind(row[1]),
+			Category:    types.PaymentCategory(category),
+			BasisPoints: basisPoints,
+			Cap:         limit,
+			Period:      types.Period(row[5]),
+		}
+		if err := checkRewardRule(rule); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	s.rewardRules = rules
+	return nil
+}
+
+func (s *Service) exportRewards(dir string) error {
+	if len(s.rewards) == 0 {
+		return nil
+	}
+
+	rows := make([][]string, 0, len(s.rewards))
+	for _, v := range s.rewards {
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.AccountID, 10),
+			v.PaymentID,
+			v.Rule,
+			string(v.Kind),
+			strconv.FormatInt(v.Amount, 10),
+			formatTime(v.Created),
+			strconv.FormatBool(v.Reversed),
+		})
+	}
+	return writeDump(filepath.Join(dir, "rewards.dump"), rows)
+}
+
+func (s *Service) importRewards(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "rewards.dump"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 8 {
+			return ErrInvalidDump
+		}
+		accountID, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(row[5], 10, 64)
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[6])
+		if err != nil {
+			return err
+		}
+		reversed, err := strconv.ParseBool(row[7])
+		if err != nil {
+			return err
+		}
+
+		reward := &types.Reward{
+			ID:        row[0],
+			AccountID: accountID,
+			PaymentID: row[2],
+			Rule:      row[3],
+			Kind:      types.RewardKind(row[4]),
+			Amount:    amount,
+			Created:   created,
+			Reversed:  reversed,
+		}
+		if existing := s.findReward(reward.ID); existing != nil {
+			*existing = *reward
+			continue
+		}
+		s.rewards = append(s.rewards, reward)
+	}
+	return nil
+}
+
+func (s *Service) findReward(rewardID string) *types.Reward {
+	for _, reward := range s.rewards {
+		if reward.ID == rewardID {
+			return reward
+		}
+	}
+	return nil
+}
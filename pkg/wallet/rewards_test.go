@@ -0,0 +1,238 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// testRewardRules 5% кэшбэка на кафе, не больше 10 сомони в месяц, и 1 балл за каждый сомони любых платежей
+var testRewardRules = []types.RewardRule{
+	{Kind: types.RewardCashback, Category: "cafe", BasisPoints: 500, Cap: 10_00, Period: types.PeriodMonth},
+	{Kind: types.RewardPoints, BasisPoints: 100},
+}
+
+func TestService_SetRewardRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule types.RewardRule
+		want error
+	}{
+		{"valid", types.RewardRule{Kind: types.RewardCashback, BasisPoints: 100, Cap: 5_00, Period: types.PeriodWeek}, nil},
+		{"unknown kind", types.RewardRule{Kind: "BONUS", BasisPoints: 100}, ErrInvalidRewardRule},
+		{"zero rate", types.RewardRule{Kind: types.RewardPoints}, ErrInvalidRewardRule},
+		{"cashback over 100 percent", types.RewardRule{Kind: types.RewardCashback, BasisPoints: 10_001}, ErrInvalidRewardRule},
+		{"cap without period", types.RewardRule{Kind: types.RewardCashback, BasisPoints: 100, Cap: 5_00}, ErrInvalidRewardRule},
+		{"unknown period", types.RewardRule{Kind: types.RewardPoints, BasisPoints: 100, Period: "YEAR"}, ErrInvalidRewardRule},
+		{"separator in name", types.RewardRule{Name: "a;b", Kind: types.RewardPoints, BasisPoints: 100}, ErrInvalidRewardRule},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &Service{}
+			if err := svc.SetRewardRules([]types.RewardRule{test.rule}); err != test.want {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestService_SetRewardRules_audit(t *testing.T) {
+	svc := &Service{}
+	operator := Actor{ID: "aziz", Role: "operator"}
+	if err := svc.As(operator).SetRewardRules(testRewardRules); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetRewardRules([]types.RewardRule{{Kind: "BONUS"}}); err != ErrInvalidRewardRule {
+		t.Fatalf("error = %v, want %v", err, ErrInvalidRewardRule)
+	}
+	if err := svc.SetRewardRules(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	records := svc.AuditLog(AuditQuery{Action: AuditSetRewardRules})
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].Actor != operator || len(records[0].Before.RewardRules) != 0 || records[0].After.RewardRules[0].Name != "CASHBACK:cafe" {
+		t.Errorf("first record = %+v", records[0])
+	}
+	if len(records[1].Before.RewardRules) != len(testRewardRules) || len(records[1].After.RewardRules) != 0 {
+		t.Errorf("second record = %+v", records[1])
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	// 2024-05-15 - среда
+	now := time.Date(2024, 5, 15, 13, 30, 0, 0, time.UTC)
+	tests := []struct {
+		period     types.Period
+		start, end time.Time
+	}{
+		{types.PeriodDay, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{types.PeriodWeek, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{types.PeriodMonth, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(string(test.period), func(t *testing.T) {
+			start, end := periodBounds(test.period, now)
+			if !start.Equal(test.start) || !end.Equal(test.end) {
+				t.Errorf("bounds = %v - %v, want %v - %v", start, end, test.start, test.end)
+			}
+		})
+	}
+}
+
+func TestService_Confirm(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	svc := &Service{clock: func() time.Time { return now }}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	if err := svc.SetRewardRules(testRewardRules); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := svc.Pay(account.ID, 150_00, "cafe")
+	if err := svc.Confirm(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != types.PaymentStatusOk {
+		t.Errorf("status = %v, want %v", first.Status, types.PaymentStatusOk)
+	}
+	if err := svc.Confirm(first.ID); err != ErrPaymentNotInProgress {
+		t.Errorf("error = %v, want %v", err, ErrPaymentNotInProgress)
+	}
+
+	// от месячного лимита осталось 2.50
+	second, _ := svc.Pay(account.ID, 100_00, "cafe")
+	svc.Confirm(second.ID)
+	balance, err := svc.Rewards(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cashback != 10_00 || balance.Points != 250_00/100 {
+		t.Errorf("rewards = %+v", balance)
+	}
+	if account.Balance != 1_000_00-250_00+10_00 {
+		t.Errorf("balance = %v, want %v", account.Balance, 1_000_00-250_00+10_00)
+	}
+
+	if err := svc.Reject(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	balance, _ = svc.Rewards(account.ID)
+	if balance.Cashback != 2_50 || balance.Points != 100 || len(balance.History) != 4 {
+		t.Errorf("rewards after reject = %+v", balance)
+	}
+	if account.Balance != 1_000_00-100_00+2_50 {
+		t.Errorf("balance after reject = %v, want %v", account.Balance, 1_000_00-100_00+2_50)
+	}
+
+	// отмена освободила лимит, а в новом месяце он начинается заново
+	now = now.AddDate(0, 1, 0)
+	third, _ := svc.Pay(account.ID, 300_00, "cafe")
+	svc.Confirm(third.ID)
+	balance, _ = svc.Rewards(account.ID)
+	if balance.Cashback != 12_50 {
+		t.Errorf("cashback next month = %v, want %v", balance.Cashback, 12_50)
+	}
+
+	rejected, _ := svc.Pay(account.ID, 1_00, "shop")
+	svc.Reject(rejected.ID)
+	if err := svc.Confirm(rejected.ID); err != ErrPaymentNotInProgress {
+		t.Errorf("error = %v, want %v", err, ErrPaymentNotInProgress)
+	}
+}
+
+func TestService_Confirm_cashbackTierLimit(t *testing.T) {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	limit := DefaultTierPolicies[types.TierAnonymous].MaxBalance
+	svc.Deposit(account.ID, limit)
+	rules := []types.RewardRule{{Kind: types.RewardCashback, BasisPoints: 1000}, {Kind: types.RewardPoints, BasisPoints: 100}}
+	if err := svc.SetRewardRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := svc.Pay(account.ID, 200_00, "cafe")
+	second, _ := svc.Pay(account.ID, 100_00, "cafe")
+	svc.Deposit(account.ID, 295_00)
+	// кэшбэк 20 сомони урезан до 5, чтобы баланс не превысил лимит уровня
+	if err := svc.Confirm(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != limit {
+		t.Errorf("balance = %v, want %v", account.Balance, limit)
+	}
+	// на лимите кэшбэк не начисляется, баллы начисляются
+	if err := svc.Confirm(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	balance, _ := svc.Rewards(account.ID)
+	if balance.Cashback != 5_00 || balance.Points != 300_00/100 || len(balance.History) != 3 {
+		t.Errorf("rewards = %+v", balance)
+	}
+	if account.Balance != limit {
+		t.Errorf("balance after second confirm = %v, want %v", account.Balance, limit)
+	}
+}
+
+func TestService_Rewards_exportImportAndRebuild(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	store := &EventStore{}
+	bus := NewEventBus()
+	bus.Subscribe(store.Append, SubscribeOptions{})
+	svc.SetEventBus(bus)
+	if err := svc.SetRewardRules(testRewardRules); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	first, _ := svc.Pay(account.ID, 100_00, "cafe")
+	second, _ := svc.Pay(account.ID, 50_00, "shop")
+	svc.Confirm(first.ID)
+	svc.Confirm(second.ID)
+	svc.Reject(second.ID)
+
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := Rebuild(store.Events())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := svc.Rewards(account.ID)
+	for name, got := range map[string]*Service{"imported": restored, "rebuilt": rebuilt} {
+		balance, err := got.Rewards(account.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance.Points != want.Points || balance.Cashback != want.Cashback || len(balance.History) != len(want.History) {
+			t.Errorf("%s rewards = %+v, want %+v", name, balance, want)
+		}
+		for i := range balance.History {
+			if balance.History[i].Reversed != want.History[i].Reversed || balance.History[i].ID != want.History[i].ID {
+				t.Errorf("%s reward %d = %+v, want %+v", name, i, balance.History[i], want.History[i])
+			}
+		}
+		gotAccount, _ := got.FindAccountByID(account.ID)
+		if gotAccount.Balance != account.Balance {
+			t.Errorf("%s balance = %v, want %v", name, gotAccount.Balance, account.Balance)
+		}
+		payment, _ := got.FindPaymentByID(first.ID)
+		if payment.Status != types.PaymentStatusOk {
+			t.Errorf("%s status = %v, want %v", name, payment.Status, types.PaymentStatusOk)
+		}
+	}
+	if got, want := restored.RewardRules(), svc.RewardRules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported reward rules = %+v, want %+v", got, want)
+	}
+}
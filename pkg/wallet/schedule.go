@@ -0,0 +1,453 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки расписаний
+var ErrScheduleNotFound = errors.New("schedule not found")
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ScheduleRetry повторы платежа по расписанию при нехватке средств или превышении лимитов
+type ScheduleRetry struct {
+	MaxAttempts int           // попыток на одно срабатывание, включая первую
+	Interval    time.Duration // пауза между попытками
+}
+
+// DefaultScheduleRetry политика повторов по умолчанию
+var DefaultScheduleRetry = ScheduleRetry{MaxAttempts: 3, Interval: time.Hour}
+
+// SchedulerActor исполнитель платежей по расписанию в журнале аудита
+var SchedulerActor = Actor{ID: "scheduler", Role: "system"}
+
+// SetScheduleRetry задаёт политику повторов для всех расписаний
+func (s *Service) SetScheduleRetry(retry ScheduleRetry) {
+	s.scheduleRetry = &retry
+}
+
+func (s *Service) retryPolicy() ScheduleRetry {
+	if s.scheduleRetry == nil {
+		return DefaultScheduleRetry
+	}
+	return *s.scheduleRetry
+}
+
+// ScheduleFavorite создаёт расписание платежей из Избранного: однократно в момент start
+// или ежедневно, еженедельно, ежемесячно начиная с start; нулевой start - сейчас.
+// Ежемесячный платёж на 29-31 число в коротких месяцах выполняется в последний день месяца
+func (s *Service) ScheduleFavorite(favoriteID string, kind types.ScheduleKind, start time.Time) (*types.Schedule, error) {
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case types.ScheduleOnce, types.ScheduleDaily, types.ScheduleWeekly, types.ScheduleMonthly:
+	default:
+		return nil, ErrInvalidSchedule
+	}
+	if start.IsZero() {
+		start = s.now()
+	}
+
+	schedule := &types.Schedule{
+		ID:         uuid.New().String(),
+		FavoriteID: favoriteID,
+		Kind:       kind,
+		Start:      start,
+		NextRun:    start,
+		Due:        start,
+		Active:     true,
+	}
+	s.schedules = append(s.schedules, schedule)
+	s.auditSchedule(AuditScheduleFavorite, favorite, nil, schedule)
+	return schedule, nil
+}
+
+// ScheduleFavoriteCron создаёт расписание по cron-выражению "минута час день месяц день_недели"
+// в часовом поясе часов сервиса
+func (s *Service) ScheduleFavoriteCron(favoriteID string, expr string) (*types.Schedule, error) {
+	favorite, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, err
+	}
+	cron, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	next := cron.next(now)
+	if next.IsZero() {
+		return nil, ErrInvalidCron
+	}
+
+	schedule := &types.Schedule{
+		ID:         uuid.New().String(),
+		FavoriteID: favoriteID,
+		Kind:       types.ScheduleCron,
+		Start:      now,
+		Cron:       expr,
+		NextRun:    next,
+		Due:        next,
+		Active:     true,
+	}
+	s.schedules = append(s.schedules, schedule)
+	s.auditSchedule(AuditScheduleFavorite, favorite, nil, schedule)
+	return schedule, nil
+}
+
+// FindScheduleByID ищет расписание по ID
+func (s *Service) FindScheduleByID(scheduleID string) (*types.Schedule, error) {
+	for _, schedule := range s.schedules {
+		if schedule.ID == scheduleID {
+			return schedule, nil
+		}
+	}
+	return nil, ErrScheduleNotFound
+}
+
+// Schedules возвращает расписания избранного платежа, пустой favoriteID - все расписания
+func (s *Service) Schedules(favoriteID string) []types.Schedule {
+	var schedules []types.Schedule
+	for _, schedule := range s.schedules {
+		if favoriteID == "" || schedule.FavoriteID == favoriteID {
+			schedules = append(schedules, *schedule)
+		}
+	}
+	return schedules
+}
+
+// CancelSchedule отключает расписание, история выполнений сохраняется
+func (s *Service) CancelSchedule(scheduleID string) error {
+	schedule, err := s.FindScheduleByID(scheduleID)
+	if err != nil {
+		return err
+	}
+	if !schedule.Active {
+		return nil
+	}
+
+	before := *schedule
+	deactivate(schedule)
+	favorite, _ := s.FindFavoriteByID(schedule.FavoriteID)
+	s.auditSchedule(AuditCancelSchedule, favorite, &before, schedule)
+	return nil
+}
+
+// auditSchedule записывает изменение расписания; favorite может быть nil, если избранное уже удалено
+func (s *Service) auditSchedule(action AuditAction, favorite *types.Favorite, before *types.Schedule, schedule *types.Schedule) {
+	after := *schedule
+	targets := []string{favoriteTarget(schedule.FavoriteID), scheduleTarget(schedule.ID)}
+	if favorite != nil {
+		targets = append([]string{accountTarget(favorite.AccountID)}, targets...)
+	}
+	s.audit(action, AuditState{Schedule: before}, AuditState{Schedule: &after}, targets...)
+}
+
+// ScheduleRuns возвращает историю выполнений расписания, пустой scheduleID - всех расписаний
+func (s *Service) ScheduleRuns(scheduleID string) []types.ScheduleRun {
+	var runs []types.ScheduleRun
+	for _, run := range s.scheduleRuns {
+		if scheduleID == "" || run.ScheduleID == scheduleID {
+			runs = append(runs, *run)
+		}
+	}
+	return runs
+}
+
+// RunDueSchedules выполняет через PayFromFavorite все активные расписания, время которых
+// наступило, и возвращает записи о выполнении. Пропущенные срабатывания не навёрстываются:
+// после выполнения следующий запуск назначается на ближайшее срабатывание в будущем
+func (s *Service) RunDueSchedules() []types.ScheduleRun {
+	now := s.now()
+	var runs []types.ScheduleRun
+	for _, schedule := range s.schedules {
+		if schedule.Active && !schedule.NextRun.After(now) {
+			runs = append(runs, s.runSchedule(schedule, now))
+		}
+	}
+	return runs
+}
+
+func (s *Service) runSchedule(schedule *types.Schedule, now time.Time) types.ScheduleRun {
+	schedule.Attempts++
+	run := &types.ScheduleRun{
+		ScheduleID: schedule.ID,
+		FavoriteID: schedule.FavoriteID,
+		Due:        schedule.Due,
+		Executed:   now,
+		Attempt:    schedule.Attempts,
+	}
+
+	payment, err := s.As(SchedulerActor).PayFromFavorite(schedule.FavoriteID)
+	switch {
+	case err == nil:
+		run.Status = types.ScheduleRunOK
+		run.PaymentID = payment.ID
+		s.advanceSchedule(schedule, now)
+
+	case errors.Is(err, ErrFavoriteNotFound) || errors.Is(err, ErrAccountNotFound):
+		run.Status = types.ScheduleRunFailed
+		deactivate(schedule)
+
+	default:
+		run.Status = types.ScheduleRunFailed
+		retry := s.retryPolicy()
+		retryAt := now.Add(retry.Interval)
+		next := nextOccurrence(schedule, now)
+		if retryableScheduleError(err) && schedule.Attempts < retry.MaxAttempts && (next.IsZero() || retryAt.Before(next)) {
+			run.Status = types.ScheduleRunRetry
+			schedule.NextRun = retryAt
+		} else {
+			s.advanceSchedule(schedule, now)
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	s.scheduleRuns = append(s.scheduleRuns, run)
+	return *run
+}
+
+// retryableScheduleError ошибки, которые могут пройти со временем
+func retryableScheduleError(err error) bool {
+	return errors.Is(err, ErrNotEnoughtBalance) ||
+		errors.Is(err, ErrBalanceLimitExceeded) ||
+		errors.Is(err, ErrPaymentLimitExceeded) ||
+		errors.Is(err, ErrTurnoverLimitExceeded)
+}
+
+// advanceSchedule назначает следующее срабатывание после now или отключает расписание
+func (s *Service) advanceSchedule(schedule *types.Schedule, now time.Time) {
+	schedule.Attempts = 0
+	next := nextOccurrence(schedule, now)
+	if next.IsZero() {
+		deactivate(schedule)
+		return
+	}
+	schedule.NextRun = next
+	schedule.Due = next
+}
+
+func deactivate(schedule *types.Schedule) {
+	schedule.Active = false
+	schedule.NextRun = time.Time{}
+	schedule.Attempts = 0
+}
+
+// nextOccurrence первое срабатывание расписания строго после after, нулевое время - больше нет
+func nextOccurrence(schedule *types.Schedule, after time.Time) time.Time {
+	start := schedule.Start
+	var occurrence func(k int) time.Time
+	k := 0
+	switch schedule.Kind {
+	case types.ScheduleOnce:
+		if start.After(after) {
+			return start
+		}
+		return time.Time{}
+	case types.ScheduleDaily:
+		occurrence = func(k int) time.Time { return start.AddDate(0, 0, k) }
+		k = int(after.Sub(start).Hours()/24) - 1
+	case types.ScheduleWeekly:
+		occurrence = func(k int) time.Time { return start.AddDate(0, 0, 7*k) }
+		k = int(after.Sub(start).Hours()/(24*7)) - 1
+	case types.ScheduleMonthly:
+		occurrence = func(k int) time.Time { return addMonthsClamped(start, k) }
+		k = (after.Year()-start.Year())*12 + int(after.Month()-start.Month()) - 1
+	case types.ScheduleCron:
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		return cron.next(after.In(start.Location()))
+	default:
+		return time.Time{}
+	}
+
+	if k < 0 {
+		k = 0
+	}
+	for {
+		if t := occurrence(k); t.After(after) {
+			return t
+		}
+		k++
+	}
+}
+
+// addMonthsClamped прибавляет months месяцев, не перескакивая через конец месяца
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := t.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// Scheduler периодически выполняет платежи по расписанию. wallet.Service не потокобезопасен,
+// поэтому вызовы выполняются под той же блокировкой, что и остальные обращения к сервису
+type Scheduler struct {
+	svc      *Service
+	mu       sync.Locker
+	interval time.Duration
+}
+
+// NewScheduler создаёт планировщик, проверяющий расписания каждые interval
+func NewScheduler(svc *Service, mu sync.Locker, interval time.Duration) *Scheduler {
+	if mu == nil {
+		mu = &sync.Mutex{}
+	}
+	return &Scheduler{svc: svc, mu: mu, interval: interval}
+}
+
+// Run проверяет расписания до отмены ctx
+func (sc *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(sc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			sc.mu.Lock()
+			sc.svc.RunDueSchedules()
+			sc.mu.Unlock()
+		}
+	}
+}
+
+func (s *Service) exportSchedules(dir string) error {
+	if len(s.schedules) > 0 {
+		rows := make([][]string, 0, len(s.schedules))
+		for _, v := range s.schedules {
+			rows = append(rows, []string{
+				v.ID,
+				v.FavoriteID,
+				string(v.Kind),
+				formatTime(v.Start),
+				v.Cron,
+				formatTime(v.NextRun),
+				formatTime(v.Due),
+				strconv.Itoa(v.Attempts),
+				strconv.FormatBool(v.Active),
+			})
+		}
+		if err := writeDump(filepath.Join(dir, "schedules.dump"), rows); err != nil {
+			return err
+		}
+	}
+
+	if len(s.scheduleRuns) > 0 {
+		rows := make([][]string, 0, len(s.scheduleRuns))
+		for _, v := range s.scheduleRuns {
+			rows = append(rows, []string{
+				v.ScheduleID,
+				v.FavoriteID,
+				formatTime(v.Due),
+				formatTime(v.Executed),
+				strconv.Itoa(v.Attempt),
+				string(v.Status),
+				v.PaymentID,
+				encodeField(v.Error),
+			})
+		}
+		if err := writeDump(filepath.Join(dir, "schedule_runs.dump"), rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) importSchedules(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "schedules.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 9 {
+			return ErrInvalidDump
+		}
+		schedule := &types.Schedule{
+			ID:         row[0],
+			FavoriteID: row[1],
+			Kind:       types.ScheduleKind(row[2]),
+			Cron:       row[4],
+		}
+		if schedule.Start, err = parseTime(row[3]); err != nil {
+			return err
+		}
+		if schedule.NextRun, err = parseTime(row[5]); err != nil {
+			return err
+		}
+		if schedule.Due, err = parseTime(row[6]); err != nil {
+			return err
+		}
+		if schedule.Attempts, err = strconv.Atoi(row[7]); err != nil {
+			return err
+		}
+		if schedule.Active, err = strconv.ParseBool(row[8]); err != nil {
+			return err
+		}
+
+		if existing, err := s.FindScheduleByID(schedule.ID); err == nil {
+			*existing = *schedule
+			continue
+		}
+		s.schedules = append(s.schedules, schedule)
+	}
+
+	rows, err = readDump(filepath.Join(dir, "schedule_runs.dump"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 8 {
+			return ErrInvalidDump
+		}
+		run := &types.ScheduleRun{
+			ScheduleID: row[0],
+			FavoriteID: row[1],
+			Status:     types.ScheduleRunStatus(row[5]),
+			PaymentID:  row[6],
+		}
+		if run.Error, err = decodeField(row[7]); err != nil {
+			return err
+		}
+		if run.Due, err = parseTime(row[2]); err != nil {
+			return err
+		}
+		if run.Executed, err = parseTime(row[3]); err != nil {
+			return err
+		}
+		if run.Attempt, err = strconv.Atoi(row[4]); err != nil {
+			return err
+		}
+
+		if existing := s.findScheduleRun(run.ScheduleID, run.Due, run.Attempt); existing != nil {
+			*existing = *run
+			continue
+		}
+		s.scheduleRuns = append(s.scheduleRuns, run)
+	}
+	return nil
+}
+
+// findScheduleRun ищет попытку выполнения расписания за срок due
+func (s *Service) findScheduleRun(scheduleID string, due time.Time, attempt int) *types.ScheduleRun {
+	for _, run := range s.scheduleRuns {
+		if run.ScheduleID == scheduleID && run.Due.Equal(due) && run.Attempt == attempt {
+			return run
+		}
+	}
+	return nil
+}
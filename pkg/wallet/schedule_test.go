@@ -0,0 +1,297 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func TestParseCron_next(t *testing.T) {
+	after := time.Date(2021, 3, 15, 10, 20, 0, 0, time.UTC) // понедельник
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 9 1 * *", time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 0 * * 6,7", time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"30 8-10 * * 1-5", time.Date(2021, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		cron, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := cron.next(after); !got.Equal(tt.want) {
+			t.Errorf("parseCron(%q).next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); !errors.Is(err, ErrInvalidCron) {
+			t.Errorf("parseCron(%q) error = %v, want %v", expr, err, ErrInvalidCron)
+		}
+	}
+}
+
+func TestAddMonthsClamped(t *testing.T) {
+	start := time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	want := []time.Time{
+		start,
+		time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 4, 30, 9, 0, 0, 0, time.UTC),
+	}
+	for k, w := range want {
+		if got := addMonthsClamped(start, k); !got.Equal(w) {
+			t.Errorf("addMonthsClamped(%d) = %v, want %v", k, got, w)
+		}
+	}
+}
+
+// scheduledService сервис с аккаунтом, избранным платежом на 100_00 и часами *now
+func scheduledService(t *testing.T, now *time.Time) (*Service, *types.Account, *types.Favorite) {
+	t.Helper()
+	svc := &Service{}
+	svc.SetClock(func() time.Time {
+		return *now
+	})
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 150_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 100_00, "internet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite, err := svc.FavoritePayment(payment.ID, "internet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, account, favorite
+}
+
+func TestService_RunDueSchedules_monthly(t *testing.T) {
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	svc, account, favorite := scheduledService(t, &now)
+	svc.SetScheduleRetry(ScheduleRetry{MaxAttempts: 2, Interval: time.Hour})
+
+	schedule, err := svc.ScheduleFavorite(favorite.ID, types.ScheduleMonthly, time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := svc.RunDueSchedules(); len(runs) != 0 {
+		t.Fatalf("runs before due time: %v", runs)
+	}
+
+	// 1 марта: на счёте 50_00, платёж не проходит и повторяется через час
+	now = time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	runs := svc.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunRetry || runs[0].Error != ErrNotEnoughtBalance.Error() {
+		t.Fatalf("first run = %+v", runs)
+	}
+	if schedule.NextRun != now.Add(time.Hour) {
+		t.Errorf("retry at %v, want %v", schedule.NextRun, now.Add(time.Hour))
+	}
+
+	// вторая попытка последняя: срабатывание пропускается до 1 апреля
+	now = now.Add(time.Hour)
+	runs = svc.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunFailed || runs[0].Attempt != 2 {
+		t.Fatalf("second run = %+v", runs)
+	}
+	april := time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC)
+	if schedule.NextRun != april || schedule.Attempts != 0 {
+		t.Errorf("schedule after failure = %+v", schedule)
+	}
+
+	if err := svc.Deposit(account.ID, 100_00); err != nil {
+		t.Fatal(err)
+	}
+	now = april.Add(time.Minute)
+	runs = svc.RunDueSchedules()
+	if len(runs) != 1 || runs[0].Status != types.ScheduleRunOK || !runs[0].Due.Equal(april) {
+		t.Fatalf("april run = %+v", runs)
+	}
+	if account.Balance != 50_00 {
+		t.Errorf("balance = %v, want 50_00", account.Balance)
+	}
+	records := svc.AuditLog(AuditQuery{Target: paymentTarget(runs[0].PaymentID)})
+	if len(records) != 1 || records[0].Actor != SchedulerActor {
+		t.Errorf("audit records of scheduled payment = %+v", records)
+	}
+
+	if got := svc.ScheduleRuns(schedule.ID); len(got) != 3 {
+		t.Errorf("got %d runs, want 3", len(got))
+	}
+	if schedule.NextRun != time.Date(2021, 5, 1, 9, 0, 0, 0, time.UTC) {
+		t.Errorf("next run = %v", schedule.NextRun)
+	}
+}
+
+func TestService_RunDueSchedules_onceAndMissed(t *testing.T) {
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	svc, _, favorite := scheduledService(t, &now)
+	if err := svc.Deposit(1, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+
+	once, err := svc.ScheduleFavorite(favorite.ID, types.ScheduleOnce, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, err := svc.ScheduleFavorite(favorite.ID, types.ScheduleDaily, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// планировщик не работал три дня: каждое расписание выполняется один раз
+	now = now.AddDate(0, 0, 3).Add(time.Minute)
+	if runs := svc.RunDueSchedules(); len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+	if once.Active {
+		t.Errorf("one-off schedule is still active")
+	}
+	if want := time.Date(2021, 3, 5, 8, 0, 0, 0, time.UTC); daily.NextRun != want {
+		t.Errorf("daily next run = %v, want %v", daily.NextRun, want)
+	}
+	if runs := svc.RunDueSchedules(); len(runs) != 0 {
+		t.Errorf("repeated runs: %v", runs)
+	}
+
+	if err := svc.CancelSchedule(daily.ID); err != nil {
+		t.Fatal(err)
+	}
+	now = now.AddDate(0, 0, 7)
+	if runs := svc.RunDueSchedules(); len(runs) != 0 {
+		t.Errorf("cancelled schedule ran: %v", runs)
+	}
+}
+
+func TestService_ScheduleFavoriteCron(t *testing.T) {
+	now := time.Date(2021, 3, 15, 10, 0, 0, 0, time.UTC)
+	svc, _, favorite := scheduledService(t, &now)
+
+	schedule, err := svc.ScheduleFavoriteCron(favorite.ID, "0 9 1 * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC); schedule.NextRun != want {
+		t.Errorf("next run = %v, want %v", schedule.NextRun, want)
+	}
+	if _, err := svc.ScheduleFavoriteCron(favorite.ID, "0 0 31 2 *"); !errors.Is(err, ErrInvalidCron) {
+		t.Errorf("never firing cron error = %v, want %v", err, ErrInvalidCron)
+	}
+	if _, err := svc.ScheduleFavorite(favorite.ID, types.ScheduleCron, now); err != ErrInvalidSchedule {
+		t.Errorf("cron kind without expression error = %v, want %v", err, ErrInvalidSchedule)
+	}
+	if _, err := svc.ScheduleFavorite("missing", types.ScheduleDaily, now); err != ErrFavoriteNotFound {
+		t.Errorf("missing favorite error = %v, want %v", err, ErrFavoriteNotFound)
+	}
+}
+
+func TestService_Schedule_audit(t *testing.T) {
+	now := time.Date(2021, 3, 15, 10, 0, 0, 0, time.UTC)
+	svc, account, favorite := scheduledService(t, &now)
+	operator := Actor{ID: "aziz", Role: "operator"}
+
+	daily, err := svc.As(operator).ScheduleFavorite(favorite.ID, types.ScheduleDaily, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cron, err := svc.As(operator).ScheduleFavoriteCron(favorite.ID, "0 9 1 * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.As(operator).CancelSchedule(daily.ID); err != nil {
+		t.Fatal(err)
+	}
+	// повторная отмена ничего не меняет и не записывается
+	if err := svc.CancelSchedule(daily.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	created := svc.AuditLog(AuditQuery{Action: AuditScheduleFavorite, Target: accountTarget(account.ID)})
+	if len(created) != 2 || created[0].After.Schedule.ID != daily.ID || created[1].After.Schedule.Cron != cron.Cron {
+		t.Errorf("schedule records = %+v", created)
+	}
+	canceled := svc.AuditLog(AuditQuery{Action: AuditCancelSchedule, Target: scheduleTarget(daily.ID)})
+	if len(canceled) != 1 {
+		t.Fatalf("got %d cancel records, want 1", len(canceled))
+	}
+	if canceled[0].Actor != operator || !canceled[0].Before.Schedule.Active || canceled[0].After.Schedule.Active {
+		t.Errorf("cancel record = %+v", canceled[0])
+	}
+	if err := svc.VerifyAuditLog(); err != nil {
+		t.Errorf("VerifyAuditLog() = %v", err)
+	}
+}
+
+func TestService_Schedules_exportImport(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	svc, _, favorite := scheduledService(t, &now)
+	if _, err := svc.ScheduleFavorite(favorite.ID, types.ScheduleWeekly, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ScheduleFavoriteCron(favorite.ID, "0 9 * * 1-5"); err != nil {
+		t.Fatal(err)
+	}
+	svc.RunDueSchedules()
+	// текст ошибки может содержать разделители dump-файла
+	svc.scheduleRuns = append(svc.scheduleRuns, &types.ScheduleRun{
+		ScheduleID: svc.scheduleRuns[0].ScheduleID,
+		FavoriteID: favorite.ID,
+		Due:        now,
+		Executed:   now,
+		Attempt:    2,
+		Status:     types.ScheduleRunFailed,
+		Error:      "gateway: timeout; retry later,\nthen give up",
+	})
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	// после импорта время в местном часовом поясе, поэтому сравниваем в UTC
+	schedules := restored.Schedules("")
+	for i := range schedules {
+		schedules[i].Start = schedules[i].Start.UTC()
+		schedules[i].NextRun = schedules[i].NextRun.UTC()
+		schedules[i].Due = schedules[i].Due.UTC()
+	}
+	if !reflect.DeepEqual(schedules, svc.Schedules("")) {
+		t.Errorf("schedules = %+v, want %+v", schedules, svc.Schedules(""))
+	}
+	runs := restored.ScheduleRuns("")
+	for i := range runs {
+		runs[i].Due = runs[i].Due.UTC()
+		runs[i].Executed = runs[i].Executed.UTC()
+	}
+	if !reflect.DeepEqual(runs, svc.ScheduleRuns("")) {
+		t.Errorf("runs = %+v, want %+v", runs, svc.ScheduleRuns(""))
+	}
+
+	// повторный импорт не дублирует попытки и не стирает попытки, которых нет в файле
+	restored.scheduleRuns = append(restored.scheduleRuns, &types.ScheduleRun{ScheduleID: "local", Due: now, Attempt: 1, Status: types.ScheduleRunOK})
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(restored.ScheduleRuns("")), len(svc.ScheduleRuns(""))+1; got != want {
+		t.Errorf("runs after second import = %d, want %d", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -8,8 +9,8 @@ import (
 	"strconv"
 	"io"
 	"io/ioutil"
-	"sync"
 	"strings"
+	"time"
 	"github.com/shodikhuja83/wallet/pkg/types"
 	"github.com/google/uuid"
 )
@@ -20,6 +21,7 @@ var ErrAmountMustBePositive = errors.New("amount must be greater than zero")
 var ErrAccountNotFound = errors.New("account not found")
 var ErrNotEnoughtBalance = errors.New("account not enough balance")
 var ErrPaymentNotFound = errors.New("payment not found")
+var ErrPaymentRejected = errors.New("payment already rejected")
 var ErrFavoriteNotFound = errors.New("favorite not found")
 var ErrFileNotFound = errors.New("file not found")
 var err error
@@ -30,6 +32,32 @@ type Service struct  {
 	accounts []*types.Account 
 	payments []*types.Payment
 	favorites []*types.Favorite 
+	clock func() time.Time
+	tierPolicies map[types.AccountTier]types.TierPolicy
+	tierChanges []*types.TierChange
+	transfers []*types.Transfer
+	idempotency map[string]*idempotencyRecord
+	idempotencyTTL time.Duration
+	index paymentIndex
+	entries []*types.Entry
+	events *EventBus
+	eventSequence int64
+	actor *Actor
+	auditLog []*AuditRecord
+	schedules []*types.Schedule
+	scheduleRuns []*types.ScheduleRun
+	scheduleRetry *ScheduleRetry
+	categories []*types.Category
+	merchants []*types.Merchant
+	merchantEntries []*types.MerchantEntry
+	settlements []*types.Settlement
+	feeSchedule []types.FeeRule
+	withdrawals []*types.Withdrawal
+	rewardRules []types.RewardRule
+	rewards []*types.Reward
+	budgets []*types.Budget
+	// budgetAlerts оповещения последнего pay, публикуются после PaymentCreated
+	budgetAlerts []BudgetThresholdReached
 }
 
 
@@ -45,8 +73,11 @@ func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error) {
 		ID : s.NextAccountID,
 		Phone: phone,
 		Balance: 0,
+		Tier: types.TierAnonymous,
 	}
 	s.accounts = append(s.accounts, account)
+	s.audit(AuditRegisterAccount, AuditState{}, AuditState{Account: auditAccount(account)}, accountTarget(account.ID))
+	s.publish(AccountRegistered{EventHeader: s.header(EventAccountRegistered, account.ID), Account: *account})
 
 	return account, nil
 }
@@ -69,14 +100,32 @@ func (s *Service) Deposit(accountID int64, amount types.Money) error {
 	if account == nil {
 		return ErrAccountNotFound
 	}
+	if err := s.checkDeposit(account, amount); err != nil {
+		return err
+	}
 
+	before := AuditState{Account: auditAccount(account)}
 	account.Balance += amount
+	s.record(account.ID, types.EntryDeposit, amount, "", "")
+	s.audit(AuditDeposit, before, AuditState{Account: auditAccount(account)}, accountTarget(account.ID))
+	s.publish(Deposited{EventHeader: s.header(EventDeposited, account.ID), Amount: amount, Balance: account.Balance})
 	return nil
 }
 
 
 // Pay платит определенную сумму денег за категорию
 func (s *Service) Pay(accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	payment, err := s.pay(AuditPay, accountID, amount, category)
+	if err != nil {
+		return nil, err
+	}
+	s.publishPaymentCreated(payment, "", "")
+	return payment, nil
+}
+
+// pay создаёт платёж без публикации события, событие публикует вызывающий метод;
+// в журнал аудита платёж записывается как action с дополнительными targets
+func (s *Service) pay(action AuditAction, accountID int64, amount types.Money, category types.PaymentCategory, targets ...string) (*types.Payment, error) {
 	if amount <= 0 {
 		return nil, ErrAmountMustBePositive
 	}
@@ -91,10 +140,19 @@ func (s *Service) Pay(accountID int64, amount types.Money, category types.Paymen
 	if account == nil {
 		return nil, ErrAccountNotFound
 	}
-	if account.Balance < amount {
+	category, err := s.checkCategory(category)
+	if err != nil {
+		return nil, err
+	}
+	fees := s.fees(types.FeePayment, amount, category)
+	if account.Balance < amount+totalFees(fees) {
 		return nil, ErrNotEnoughtBalance
 	}
+	if err := s.checkPayment(account, amount); err != nil {
+		return nil, err
+	}
 
+	before := AuditState{Account: auditAccount(account)}
 	account.Balance -= amount
 	paymentID := uuid.New().String()
 	payment := &types.Payment {
@@ -103,11 +161,37 @@ func (s *Service) Pay(accountID int64, amount types.Money, category types.Paymen
 		Amount: amount,
 		Category: category,
 		Status: types.PaymentStatusInProgress,
+		Created: s.now(),
+		Fees: fees,
 	}
 	s.payments = append(s.payments, payment)
+	s.record(account.ID, types.EntryPayment, -amount, payment.ID, category)
+	s.chargeFees(account, payment.Fees, payment.ID, category)
+	s.budgetAlerts = s.trackBudgets(payment, amount)
+	s.audit(action, before, AuditState{Account: auditAccount(account), Payment: auditPayment(payment)},
+		append([]string{accountTarget(account.ID), paymentTarget(payment.ID)}, targets...)...)
 	return payment, nil
 }
 
+func (s *Service) publishPaymentCreated(payment *types.Payment, repeatOf string, favoriteID string) {
+	alerts := s.budgetAlerts
+	s.budgetAlerts = nil
+	if s.events == nil {
+		return
+	}
+	event := PaymentCreated{
+		EventHeader: s.header(EventPaymentCreated, payment.AccountID),
+		Payment:     *payment,
+		RepeatOf:    repeatOf,
+		FavoriteID:  favoriteID,
+	}
+	if account, err := s.FindAccountByID(payment.AccountID); err == nil {
+		event.Balance = account.Balance
+	}
+	s.publish(event)
+	s.publishBudgetAlerts(alerts)
+}
+
 
 // FindAccountById ищет пользователя по ID
 func (s *Service) FindAccountByID(accountID int64) (*types.Account, error) {
@@ -127,6 +211,24 @@ func (s *Service) FindAccountByID(accountID int64) (*types.Account, error) {
 }
 
 
+// Accounts возвращает все аккаунты в порядке регистрации
+func (s *Service) Accounts() []types.Account {
+	accounts := make([]types.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, *account)
+	}
+	return accounts
+}
+
+// Favorites возвращает все избранные платежи в порядке добавления
+func (s *Service) Favorites() []types.Favorite {
+	favorites := make([]types.Favorite, 0, len(s.favorites))
+	for _, favorite := range s.favorites {
+		favorites = append(favorites, *favorite)
+	}
+	return favorites
+}
+
 // FindPaymentByID ищет платёж по ID
 func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
 	var payment *types.Payment
@@ -145,20 +247,32 @@ func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
 }
 
 
-// Reject отменяет платёж
+// Reject отменяет платёж; повторная отмена возвращает ErrPaymentRejected и ничего не меняет
 func (s *Service) Reject(paymentID string) error {
 	pay, err := s.FindPaymentByID(paymentID)
 	if err != nil {
 		return ErrPaymentNotFound
 	}
+	if pay.Status == types.PaymentStatusFail {
+		return ErrPaymentRejected
+	}
 
 	acc, err := s.FindAccountByID(pay.AccountID)
 	if err != nil {
 		return ErrAccountNotFound
 	}
 
+	before := AuditState{Account: auditAccount(acc), Payment: auditPayment(pay)}
 	pay.Status = types.PaymentStatusFail
 	acc.Balance += pay.Amount
+	s.record(acc.ID, types.EntryRefund, pay.Amount, pay.ID, pay.Category)
+	s.refundPaymentFees(acc, pay)
+	s.reverseRewards(acc, pay)
+	s.reverseMerchant(pay)
+	alerts := s.trackBudgets(pay, -pay.Amount)
+	s.audit(AuditReject, before, AuditState{Account: auditAccount(acc), Payment: auditPayment(pay)}, accountTarget(acc.ID), paymentTarget(pay.ID))
+	s.publish(PaymentRejected{EventHeader: s.header(EventPaymentRejected, acc.ID), Payment: *pay, Balance: acc.Balance})
+	s.publishBudgetAlerts(alerts)
 
 	return nil
 }
@@ -171,10 +285,16 @@ func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
 	  return nil, err
 	}
   
-	payment, err := s.Pay(pay.AccountID, pay.Amount, pay.Category)
+	var payment *types.Payment
+	if pay.MerchantID != "" {
+		payment, err = s.payMerchant(AuditRepeat, pay.AccountID, pay.MerchantID, pay.Amount, pay.Category, paymentTarget(pay.ID))
+	} else {
+		payment, err = s.pay(AuditRepeat, pay.AccountID, pay.Amount, pay.Category, paymentTarget(pay.ID))
+	}
 	if err != nil {
 	  return nil, err
 	}
+	s.publishPaymentCreated(payment, pay.ID, "")
   
 	return payment, nil
 }
@@ -193,6 +313,13 @@ func (s *Service) FindFavoriteByID(favoriteID string) (*types.Favorite, error) {
 func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorite, error) {
 	payment, err := s.FindPaymentByID(paymentID)
 
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFavoriteName(payment.AccountID, name, ""); err != nil {
+		return nil, err
+	}
+	category, err := s.checkCategory(payment.Category)
 	if err != nil {
 		return nil, err
 	}
@@ -203,10 +330,14 @@ func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorit
 		AccountID: payment.AccountID,
 		Name:      name,
 		Amount:    payment.Amount,
-		Category:  payment.Category,
+		Category:  category,
 	}
 
 	s.favorites = append(s.favorites, newFavorite)
+	favoriteCopy := *newFavorite
+	s.audit(AuditFavoritePayment, AuditState{}, AuditState{Favorite: &favoriteCopy},
+		accountTarget(newFavorite.AccountID), favoriteTarget(newFavorite.ID), paymentTarget(payment.ID))
+	s.publish(FavoriteCreated{EventHeader: s.header(EventFavoriteCreated, newFavorite.AccountID), Favorite: *newFavorite, PaymentID: payment.ID})
 	return newFavorite, nil
 }
 
@@ -217,12 +348,7 @@ func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
 		return nil, err
 	}
 
-	payment, err := s.Pay(favorite.AccountID, favorite.Amount, favorite.Category)
-	if err != nil {
-		return nil, err
-	}
-
-	return payment, nil
+	return s.payFromFavorite(favorite, favorite.Amount)
 }
 
 // ExportToFile экспортирует все аккаунты в файл, путь к которому указан в переменной path
@@ -278,7 +404,7 @@ func (s *Service) Export(dir string) error {
 
 		str := ""
 		for _, v := range s.accounts {
-			str += fmt.Sprint(v.ID) + ";" + string(v.Phone) + ";" + fmt.Sprint(v.Balance) + "\n"
+			str += fmt.Sprint(v.ID) + ";" + string(v.Phone) + ";" + fmt.Sprint(v.Balance) + ";" + string(v.Tier) + "\n"
 		}
 		file.WriteString(str)
 	}
@@ -296,28 +422,55 @@ func (s *Service) Export(dir string) error {
 
 		str := ""
 		for _, v := range s.payments {
-			str += fmt.Sprint(v.ID) + ";" + fmt.Sprint(v.AccountID) + ";" + fmt.Sprint(v.Amount) + ";" + fmt.Sprint(v.Category) + ";" + fmt.Sprint(v.Status) + "\n"
+			str += fmt.Sprint(v.ID) + ";" + fmt.Sprint(v.AccountID) + ";" + fmt.Sprint(v.Amount) + ";" + fmt.Sprint(v.Category) + ";" + fmt.Sprint(v.Status) + ";" + formatTime(v.Created) + ";" + v.MerchantID + "\n"
 		}
 		file.WriteString(str)
 	}
 
-	if len(s.favorites) > 0 {
-		file, _ := os.OpenFile(dir+"/favorites.dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-
-		defer func() {
-			if cerr := file.Close(); cerr != nil {
-				if err != nil {
-					err = cerr
-					log.Print(err)
-				}
-			}
-		}()
-
-		str := ""
-		for _, v := range s.favorites {
-			str += fmt.Sprint(v.ID) + ";" + fmt.Sprint(v.AccountID) + ";" + fmt.Sprint(v.Amount) + ";" + fmt.Sprint(v.Category) + "\n"
-		}
-		file.WriteString(str)
+	if err := s.exportFavorites(dir); err != nil {
+		return err
+	}
+	if err := s.exportTransfers(dir); err != nil {
+		return err
+	}
+	if err := s.exportIdempotency(dir); err != nil {
+		return err
+	}
+	if err := s.exportEntries(dir); err != nil {
+		return err
+	}
+	if err := s.exportAudit(dir); err != nil {
+		return err
+	}
+	if err := s.exportSchedules(dir); err != nil {
+		return err
+	}
+	if err := s.exportCategories(dir); err != nil {
+		return err
+	}
+	if err := s.exportMerchants(dir); err != nil {
+		return err
+	}
+	if err := s.exportWithdrawals(dir); err != nil {
+		return err
+	}
+	if err := s.exportFees(dir); err != nil {
+		return err
+	}
+	if err := s.exportFeeSchedule(dir); err != nil {
+		return err
+	}
+	if err := s.exportRewardRules(dir); err != nil {
+		return err
+	}
+	if err := s.exportRewards(dir); err != nil {
+		return err
+	}
+	if err := s.exportBudgets(dir); err != nil {
+		return err
+	}
+	if err := s.exportTiers(dir); err != nil {
+		return err
 	}
 
 	return nil
@@ -381,6 +534,7 @@ func (s *Service) ImportFromFile(path string) error {
 			ID:      int64(ID),
 			Phone:   types.Phone(phone),
 			Balance: types.Money(balance),
+			Tier:    legacyTier,
 		}
 
 		s.accounts = append(s.accounts, account)
@@ -391,6 +545,11 @@ func (s *Service) ImportFromFile(path string) error {
 
 //Import method
 func (s *Service) Import(dir string) error {
+	// журнал проверяется первым: при нарушенной цепочке данные не смешиваются
+	merging := len(s.auditLog) > 0
+	if err := s.importAudit(dir); err != nil {
+		return err
+	}
 
 	_, err := os.Stat(dir + "/accounts.dump")
 
@@ -406,7 +565,6 @@ func (s *Service) Import(dir string) error {
 		}
 		for _, v := range strArray {
 			strArrAcount := strings.Split(v, ";")
-			fmt.Println(strArrAcount)
 
 			id, err := strconv.ParseInt(strArrAcount[0], 10, 64)
 			if err != nil {
@@ -416,11 +574,22 @@ func (s *Service) Import(dir string) error {
 			if err != nil {
 				return err
 			}
+			tier := legacyTier
+			if len(strArrAcount) > 3 && strArrAcount[3] != "" {
+				tier = types.AccountTier(strArrAcount[3])
+			}
+			if !validTier(tier) {
+				return ErrUnknownTier
+			}
+			if id > s.NextAccountID {
+				s.NextAccountID = id
+			}
 			flag := true
 			for _, v := range s.accounts {
 				if v.ID == id {
 					v.Phone = types.Phone(strArrAcount[1])
 					v.Balance = types.Money(balance)
+					v.Tier = tier
 					flag = false
 				}
 			}
@@ -429,6 +598,7 @@ func (s *Service) Import(dir string) error {
 					ID:      id,
 					Phone:   types.Phone(strArrAcount[1]),
 					Balance: types.Money(balance),
+					Tier:    tier,
 				}
 				s.accounts = append(s.accounts, account)
 			}
@@ -449,7 +619,6 @@ func (s *Service) Import(dir string) error {
 		}
 		for _, v := range strArray {
 			strArrAcount := strings.Split(v, ";")
-			fmt.Println(strArrAcount)
 
 			id := strArrAcount[0]
 			if err != nil {
@@ -463,6 +632,17 @@ func (s *Service) Import(dir string) error {
 			if err != nil {
 				return err
 			}
+			var created time.Time
+			if len(strArrAcount) > 5 {
+				created, err = parseTime(strArrAcount[5])
+				if err != nil {
+					return err
+				}
+			}
+			merchantID := ""
+			if len(strArrAcount) > 6 {
+				merchantID = strArrAcount[6]
+			}
 			flag := true
 			for _, v := range s.payments {
 				if v.ID == id {
@@ -470,16 +650,21 @@ func (s *Service) Import(dir string) error {
 					v.Amount = types.Money(amount)
 					v.Category = types.PaymentCategory(strArrAcount[3])
 					v.Status = types.PaymentStatus(strArrAcount[4])
+					v.Created = created
+					v.MerchantID = merchantID
 					flag = false
+					s.resetIndex()
 				}
 			}
 			if flag {
 				data := &types.Payment{
-					ID:        id,
-					AccountID: aid,
-					Amount:    types.Money(amount),
-					Category:  types.PaymentCategory(strArrAcount[3]),
-					Status:    types.PaymentStatus(strArrAcount[4]),
+					ID:         id,
+					AccountID:  aid,
+					Amount:     types.Money(amount),
+					Category:   types.PaymentCategory(strArrAcount[3]),
+					Status:     types.PaymentStatus(strArrAcount[4]),
+					Created:    created,
+					MerchantID: merchantID,
 				}
 				s.payments = append(s.payments, data)
 			}
@@ -500,7 +685,6 @@ func (s *Service) Import(dir string) error {
 		}
 		for _, v := range strArray {
 			strArrAcount := strings.Split(v, ";")
-			fmt.Println(strArrAcount)
 
 			id := strArrAcount[0]
 			if err != nil {
@@ -514,30 +698,110 @@ func (s *Service) Import(dir string) error {
 			if err != nil {
 				return err
 			}
+			name := ""
+			if len(strArrAcount) > 4 {
+				name = strArrAcount[4]
+			}
+			variable := false
+			if len(strArrAcount) > 5 {
+				variable, err = strconv.ParseBool(strArrAcount[5])
+				if err != nil {
+					return err
+				}
+			}
 			flag := true
 			for _, v := range s.favorites {
 				if v.ID == id {
 					v.AccountID = aid
+					v.Name = name
 					v.Amount = types.Money(amount)
 					v.Category = types.PaymentCategory(strArrAcount[3])
+					v.VariableAmount = variable
 					flag = false
 				}
 			}
 			if flag {
 				data := &types.Favorite{
-					ID:        id,
-					AccountID: aid,
-					Amount:    types.Money(amount),
-					Category:  types.PaymentCategory(strArrAcount[3]),
+					ID:             id,
+					AccountID:      aid,
+					Name:           name,
+					Amount:         types.Money(amount),
+					Category:       types.PaymentCategory(strArrAcount[3]),
+					VariableAmount: variable,
 				}
 				s.favorites = append(s.favorites, data)
 			}
 		}
 	}
 
+	if err := s.importTransfers(dir); err != nil {
+		return err
+	}
+	if err := s.importIdempotency(dir); err != nil {
+		return err
+	}
+	if err := s.importEntries(dir); err != nil {
+		return err
+	}
+	if err := s.importSchedules(dir); err != nil {
+		return err
+	}
+	if err := s.importMerchants(dir); err != nil {
+		return err
+	}
+	if err := s.importWithdrawals(dir); err != nil {
+		return err
+	}
+	if err := s.importFees(dir); err != nil {
+		return err
+	}
+	if err := s.importFeeSchedule(dir); err != nil {
+		return err
+	}
+	if err := s.importRewardRules(dir); err != nil {
+		return err
+	}
+	if err := s.importRewards(dir); err != nil {
+		return err
+	}
+	if err := s.importBudgets(dir); err != nil {
+		return err
+	}
+	if err := s.importTiers(dir); err != nil {
+		return err
+	}
+	if err := s.importCategories(dir); err != nil {
+		return err
+	}
+
+	// первоначальная загрузка восстанавливает состояние, а импорт поверх
+	// существующего журнала сам является операцией
+	if merging {
+		s.audit(AuditImport, AuditState{}, AuditState{}, importTarget(dir))
+	}
 	return nil
 }
 
+// formatTime переводит время в строку для dump-файлов
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// parseTime читает время, записанное formatTime
+func parseTime(str string) (time.Time, error) {
+	nsec, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nsec == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, nsec), nil
+}
+
 //ExportAccountHistory вытаскивает все платежи конкретного аккаунта, если их нет - возвращает ошибку
 func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error) {
 
@@ -556,6 +820,7 @@ func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error)
 				Amount:    v.Amount,
 				Category:  v.Category,
 				Status:    v.Status,
+				Created:   v.Created,
 			}
 			payments = append(payments, data)
 		}
@@ -563,92 +828,51 @@ func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error)
 	return payments, nil
 }
 
-//HistoryToFiles сохраняет данные из предыдущего метода
+//HistoryToFiles сохраняет данные из предыдущего метода: в payments.dump, если записей не больше records,
+//иначе в payments1.dump, payments2.dump, ... по records записей; список файлов пишется в payments.manifest
 func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records int) error {
-
-	if len(payments) > 0 {
-		if len(payments) <= records {
-			file, _ := os.OpenFile(dir+"/payments.dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-			defer file.Close()
-
-			var str string
-			for _, v := range payments {
-				str += fmt.Sprint(v.ID) + ";" + fmt.Sprint(v.AccountID) + ";" + fmt.Sprint(v.Amount) + ";" + fmt.Sprint(v.Category) + ";" + fmt.Sprint(v.Status) + "\n"
-			}
-			file.WriteString(str)
-		} else {
-
-			var str string
-			k := 0
-			t := 1
-			var file *os.File
-			for _, v := range payments {
-				if k == 0{
-				file, _ = os.OpenFile(dir+"/payments"+fmt.Sprint(t)+".dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-				}
-				k ++
-				str = fmt.Sprint(v.ID) + ";" + fmt.Sprint(v.AccountID) + ";" + fmt.Sprint(v.Amount) + ";" + fmt.Sprint(v.Category) + ";" + fmt.Sprint(v.Status) + "\n"
-				_, err = file.WriteString(str)
-				if k == records{
-					str = ""
-					t ++
-					k = 0;
-					file.Close()
-				}
-			}
-
-		}
+	if len(payments) == 0 {
+		return nil
 	}
 
-	return nil
+	opts := ShardOptions{Records: records, Pattern: DefaultShardPattern}
+	if records <= 0 || len(payments) <= records {
+		opts = ShardOptions{Pattern: "payments.dump"}
+	}
+	_, err := s.ExportHistoryShards(payments, dir, opts)
+	return err
 }
 
 //SumPayments суммирует платежи
 func (s *Service) SumPayments(goroutines int) types.Money {
-	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
-	sum := int64(0)
-	kol := 0
-	i := 0
-	if goroutines == 0 {
-		kol = len(s.payments)
-	} else {
-		kol = int(len(s.payments) / goroutines)
-	}
-	for i = 0; i < goroutines-1; i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			val := int64(0)
-			payments := s.payments[index*kol : (index+1)*kol]
-			for _, payment := range payments {
-				val += int64(payment.Amount)
-			}
-			mu.Lock()
-			sum += val
-			mu.Unlock()
+	sum, _ := s.SumPaymentsContext(context.Background(), goroutines)
+	return sum
+}
 
-		}(i)
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		val := int64(0)
-		payments := s.payments[i*kol:]
+//SumPaymentsContext суммирует платежи, прекращая работу при отмене ctx
+func (s *Service) SumPaymentsContext(ctx context.Context, goroutines int) (types.Money, error) {
+	sum, err := s.MapReduce(ctx, ScanOptions{Goroutines: goroutines}, func(payments []*types.Payment) interface{} {
+		val := types.Money(0)
 		for _, payment := range payments {
-			val += int64(payment.Amount)
+			val += payment.Amount
 		}
-		mu.Lock()
-		sum += val
-		mu.Unlock()
-
-	}()
-	wg.Wait()
-	return types.Money(sum)
+		return val
+	}, func(acc interface{}, part interface{}) interface{} {
+		return acc.(types.Money) + part.(types.Money)
+	}, types.Money(0))
+	if err != nil {
+		return 0, err
+	}
+	return sum.(types.Money), nil
 }
 
 //FilterPayments отфильтровывает платежи, выдавая нам только те, у которых accountID равен переданному
 func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsContext(context.Background(), accountID, goroutines)
+}
+
+//FilterPaymentsContext работает как FilterPayments, но прекращает работу при отмене ctx
+func (s *Service) FilterPaymentsContext(ctx context.Context, accountID int64, goroutines int) ([]types.Payment, error) {
 
 	account, err := s.FindAccountByID(accountID)
 
@@ -656,167 +880,91 @@ func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payme
 		return nil, err
 	}
 
-	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
-	kol := 0
-	i := 0
-	var ps []types.Payment
-	if goroutines == 0 {
-		kol = len(s.payments)
-	} else {
-		kol = int(len(s.payments) / goroutines)
-	}
-	for i = 0; i < goroutines-1; i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			var pays []types.Payment
-			payments := s.payments[index*kol : (index+1)*kol]
-			for _, v := range payments {
-				if v.AccountID == account.ID {
-					pays = append(pays, types.Payment{
-						ID:        v.ID,
-						AccountID: v.AccountID,
-						Amount:    v.Amount,
-						Category:  v.Category,
-						Status:    v.Status,
-					})
-				}
-			}
-			mu.Lock()
-			ps = append(ps, pays...)
-			mu.Unlock()
-
-		}(i)
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		var pays []types.Payment
-		payments := s.payments[i*kol:]
-		for _, v := range payments {
-			if v.AccountID == account.ID {
-				pays = append(pays, types.Payment{
-					ID:        v.ID,
-					AccountID: v.AccountID,
-					Amount:    v.Amount,
-					Category:  v.Category,
-					Status:    v.Status,
-				})
-			}
-		}
-		mu.Lock()
-		ps = append(ps, pays...)
-		mu.Unlock()
-
-	}()
-	wg.Wait()
-	if len(ps)==0{
-		return nil, nil
-	}
-	return  ps, nil
+	return s.FilterPaymentsByFnContext(ctx, func(payment types.Payment) bool {
+		return payment.AccountID == account.ID
+	}, goroutines)
 }
 
 //FilterPaymentsByFn отфильтровывает платежи, выдавая только те где filter(payment) == true
 func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, goroutines int,) ([]types.Payment, error){
+	return s.FilterPaymentsByFnContext(context.Background(), filter, goroutines)
+}
 
-	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
-	kol := 0
-	i := 0
-	var ps []types.Payment
-	if goroutines == 0 {
-		kol = len(s.payments)
-	} else {
-		kol = int(len(s.payments) / goroutines)
-	}
-	for i = 0; i < goroutines-1; i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			var pays []types.Payment
-			payments := s.payments[index*kol : (index+1)*kol]
-			for _, v := range payments {
-				p := types.Payment{
-					ID:        v.ID,
-					AccountID: v.AccountID,
-					Amount:    v.Amount,
-					Category:  v.Category,
-					Status:    v.Status,
-				}
-
-				if filter(p) {
-					pays = append(pays, p)
-				}
-			}
-			mu.Lock()
-			ps = append(ps, pays...)
-			mu.Unlock()
-
-		}(i)
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+//FilterPaymentsByFnContext работает как FilterPaymentsByFn, но прекращает работу при отмене ctx;
+//платежи возвращаются в порядке их создания
+func (s *Service) FilterPaymentsByFnContext(ctx context.Context, filter func(payment types.Payment) bool, goroutines int) ([]types.Payment, error) {
+	ps, err := s.MapReduce(ctx, ScanOptions{Goroutines: goroutines, Ordered: true}, func(payments []*types.Payment) interface{} {
 		var pays []types.Payment
-		payments := s.payments[i*kol:]
 		for _, v := range payments {
-
-			p := types.Payment{
-				ID:        v.ID,
-				AccountID: v.AccountID,
-				Amount:    v.Amount,
-				Category:  v.Category,
-				Status:    v.Status,
-			}
-
+			p := *v
 			if filter(p) {
 				pays = append(pays, p)
 			}
 		}
-		mu.Lock()
-		ps = append(ps, pays...)
-		mu.Unlock()
-
-	}()
-	wg.Wait()
-	if len(ps) == 0{
+		return pays
+	}, func(acc interface{}, part interface{}) interface{} {
+		return append(acc.([]types.Payment), part.([]types.Payment)...)
+	}, []types.Payment(nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(ps.([]types.Payment)) == 0 {
 		return nil, nil
 	}
-	return  ps, nil
+	return ps.([]types.Payment), nil
 }
+
+// ProgressChunkSize размер куска, который использует SumPaymentsWithProgress
+const ProgressChunkSize = 100_000
+
 //SumPaymentsWithProgress делит платежи на куски по 100_000 платежей в каждом и суммирует их параллельно друг другу
 func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
-	sizeOfUnit := 100_0000 		/* когда условие и требование в задаче не совпадают :) */
-
-	wg := sync.WaitGroup{}
-	goroutines := len(s.payments) / sizeOfUnit /* определяем количество горутин - сколько кусков потребуется сложить*/
-	if goroutines <= 1 {
-		goroutines = 1	
-	/* на случай если платеж всего один (или их нет) */
-	}
-	ch := make(chan types.Progress)
-
-	for i := 0; i < goroutines; i++ {
-		wg.Add(1)
-		go func(ch chan <- types.Progress, payments []*types.Payment) {
-			//defer close(ch)
-			var sum types.Money = 0
-			defer wg.Done()
-			for _, pay := range payments {
-				sum += pay.Amount
-			}
-			ch <- types.Progress{
-				Part:   len(payments), 
-				Result: sum,
-			}
-		}(ch, s.payments)
+	return s.SumPaymentsWithProgressContext(context.Background())
+}
+
+//SumPaymentsWithProgressContext работает как SumPaymentsWithProgress; при отмене ctx воркеры
+//останавливаются и канал закрывается, причину можно узнать через ctx.Err()
+func (s *Service) SumPaymentsWithProgressContext(ctx context.Context) <-chan types.Progress {
+	return s.SumPaymentsProgressive(ctx, ProgressChunkSize, 0)
+}
+
+//SumPaymentsProgressive суммирует платежи кусками по chunkSize в goroutines воркерах и по готовности
+//каждого куска отправляет его сумму вместе с накопленным итогом и процентом выполнения.
+//Канал буферизирован на все куски, поэтому потребитель может прекратить чтение в любой момент;
+//последний отчёт содержит итоговую сумму. Без платежей отправляется один отчёт со 100%
+func (s *Service) SumPaymentsProgressive(ctx context.Context, chunkSize int, goroutines int) <-chan types.Progress {
+	if chunkSize <= 0 {
+		chunkSize = ProgressChunkSize
+	}
+	payments := s.payments
+	opts := ScanOptions{Goroutines: goroutines, ChunkSize: chunkSize}
+	ch := make(chan types.Progress, len(opts.chunks(len(payments)))+1)
+
+	if len(payments) == 0 {
+		ch <- types.Progress{Percent: 100}
+		close(ch)
+		return ch
 	}
 
 	go func() {
 		defer close(ch)
-		wg.Wait()
+		scanPayments(ctx, payments, opts, func(chunk []*types.Payment) interface{} {
+			progress := types.Progress{Part: len(chunk)}
+			for _, pay := range chunk {
+				progress.Result += pay.Amount
+			}
+			return progress
+		}, func(acc interface{}, part interface{}) interface{} {
+			last := acc.(types.Progress)
+			progress := part.(types.Progress)
+			progress.Chunk = last.Chunk + 1
+			progress.Processed = last.Processed + progress.Part
+			progress.Total = last.Total + progress.Result
+			progress.Percent = float64(progress.Processed) * 100 / float64(len(payments))
+			ch <- progress
+			return progress
+		}, types.Progress{})
 	}()
 
 	return ch
-} 
\ No newline at end of file
+}
@@ -1,9 +1,13 @@
 package wallet
 
 import (
+	"context"
 	"log"
+	"path/filepath"
 	"fmt"
 	"testing"
+	"runtime"
+	"time"
 	"github.com/shodikhuja83/wallet/pkg/types"
 )
 
@@ -164,7 +168,7 @@ func TestService_Export_success_user(t *testing.T) {
 	svc.RegisterAccount("+992000000002")
 	svc.RegisterAccount("+992000000003")
 
-	err := svc.ExportToFile("export.txt")
+	err := svc.ExportToFile(filepath.Join(t.TempDir(), "export.txt"))
 	if err != nil {
 		t.Errorf("method Export returned not nil error, err => %v", err)
 	}
@@ -190,17 +194,56 @@ func TestService_Export_success(t *testing.T) {
 	svc.RegisterAccount("+992000000003")
 	svc.RegisterAccount("+992000000004")
 
-	err := svc.Export("data")
+	dir := t.TempDir()
+	err := svc.Export(dir)
 	if err != nil {
 		t.Errorf("method ExportToFile returned not nil error, err => %v", err)
 	}
 
-	err = svc.Import("data")
+	err = svc.Import(dir)
 	if err != nil {
 		t.Errorf("method ExportToFile returned not nil error, err => %v", err)
 	}
 }
 
+func TestService_Import_restoresState(t *testing.T) {
+	dir := t.TempDir()
+	svc := Service{}
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 100_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FavoritePayment(payment.ID, "car wash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Fatal(err)
+	}
+	favorites := restored.Favorites()
+	if len(favorites) != 1 || favorites[0].Name != "car wash" {
+		t.Errorf("favorite name was not restored, favorites => %v", favorites)
+	}
+	next, err := restored.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != account.ID+1 {
+		t.Errorf("new account got id %v, want %v", next.ID, account.ID+1)
+	}
+}
+
 func TestService_ExportHistory_success_user(t *testing.T) {
 	svc := Service{}
 
@@ -235,7 +278,7 @@ func TestService_ExportHistory_success_user(t *testing.T) {
 	if err != nil {
 		t.Errorf("method ExportAccountHistory returned not nil error, err => %v", err)
 	}
-	err = svc.HistoryToFiles(payments, "data", 4)
+	err = svc.HistoryToFiles(payments, t.TempDir(), 4)
 
 	if err != nil {
 		t.Errorf("method HistoryToFiles returned not nil error, err => %v", err)
@@ -361,4 +404,135 @@ func BenchmarkSumPaymentsWithProgress_user(b *testing.B) {
 	}
   
 	log.Println("\n s => ", s)
-  }
\ No newline at end of file
+  }
+
+// Автотесты для методов с контекстом
+func TestService_Context_canceled(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 10_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{AccountID: 1, Amount: 1})
+	}
+	svc.RegisterAccount("+992000000001")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := svc.SumPaymentsContext(ctx, 4); err != context.Canceled {
+		t.Errorf("SumPaymentsContext(): got > %v want > %v", err, context.Canceled)
+	}
+	if _, err := svc.FilterPaymentsContext(ctx, 1, 4); err != context.Canceled {
+		t.Errorf("FilterPaymentsContext(): got > %v want > %v", err, context.Canceled)
+	}
+	_, err := svc.FilterPaymentsByFnContext(ctx, func(types.Payment) bool { return true }, 4)
+	if err != context.Canceled {
+		t.Errorf("FilterPaymentsByFnContext(): got > %v want > %v", err, context.Canceled)
+	}
+}
+
+func TestService_SumPaymentsWithProgressContext_noLeak(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 10; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 1})
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := svc.SumPaymentsWithProgressContext(ctx)
+	cancel()
+
+	select {
+	case <-waitClosed(ch):
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after cancel")
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: before %v after %v", before, after)
+	}
+}
+
+func waitClosed(ch <-chan types.Progress) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range ch {
+		}
+	}()
+	return done
+}
+
+// Автотесты для SumPaymentsProgressive
+func TestService_SumPaymentsProgressive_total(t *testing.T) {
+	svc := &Service{}
+	for i := 1; i <= 1_005; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: types.Money(i)})
+	}
+	want := svc.SumPayments(4)
+
+	var last types.Progress
+	parts := 0
+	chunkSum := types.Money(0)
+	for progress := range svc.SumPaymentsProgressive(context.Background(), 100, 3) {
+		parts++
+		chunkSum += progress.Result
+		if progress.Total != chunkSum {
+			t.Errorf("cumulative total mismatch: got > %v want > %v", progress.Total, chunkSum)
+		}
+		last = progress
+	}
+
+	if parts != 11 {
+		t.Errorf("got %v chunks, want 11", parts)
+	}
+	if last.Total != want {
+		t.Errorf("final total: got > %v want > %v", last.Total, want)
+	}
+	if last.Processed != 1_005 || last.Percent != 100 {
+		t.Errorf("final progress incomplete: %+v", last)
+	}
+}
+
+func TestService_SumPaymentsWithProgress_total(t *testing.T) {
+	svc := &Service{}
+	for i := 1; i <= 250_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 2})
+	}
+
+	var last types.Progress
+	for progress := range svc.SumPaymentsWithProgress() {
+		last = progress
+	}
+	if last.Total != svc.SumPayments(0) || last.Chunk != 3 {
+		t.Errorf("got > %+v want total > %v", last, svc.SumPayments(0))
+	}
+}
+
+func TestService_SumPaymentsProgressive_stopEarly(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 1_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 1})
+	}
+	before := runtime.NumGoroutine()
+
+	ch := svc.SumPaymentsProgressive(context.Background(), 10, 4)
+	if _, ok := <-ch; !ok {
+		t.Fatal("channel closed without progress")
+	}
+
+	for i := 0; i < 1000 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("workers blocked after consumer stopped: before %v after %v", before, after)
+	}
+}
+
+func TestService_SumPaymentsProgressive_empty(t *testing.T) {
+	svc := &Service{}
+	progress, ok := <-svc.SumPaymentsProgressive(context.Background(), 10, 1)
+	if !ok || progress.Percent != 100 || progress.Total != 0 {
+		t.Errorf("got > %+v, %v", progress, ok)
+	}
+}
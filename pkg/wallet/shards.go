@@ -0,0 +1,218 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки шардированного экспорта
+var ErrInvalidShardPattern = errors.New("shard name pattern must contain {n}")
+var ErrShardChecksum = errors.New("shard checksum mismatch")
+var ErrInvalidShardName = errors.New("shard name in manifest must be a file name without directories")
+
+// DefaultShardPattern шаблон имени шарда по умолчанию, {n} заменяется номером с 1
+const DefaultShardPattern = "payments{n}.dump"
+
+// DefaultManifestName имя манифеста по умолчанию
+const DefaultManifestName = "payments.manifest"
+
+// ShardOptions настройки шардированного экспорта истории
+type ShardOptions struct {
+	// Records максимальное количество записей в шарде, 0 - без ограничения
+	Records int
+	// Bytes максимальный размер шарда в байтах, 0 - без ограничения;
+	// запись больше лимита всё равно попадает в шард целиком
+	Bytes int
+	// Pattern шаблон имени шарда, {n} заменяется номером шарда
+	Pattern string
+	// Manifest имя файла манифеста
+	Manifest string
+}
+
+// ShardInfo описание одного шарда в манифесте
+type ShardInfo struct {
+	Name     string
+	Records  int
+	Bytes    int
+	Checksum string // sha256 в hex
+}
+
+// Manifest список шардов в порядке записи
+type Manifest struct {
+	Shards  []ShardInfo
+	Records int
+}
+
+func (opts ShardOptions) pattern() string {
+	if opts.Pattern == "" {
+		return DefaultShardPattern
+	}
+	return opts.Pattern
+}
+
+func (opts ShardOptions) manifest() string {
+	if opts.Manifest == "" {
+		return DefaultManifestName
+	}
+	return opts.Manifest
+}
+
+// ExportHistoryShards записывает платежи в dir шардами по opts и создаёт манифест
+func (s *Service) ExportHistoryShards(payments []types.Payment, dir string, opts ShardOptions) (*Manifest, error) {
+	shards := splitShards(payments, opts)
+	pattern := opts.pattern()
+	if len(shards) > 1 && !strings.Contains(pattern, "{n}") {
+		return nil, ErrInvalidShardPattern
+	}
+
+	manifest := &Manifest{Records: len(payments)}
+	for i, shard := range shards {
+		name := strings.ReplaceAll(pattern, "{n}", strconv.Itoa(i+1))
+		content := shard.content.Bytes()
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0666); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		manifest.Shards = append(manifest.Shards, ShardInfo{
+			Name:     name,
+			Records:  shard.records,
+			Bytes:    len(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	rows := make([][]string, 0, len(manifest.Shards))
+	for _, shard := range manifest.Shards {
+		rows = append(rows, []string{
+			shard.Name,
+			strconv.Itoa(shard.Records),
+			strconv.Itoa(shard.Bytes),
+			shard.Checksum,
+		})
+	}
+	if err := writeDump(filepath.Join(dir, opts.manifest()), rows); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportHistoryShards читает манифест из dir, проверяет шарды и собирает историю в исходном порядке.
+// Пустой манифест означает пустую историю; шарды читаются только из dir
+func (s *Service) ImportHistoryShards(dir string, opts ShardOptions) ([]types.Payment, error) {
+	path := filepath.Join(dir, opts.manifest())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	rows, err := readDump(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []types.Payment
+	for _, row := range rows {
+		if len(row) < 4 {
+			return nil, ErrInvalidDump
+		}
+		if name := row[0]; name != filepath.Base(name) || name == "." || name == ".." {
+			return nil, ErrInvalidShardName
+		}
+		records, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, row[0]))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != row[3] {
+			return nil, ErrShardChecksum
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		if len(content) == 0 {
+			lines = nil
+		}
+		if len(lines) != records {
+			return nil, ErrInvalidDump
+		}
+		for _, line := range lines {
+			payment, err := parsePaymentLine(line)
+			if err != nil {
+				return nil, err
+			}
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+type shardBuffer struct {
+	content bytes.Buffer
+	records int
+}
+
+// splitShards раскладывает платежи по шардам с учётом лимитов по записям и байтам
+func splitShards(payments []types.Payment, opts ShardOptions) []*shardBuffer {
+	var shards []*shardBuffer
+	var current *shardBuffer
+	for _, payment := range payments {
+		line := formatPaymentLine(payment)
+		full := current != nil && current.records > 0 &&
+			((opts.Records > 0 && current.records >= opts.Records) ||
+				(opts.Bytes > 0 && current.content.Len()+len(line) > opts.Bytes))
+		if current == nil || full {
+			current = &shardBuffer{}
+			shards = append(shards, current)
+		}
+		current.content.WriteString(line)
+		current.records++
+	}
+	return shards
+}
+
+// formatPaymentLine строка платежа в формате payments.dump
+func formatPaymentLine(v types.Payment) string {
+	return v.ID + ";" + strconv.FormatInt(v.AccountID, 10) + ";" + strconv.FormatInt(int64(v.Amount), 10) + ";" +
+		string(v.Category) + ";" + string(v.Status) + ";" + formatTime(v.Created) + "\n"
+}
+
+// parsePaymentLine разбирает строку payments.dump, время создания необязательно
+func parsePaymentLine(line string) (types.Payment, error) {
+	fields := strings.Split(line, ";")
+	if len(fields) < 5 {
+		return types.Payment{}, ErrInvalidDump
+	}
+	accountID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return types.Payment{}, err
+	}
+	amount, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return types.Payment{}, err
+	}
+	payment := types.Payment{
+		ID:        fields[0],
+		AccountID: accountID,
+		Amount:    types.Money(amount),
+		Category:  types.PaymentCategory(fields[3]),
+		Status:    types.PaymentStatus(fields[4]),
+	}
+	if len(fields) > 5 {
+		payment.Created, err = parseTime(fields[5])
+		if err != nil {
+			return types.Payment{}, err
+		}
+	}
+	return payment, nil
+}
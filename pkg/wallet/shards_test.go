@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func historyPayments(n int) []types.Payment {
+	svc := &Service{}
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	for i := 1; i <= n; i++ {
+		svc.Pay(account.ID, types.Money(i), "Cafe")
+	}
+	payments, _ := svc.ExportAccountHistory(account.ID)
+	return payments
+}
+
+func TestService_HistoryToFiles_lastShardClosed(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	payments := historyPayments(11)
+
+	if err := svc.HistoryToFiles(payments, dir, 4); err != nil {
+		t.Fatalf("HistoryToFiles(): error = %v", err)
+	}
+	for _, name := range []string{"payments1.dump", "payments2.dump", "payments3.dump", DefaultManifestName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("file %v was not written: %v", name, err)
+		}
+	}
+
+	imported, err := svc.ImportHistoryShards(dir, ShardOptions{})
+	if err != nil {
+		t.Fatalf("ImportHistoryShards(): error = %v", err)
+	}
+	if len(imported) != len(payments) {
+		t.Fatalf("got %v payments, want %v", len(imported), len(payments))
+	}
+	for i := range payments {
+		if imported[i].ID != payments[i].ID || !imported[i].Created.Equal(payments[i].Created) {
+			t.Errorf("payment %v: got > %+v want > %+v", i, imported[i], payments[i])
+		}
+	}
+}
+
+func TestService_HistoryToFiles_single(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	if err := svc.HistoryToFiles(historyPayments(3), dir, 4); err != nil {
+		t.Fatalf("HistoryToFiles(): error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "payments.dump")); err != nil {
+		t.Errorf("payments.dump was not written: %v", err)
+	}
+}
+
+func TestService_ExportHistoryShards_bytes(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	payments := historyPayments(10)
+	lineSize := len(formatPaymentLine(payments[0]))
+
+	manifest, err := svc.ExportHistoryShards(payments, dir, ShardOptions{
+		Bytes:    lineSize * 3,
+		Pattern:  "history-{n}.txt",
+		Manifest: "history.manifest",
+	})
+	if err != nil {
+		t.Fatalf("ExportHistoryShards(): error = %v", err)
+	}
+	if len(manifest.Shards) != 4 || manifest.Shards[3].Records != 1 || manifest.Shards[0].Name != "history-1.txt" {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+
+	if _, err := svc.ExportHistoryShards(payments, dir, ShardOptions{Records: 2, Pattern: "history.txt"}); err != ErrInvalidShardPattern {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidShardPattern)
+	}
+}
+
+func TestService_ImportHistoryShards_checksum(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	if _, err := svc.ExportHistoryShards(historyPayments(5), dir, ShardOptions{Records: 2}); err != nil {
+		t.Fatalf("ExportHistoryShards(): error = %v", err)
+	}
+
+	shard := filepath.Join(dir, "payments2.dump")
+	content, _ := ioutil.ReadFile(shard)
+	content[0] = 'X'
+	ioutil.WriteFile(shard, content, 0666)
+
+	if _, err := svc.ImportHistoryShards(dir, ShardOptions{}); err != ErrShardChecksum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrShardChecksum)
+	}
+}
+
+func TestService_ImportHistoryShards_emptyAndMissingManifest(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	if _, err := svc.ImportHistoryShards(dir, ShardOptions{}); err != ErrFileNotFound {
+		t.Errorf("missing manifest: got > %v want > %v", err, ErrFileNotFound)
+	}
+
+	manifest, err := svc.ExportHistoryShards(nil, dir, ShardOptions{})
+	if err != nil {
+		t.Fatalf("ExportHistoryShards(): error = %v", err)
+	}
+	if len(manifest.Shards) != 0 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	payments, err := svc.ImportHistoryShards(dir, ShardOptions{})
+	if err != nil || len(payments) != 0 {
+		t.Errorf("empty manifest: got > %v, %v want > no payments", payments, err)
+	}
+}
+
+func TestService_ImportHistoryShards_rejectsPaths(t *testing.T) {
+	dir := t.TempDir()
+	svc := &Service{}
+	outside := filepath.Join(t.TempDir(), "payments1.dump")
+	if err := ioutil.WriteFile(outside, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	// контрольная сумма пустого файла, чтобы отказ не зависел от её проверки
+	const emptySum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	for _, name := range []string{"../" + filepath.Base(filepath.Dir(outside)) + "/payments1.dump", outside, "sub/payments1.dump", ".."} {
+		if err := ioutil.WriteFile(filepath.Join(dir, DefaultManifestName), []byte(name+";0;0;"+emptySum+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.ImportHistoryShards(dir, ShardOptions{}); err != ErrInvalidShardName {
+			t.Errorf("%q: got > %v want > %v", name, err, ErrInvalidShardName)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package wallet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrInvalidPeriod возвращается, если начало периода позже конца
+var ErrInvalidPeriod = errors.New("invalid statement period")
+
+// StatementLine строка выписки: движение по счёту и баланс после него
+type StatementLine struct {
+	Entry   types.Entry
+	Balance types.Money
+}
+
+// CategoryTotal сумма расходов по категории за период с учётом возвратов
+type CategoryTotal struct {
+	Category types.PaymentCategory
+	Amount   types.Money
+}
+
+// Statement выписка по счёту за период [From, To)
+type Statement struct {
+	Account        types.Account
+	From           time.Time
+	To             time.Time
+	Opening        types.Money
+	Closing        types.Money
+	Lines          []StatementLine
+	CategoryTotals []CategoryTotal
+}
+
+// Statement формирует выписку по счёту за период [from, to)
+func (s *Service) Statement(accountID int64, from time.Time, to time.Time) (*Statement, error) {
+	if to.Before(from) {
+		return nil, ErrInvalidPeriod
+	}
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.AccountEntries(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// начальный баланс восстанавливаем от текущего, откатывая всё, что было после from
+	opening := account.Balance
+	for _, entry := range entries {
+		if !entry.Created.Before(from) {
+			opening -= entry.Amount
+		}
+	}
+
+	statement := &Statement{
+		Account: *account,
+		From:    from,
+		To:      to,
+		Opening: opening,
+	}
+	balance := opening
+	totals := make(map[types.PaymentCategory]types.Money)
+	for _, entry := range entries {
+		if entry.Created.Before(from) || !entry.Created.Before(to) {
+			continue
+		}
+		balance += entry.Amount
+		statement.Lines = append(statement.Lines, StatementLine{Entry: entry, Balance: balance})
+		if entry.Kind == types.EntryPayment || entry.Kind == types.EntryRefund {
+			totals[entry.Category] -= entry.Amount
+		}
+	}
+	statement.Closing = balance
+
+	for category, amount := range totals {
+		statement.CategoryTotals = append(statement.CategoryTotals, CategoryTotal{Category: category, Amount: amount})
+	}
+	sort.Slice(statement.CategoryTotals, func(i, j int) bool {
+		return statement.CategoryTotals[i].Category < statement.CategoryTotals[j].Category
+	})
+	return statement, nil
+}
+
+// MonthlyStatement формирует выписку за календарный месяц
+func (s *Service) MonthlyStatement(accountID int64, year int, month time.Month) (*Statement, error) {
+	from := time.Date(year, month, 1, 0, 0, 0, 0, s.now().Location())
+	return s.Statement(accountID, from, from.AddDate(0, 1, 0))
+}
+
+// StatementRenderer выводит выписку в определённом формате
+type StatementRenderer interface {
+	Render(w io.Writer, statement *Statement) error
+}
+
+// TextRenderer выводит выписку простым текстом с выравниванием по колонкам
+type TextRenderer struct{}
+
+// Render реализует StatementRenderer
+func (TextRenderer) Render(w io.Writer, statement *Statement) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Statement for account %d (%s)\n", statement.Account.ID, statement.Account.Phone)
+	fmt.Fprintf(tw, "Period: %s - %s\n", formatDate(statement.From), formatDate(statement.To))
+	fmt.Fprintf(tw, "Opening balance:\t%s\n\n", FormatMoney(statement.Opening))
+
+	fmt.Fprintln(tw, "Date\tOperation\tCategory\tAmount\tBalance")
+	for _, line := range statement.Lines {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			line.Entry.Created.Format("2006-01-02 15:04"),
+			line.Entry.Kind,
+			line.Entry.Category,
+			FormatMoney(line.Entry.Amount),
+			FormatMoney(line.Balance))
+	}
+
+	fmt.Fprintf(tw, "\nClosing balance:\t%s\n", FormatMoney(statement.Closing))
+	if len(statement.CategoryTotals) > 0 {
+		fmt.Fprintln(tw, "\nSpent by category:")
+		for _, total := range statement.CategoryTotals {
+			fmt.Fprintf(tw, "%s\t%s\n", total.Category, FormatMoney(total.Amount))
+		}
+	}
+	return tw.Flush()
+}
+
+// statementTemplate шаблон выписки по умолчанию для HTMLRenderer
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"money": FormatMoney,
+	"date":  formatDate,
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Statement {{.Account.ID}}</title></head>
+<body>
+<h1>Statement for account {{.Account.ID}} ({{.Account.Phone}})</h1>
+<p>Period: {{date .From}} - {{date .To}}</p>
+<p>Opening balance: {{money .Opening}}</p>
+<table>
+<tr><th>Date</th><th>Operation</th><th>Category</th><th>Amount</th><th>Balance</th></tr>
+{{- range .Lines}}
+<tr><td>{{time .Entry.Created}}</td><td>{{.Entry.Kind}}</td><td>{{.Entry.Category}}</td><td>{{money .Entry.Amount}}</td><td>{{money .Balance}}</td></tr>
+{{- end}}
+</table>
+<p>Closing balance: {{money .Closing}}</p>
+{{- if .CategoryTotals}}
+<h2>Spent by category</h2>
+<table>
+{{- range .CategoryTotals}}
+<tr><td>{{.Category}}</td><td>{{money .Amount}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTMLRenderer выводит выписку в HTML; если Template не задан, используется шаблон по умолчанию
+type HTMLRenderer struct {
+	Template *template.Template
+}
+
+// Render реализует StatementRenderer
+func (r HTMLRenderer) Render(w io.Writer, statement *Statement) error {
+	tmpl := r.Template
+	if tmpl == nil {
+		tmpl = statementTemplate
+	}
+	return tmpl.Execute(w, statement)
+}
+
+// CSVRenderer выводит строки выписки в CSV, суммы - в минимальных единицах
+type CSVRenderer struct{}
+
+// Render реализует StatementRenderer
+func (CSVRenderer) Render(w io.Writer, statement *Statement) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"date", "operation", "reference", "category", "amount", "balance"})
+	writer.Write([]string{statement.From.Format(time.RFC3339), "OPENING", "", "", "", strconv.FormatInt(int64(statement.Opening), 10)})
+	for _, line := range statement.Lines {
+		writer.Write([]string{
+			line.Entry.Created.Format(time.RFC3339),
+			string(line.Entry.Kind),
+			line.Entry.ReferenceID,
+			string(line.Entry.Category),
+			strconv.FormatInt(int64(line.Entry.Amount), 10),
+			strconv.FormatInt(int64(line.Balance), 10),
+		})
+	}
+	writer.Write([]string{statement.To.Format(time.RFC3339), "CLOSING", "", "", "", strconv.FormatInt(int64(statement.Closing), 10)})
+	writer.Flush()
+	return writer.Error()
+}
+
+// FormatMoney выводит сумму в минимальных единицах как "123.45"
+func FormatMoney(amount types.Money) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+func statementService(t *testing.T) (*Service, *types.Account) {
+	t.Helper()
+	svc := &Service{}
+	now := time.Date(2021, 2, 20, 12, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time { return now })
+	account, _ := svc.RegisterAccount("+992000000001")
+	other, _ := svc.RegisterAccount("+992000000002")
+
+	svc.Deposit(account.ID, 100_00)
+	svc.Pay(account.ID, 10_00, "Cafe")
+
+	now = time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)
+	svc.Deposit(account.ID, 50_00)
+	payment, _ := svc.Pay(account.ID, 20_00, "Cafe")
+	svc.Pay(account.ID, 5_00, "auto")
+	svc.Reject(payment.ID)
+	svc.Transfer(account.ID, other.ID, 15_00)
+
+	now = time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	svc.Pay(account.ID, 1_00, "Cafe")
+	return svc, account
+}
+
+func TestService_MonthlyStatement(t *testing.T) {
+	svc, account := statementService(t)
+
+	statement, err := svc.MonthlyStatement(account.ID, 2021, time.March)
+	if err != nil {
+		t.Fatalf("MonthlyStatement(): error = %v", err)
+	}
+	if statement.Opening != 90_00 {
+		t.Errorf("opening: got > %v want > %v", statement.Opening, 90_00)
+	}
+	if statement.Closing != 120_00 {
+		t.Errorf("closing: got > %v want > %v", statement.Closing, 120_00)
+	}
+	if len(statement.Lines) != 5 {
+		t.Fatalf("got %v lines, want 5", len(statement.Lines))
+	}
+	if statement.Lines[1].Balance != 120_00 || statement.Lines[3].Entry.Kind != types.EntryRefund {
+		t.Errorf("unexpected lines: %+v", statement.Lines)
+	}
+
+	want := []CategoryTotal{{Category: "Cafe", Amount: 0}, {Category: "auto", Amount: 5_00}}
+	if len(statement.CategoryTotals) != 2 || statement.CategoryTotals[0] != want[0] || statement.CategoryTotals[1] != want[1] {
+		t.Errorf("category totals: got > %v want > %v", statement.CategoryTotals, want)
+	}
+
+	if _, err := svc.Statement(account.ID, time.Now(), time.Now().Add(-time.Hour)); err != ErrInvalidPeriod {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidPeriod)
+	}
+}
+
+func TestStatementRenderers(t *testing.T) {
+	svc, account := statementService(t)
+	statement, err := svc.MonthlyStatement(account.ID, 2021, time.March)
+	if err != nil {
+		t.Fatalf("MonthlyStatement(): error = %v", err)
+	}
+
+	tests := []struct {
+		renderer StatementRenderer
+		contains []string
+	}{
+		{TextRenderer{}, []string{"Opening balance:", "90.00", "Closing balance:", "120.00", "TRANSFER_OUT"}},
+		{HTMLRenderer{}, []string{"<table>", "<td>-15.00</td>", "Closing balance: 120.00"}},
+		{CSVRenderer{}, []string{"date,operation,reference,category,amount,balance", ",OPENING,,,,9000", ",CLOSING,,,,12000"}},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		if err := test.renderer.Render(buf, statement); err != nil {
+			t.Fatalf("%T.Render(): error = %v", test.renderer, err)
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%T output has no %q:\n%s", test.renderer, want, buf.String())
+			}
+		}
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	if got := FormatMoney(-1_05); got != "-1.05" {
+		t.Errorf("\ngot > %v \nwant > -1.05", got)
+	}
+}
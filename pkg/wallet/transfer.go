@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ошибки переводов
+var ErrSameAccount = errors.New("transfer to the same account")
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// Transfer переводит деньги с одного аккаунта на другой
+func (s *Service) Transfer(fromAccountID int64, toAccountID int64, amount types.Money) (*types.Transfer, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+	if fromAccountID == toAccountID {
+		return nil, ErrSameAccount
+	}
+
+	from, err := s.FindAccountByID(fromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.FindAccountByID(toAccountID)
+	if err != nil {
+		return nil, err
+	}
+	fees := s.fees(types.FeeTransfer, amount, "")
+	if from.Balance < amount+totalFees(fees) {
+		return nil, ErrNotEnoughtBalance
+	}
+	if err := s.checkPayment(from, amount); err != nil {
+		return nil, err
+	}
+	if err := s.checkDeposit(to, amount); err != nil {
+		return nil, err
+	}
+
+	before := AuditState{Account: auditAccount(from), ToAccount: auditAccount(to)}
+	from.Balance -= amount
+	to.Balance += amount
+	transfer := &types.Transfer{
+		ID:            uuid.New().String(),
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        amount,
+		Created:       s.now(),
+		Fees:          fees,
+	}
+	s.transfers = append(s.transfers, transfer)
+	s.record(from.ID, types.EntryTransferOut, -amount, transfer.ID, "")
+	s.record(to.ID, types.EntryTransferIn, amount, transfer.ID, "")
+	s.chargeFees(from, transfer.Fees, transfer.ID, "")
+	transferCopy := *transfer
+	s.audit(AuditTransfer, before, AuditState{Account: auditAccount(from), ToAccount: auditAccount(to), Transfer: &transferCopy},
+		accountTarget(from.ID), accountTarget(to.ID), transferTarget(transfer.ID))
+	s.publish(TransferCreated{EventHeader: s.header(EventTransferCreated, from.ID), Transfer: *transfer})
+	return transfer, nil
+}
+
+// FindTransferByID ищет перевод по ID
+func (s *Service) FindTransferByID(transferID string) (*types.Transfer, error) {
+	for _, transfer := range s.transfers {
+		if transfer.ID == transferID {
+			return transfer, nil
+		}
+	}
+	return nil, ErrTransferNotFound
+}
+
+func (s *Service) exportTransfers(dir string) error {
+	if len(s.transfers) == 0 {
+		return nil
+	}
+
+	rows := make([][]string, 0, len(s.transfers))
+	for _, v := range s.transfers {
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.FromAccountID, 10),
+			strconv.FormatInt(v.ToAccountID, 10),
+			strconv.FormatInt(int64(v.Amount), 10),
+			formatTime(v.Created),
+		})
+	}
+	return writeDump(filepath.Join(dir, "transfers.dump"), rows)
+}
+
+func (s *Service) importTransfers(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "transfers.dump"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 5 {
+			return ErrInvalidDump
+		}
+		from, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		to, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(row[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[4])
+		if err != nil {
+			return err
+		}
+
+		transfer := &types.Transfer{
+			ID:            row[0],
+			FromAccountID: from,
+			ToAccountID:   to,
+			Amount:        types.Money(amount),
+			Created:       created,
+		}
+		if existing, err := s.FindTransferByID(transfer.ID); err == nil {
+			*existing = *transfer
+			continue
+		}
+		s.transfers = append(s.transfers, transfer)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+)
+
+// ErrWithdrawalNotFound вывод с таким ID не найден
+var ErrWithdrawalNotFound = errors.New("withdrawal not found")
+
+// Withdraw выводит деньги со счёта; комиссия списывается сверх amount
+func (s *Service) Withdraw(accountID int64, amount types.Money) (*types.Withdrawal, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	fees := s.fees(types.FeeWithdrawal, amount, "")
+	if account.Balance < amount+totalFees(fees) {
+		return nil, ErrNotEnoughtBalance
+	}
+	if err := s.checkPayment(account, amount); err != nil {
+		return nil, err
+	}
+
+	before := AuditState{Account: auditAccount(account)}
+	withdrawal := &types.Withdrawal{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Amount:    amount,
+		Created:   s.now(),
+		Fees:      fees,
+	}
+	s.applyWithdrawal(account, withdrawal)
+
+	withdrawalCopy := cloneWithdrawal(withdrawal)
+	s.audit(AuditWithdraw, before, AuditState{Account: auditAccount(account), Withdrawal: withdrawalCopy},
+		accountTarget(account.ID), withdrawalTarget(withdrawal.ID))
+	s.publish(Withdrawn{EventHeader: s.header(EventWithdrawn, account.ID), Withdrawal: *withdrawalCopy, Balance: account.Balance})
+	return withdrawal, nil
+}
+
+// FindWithdrawalByID ищет вывод по ID
+func (s *Service) FindWithdrawalByID(withdrawalID string) (*types.Withdrawal, error) {
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.ID == withdrawalID {
+			return withdrawal, nil
+		}
+	}
+	return nil, ErrWithdrawalNotFound
+}
+
+func (s *Service) applyWithdrawal(account *types.Account, withdrawal *types.Withdrawal) {
+	account.Balance -= withdrawal.Amount
+	s.withdrawals = append(s.withdrawals, withdrawal)
+	s.record(account.ID, types.EntryWithdrawal, -withdrawal.Amount, withdrawal.ID, "")
+	s.chargeFees(account, withdrawal.Fees, withdrawal.ID, "")
+}
+
+// chargeFees списывает строки комиссий операции referenceID отдельными проводками
+func (s *Service) chargeFees(account *types.Account, fees []types.FeeLine, referenceID string, category types.PaymentCategory) {
+	if fee := totalFees(fees); fee > 0 {
+		account.Balance -= fee
+		s.record(account.ID, types.EntryFee, -fee, referenceID, category)
+	}
+}
+
+func cloneWithdrawal(withdrawal *types.Withdrawal) *types.Withdrawal {
+	clone := *withdrawal
+	clone.Fees = cloneFees(withdrawal.Fees)
+	return &clone
+}
+
+func cloneFees(fees []types.FeeLine) []types.FeeLine {
+	if fees == nil {
+		return nil
+	}
+	return append([]types.FeeLine{}, fees...)
+}
+
+func (s *Service) exportWithdrawals(dir string) error {
+	if len(s.withdrawals) == 0 {
+		return nil
+	}
+
+	rows := make([][]string, 0, len(s.withdrawals))
+	for _, v := range s.withdrawals {
+		rows = append(rows, []string{
+			v.ID,
+			strconv.FormatInt(v.AccountID, 10),
+			strconv.FormatInt(int64(v.Amount), 10),
+			formatTime(v.Created),
+		})
+	}
+	return writeDump(filepath.Join(dir, "withdrawals.dump"), rows)
+}
+
+func (s *Service) importWithdrawals(dir string) error {
+	rows, err := readDump(filepath.Join(dir, "withdrawals.dump"))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 4 {
+			return ErrInvalidDump
+		}
+		accountID, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		amount, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		created, err := parseTime(row[3])
+		if err != nil {
+			return err
+		}
+
+		withdrawal := &types.Withdrawal{
+			ID:        row[0],
+			AccountID: accountID,
+			Amount:    types.Money(amount),
+			Created:   created,
+		}
+		if existing, err := s.FindWithdrawalByID(withdrawal.ID); err == nil {
+			withdrawal.Fees = existing.Fees
+			*existing = *withdrawal
+			continue
+		}
+		s.withdrawals = append(s.withdrawals, withdrawal)
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package walletpb содержит код, сгенерированный из proto/wallet/v1/wallet.proto
+package walletpb
+
+//go:generate sh -c "cd ../.. && buf generate proto"
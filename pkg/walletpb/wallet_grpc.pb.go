@@ -0,0 +1,455 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package walletpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// WalletClient is the client API for Wallet service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WalletClient interface {
+	RegisterAccount(ctx context.Context, in *RegisterAccountRequest, opts ...grpc.CallOption) (*Account, error)
+	Deposit(ctx context.Context, in *DepositRequest, opts ...grpc.CallOption) (*Account, error)
+	SetAccountTier(ctx context.Context, in *SetAccountTierRequest, opts ...grpc.CallOption) (*TierChange, error)
+	Pay(ctx context.Context, in *PayRequest, opts ...grpc.CallOption) (*Payment, error)
+	Reject(ctx context.Context, in *RejectRequest, opts ...grpc.CallOption) (*Payment, error)
+	Repeat(ctx context.Context, in *RepeatRequest, opts ...grpc.CallOption) (*Payment, error)
+	FavoritePayment(ctx context.Context, in *FavoritePaymentRequest, opts ...grpc.CallOption) (*Favorite, error)
+	PayFromFavorite(ctx context.Context, in *PayFromFavoriteRequest, opts ...grpc.CallOption) (*Payment, error)
+	ExportAccountHistory(ctx context.Context, in *ExportAccountHistoryRequest, opts ...grpc.CallOption) (*ExportAccountHistoryResponse, error)
+	// SumPaymentsWithProgress отправляет отчёт по мере готовности каждого куска.
+	SumPaymentsWithProgress(ctx context.Context, in *SumPaymentsWithProgressRequest, opts ...grpc.CallOption) (Wallet_SumPaymentsWithProgressClient, error)
+}
+
+type walletClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWalletClient(cc grpc.ClientConnInterface) WalletClient {
+	return &walletClient{cc}
+}
+
+func (c *walletClient) RegisterAccount(ctx context.Context, in *RegisterAccountRequest, opts ...grpc.CallOption) (*Account, error) {
+	out := new(Account)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/RegisterAccount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) Deposit(ctx context.Context, in *DepositRequest, opts ...grpc.CallOption) (*Account, error) {
+	out := new(Account)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/Deposit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) SetAccountTier(ctx context.Context, in *SetAccountTierRequest, opts ...grpc.CallOption) (*TierChange, error) {
+	out := new(TierChange)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/SetAccountTier", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) Pay(ctx context.Context, in *PayRequest, opts ...grpc.CallOption) (*Payment, error) {
+	out := new(Payment)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/Pay", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) Reject(ctx context.Context, in *RejectRequest, opts ...grpc.CallOption) (*Payment, error) {
+	out := new(Payment)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/Reject", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) Repeat(ctx context.Context, in *RepeatRequest, opts ...grpc.CallOption) (*Payment, error) {
+	out := new(Payment)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/Repeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) FavoritePayment(ctx context.Context, in *FavoritePaymentRequest, opts ...grpc.CallOption) (*Favorite, error) {
+	out := new(Favorite)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/FavoritePayment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) PayFromFavorite(ctx context.Context, in *PayFromFavoriteRequest, opts ...grpc.CallOption) (*Payment, error) {
+	out := new(Payment)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/PayFromFavorite", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) ExportAccountHistory(ctx context.Context, in *ExportAccountHistoryRequest, opts ...grpc.CallOption) (*ExportAccountHistoryResponse, error) {
+	out := new(ExportAccountHistoryResponse)
+	err := c.cc.Invoke(ctx, "/wallet.v1.Wallet/ExportAccountHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletClient) SumPaymentsWithProgress(ctx context.Context, in *SumPaymentsWithProgressRequest, opts ...grpc.CallOption) (Wallet_SumPaymentsWithProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Wallet_ServiceDesc.Streams[0], "/wallet.v1.Wallet/SumPaymentsWithProgress", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &walletSumPaymentsWithProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Wallet_SumPaymentsWithProgressClient interface {
+	Recv() (*Progress, error)
+	grpc.ClientStream
+}
+
+type walletSumPaymentsWithProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *walletSumPaymentsWithProgressClient) Recv() (*Progress, error) {
+	m := new(Progress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WalletServer is the server API for Wallet service.
+// All implementations must embed UnimplementedWalletServer
+// for forward compatibility
+type WalletServer interface {
+	RegisterAccount(context.Context, *RegisterAccountRequest) (*Account, error)
+	Deposit(context.Context, *DepositRequest) (*Account, error)
+	SetAccountTier(context.Context, *SetAccountTierRequest) (*TierChange, error)
+	Pay(context.Context, *PayRequest) (*Payment, error)
+	Reject(context.Context, *RejectRequest) (*Payment, error)
+	Repeat(context.Context, *RepeatRequest) (*Payment, error)
+	FavoritePayment(context.Context, *FavoritePaymentRequest) (*Favorite, error)
+	PayFromFavorite(context.Context, *PayFromFavoriteRequest) (*Payment, error)
+	ExportAccountHistory(context.Context, *ExportAccountHistoryRequest) (*ExportAccountHistoryResponse, error)
+	// SumPaymentsWithProgress отправляет отчёт по мере готовности каждого куска.
+	SumPaymentsWithProgress(*SumPaymentsWithProgressRequest, Wallet_SumPaymentsWithProgressServer) error
+	mustEmbedUnimplementedWalletServer()
+}
+
+// UnimplementedWalletServer must be embedded to have forward compatible implementations.
+type UnimplementedWalletServer struct {
+}
+
+func (UnimplementedWalletServer) RegisterAccount(context.Context, *RegisterAccountRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAccount not implemented")
+}
+func (UnimplementedWalletServer) Deposit(context.Context, *DepositRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deposit not implemented")
+}
+func (UnimplementedWalletServer) SetAccountTier(context.Context, *SetAccountTierRequest) (*TierChange, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAccountTier not implemented")
+}
+func (UnimplementedWalletServer) Pay(context.Context, *PayRequest) (*Payment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pay not implemented")
+}
+func (UnimplementedWalletServer) Reject(context.Context, *RejectRequest) (*Payment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reject not implemented")
+}
+func (UnimplementedWalletServer) Repeat(context.Context, *RepeatRequest) (*Payment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Repeat not implemented")
+}
+func (UnimplementedWalletServer) FavoritePayment(context.Context, *FavoritePaymentRequest) (*Favorite, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FavoritePayment not implemented")
+}
+func (UnimplementedWalletServer) PayFromFavorite(context.Context, *PayFromFavoriteRequest) (*Payment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PayFromFavorite not implemented")
+}
+func (UnimplementedWalletServer) ExportAccountHistory(context.Context, *ExportAccountHistoryRequest) (*ExportAccountHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportAccountHistory not implemented")
+}
+func (UnimplementedWalletServer) SumPaymentsWithProgress(*SumPaymentsWithProgressRequest, Wallet_SumPaymentsWithProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method SumPaymentsWithProgress not implemented")
+}
+func (UnimplementedWalletServer) mustEmbedUnimplementedWalletServer() {}
+
+// UnsafeWalletServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WalletServer will
+// result in compilation errors.
+type UnsafeWalletServer interface {
+	mustEmbedUnimplementedWalletServer()
+}
+
+func RegisterWalletServer(s grpc.ServiceRegistrar, srv WalletServer) {
+	s.RegisterService(&Wallet_ServiceDesc, srv)
+}
+
+func _Wallet_RegisterAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).RegisterAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/RegisterAccount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).RegisterAccount(ctx, req.(*RegisterAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_Deposit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DepositRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).Deposit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/Deposit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).Deposit(ctx, req.(*DepositRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_SetAccountTier_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetAccountTierRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).SetAccountTier(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/SetAccountTier",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).SetAccountTier(ctx, req.(*SetAccountTierRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_Pay_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PayRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).Pay(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/Pay",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).Pay(ctx, req.(*PayRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_Reject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RejectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).Reject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/Reject",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).Reject(ctx, req.(*RejectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_Repeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RepeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).Repeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/Repeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).Repeat(ctx, req.(*RepeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_FavoritePayment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FavoritePaymentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).FavoritePayment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/FavoritePayment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).FavoritePayment(ctx, req.(*FavoritePaymentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_PayFromFavorite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PayFromFavoriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).PayFromFavorite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/PayFromFavorite",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).PayFromFavorite(ctx, req.(*PayFromFavoriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_ExportAccountHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportAccountHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WalletServer).ExportAccountHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wallet.v1.Wallet/ExportAccountHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WalletServer).ExportAccountHistory(ctx, req.(*ExportAccountHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wallet_SumPaymentsWithProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SumPaymentsWithProgressRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WalletServer).SumPaymentsWithProgress(m, &walletSumPaymentsWithProgressServer{stream})
+}
+
+type Wallet_SumPaymentsWithProgressServer interface {
+	Send(*Progress) error
+	grpc.ServerStream
+}
+
+type walletSumPaymentsWithProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *walletSumPaymentsWithProgressServer) Send(m *Progress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Wallet_ServiceDesc is the grpc.ServiceDesc for Wallet service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Wallet_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wallet.v1.Wallet",
+	HandlerType: (*WalletServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterAccount",
+			Handler:    _Wallet_RegisterAccount_Handler,
+		},
+		{
+			MethodName: "Deposit",
+			Handler:    _Wallet_Deposit_Handler,
+		},
+		{
+			MethodName: "SetAccountTier",
+			Handler:    _Wallet_SetAccountTier_Handler,
+		},
+		{
+			MethodName: "Pay",
+			Handler:    _Wallet_Pay_Handler,
+		},
+		{
+			MethodName: "Reject",
+			Handler:    _Wallet_Reject_Handler,
+		},
+		{
+			MethodName: "Repeat",
+			Handler:    _Wallet_Repeat_Handler,
+		},
+		{
+			MethodName: "FavoritePayment",
+			Handler:    _Wallet_FavoritePayment_Handler,
+		},
+		{
+			MethodName: "PayFromFavorite",
+			Handler:    _Wallet_PayFromFavorite_Handler,
+		},
+		{
+			MethodName: "ExportAccountHistory",
+			Handler:    _Wallet_ExportAccountHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SumPaymentsWithProgress",
+			Handler:       _Wallet_SumPaymentsWithProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "wallet/v1/wallet.proto",
+}
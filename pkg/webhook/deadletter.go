@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery доставка события одной подписке
+type Delivery struct {
+	ID             string
+	SubscriptionID string
+	Event          string
+	Body           []byte
+	Attempts       int
+	LastError      string
+	LastStatus     int // HTTP статус последней попытки, 0 - ответа не было
+	Created        time.Time
+	LastAttempt    time.Time
+}
+
+// DeadLetterStore хранит доставки, которые не удалось выполнить
+type DeadLetterStore interface {
+	Put(delivery Delivery) error
+	Get(id string) (Delivery, error)
+	Delete(id string) error
+	List() ([]Delivery, error)
+}
+
+// MemoryDeadLetters хранилище недоставленных событий в памяти
+type MemoryDeadLetters struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+}
+
+// NewMemoryDeadLetters создаёт пустое хранилище
+func NewMemoryDeadLetters() *MemoryDeadLetters {
+	return &MemoryDeadLetters{deliveries: make(map[string]Delivery)}
+}
+
+// Put реализует DeadLetterStore
+func (m *MemoryDeadLetters) Put(delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// Get реализует DeadLetterStore
+func (m *MemoryDeadLetters) Get(id string) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// Delete реализует DeadLetterStore
+func (m *MemoryDeadLetters) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[id]; !ok {
+		return ErrDeliveryNotFound
+	}
+	delete(m.deliveries, id)
+	return nil
+}
+
+// List реализует DeadLetterStore, доставки упорядочены по времени создания
+func (m *MemoryDeadLetters) List() ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Delivery, 0, len(m.deliveries))
+	for _, delivery := range m.deliveries {
+		result = append(result, delivery)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.Before(result[j].Created)
+	})
+	return result, nil
+}
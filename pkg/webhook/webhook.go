@@ -0,0 +1,504 @@
+// Package webhook отправляет события платежей на HTTP адреса подписчиков.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+// ошибки вебхуков
+var ErrInvalidURL = errors.New("webhook url must be absolute http or https url")
+var ErrEmptySecret = errors.New("webhook secret must not be empty")
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// заголовки запроса
+const (
+	HeaderEvent     = "X-Wallet-Event"
+	HeaderDelivery  = "X-Wallet-Delivery"
+	HeaderTimestamp = "X-Wallet-Timestamp"
+	HeaderSignature = "X-Wallet-Signature"
+)
+
+// PaymentEvents события, которые отправляются подписчикам
+var PaymentEvents = []wallet.EventType{wallet.EventPaymentCreated, wallet.EventPaymentConfirmed, wallet.EventPaymentRejected}
+
+// Subscription подписка на события платежей; пустые Category и AccountID - любые
+type Subscription struct {
+	ID        string
+	URL       string
+	Secret    string
+	Category  types.PaymentCategory
+	AccountID int64
+}
+
+func (sub *Subscription) matches(payment types.Payment, inCategory func(value, category types.PaymentCategory) bool) bool {
+	return (sub.Category == "" || inCategory(payment.Category, sub.Category)) &&
+		(sub.AccountID == 0 || sub.AccountID == payment.AccountID)
+}
+
+// sameCategory сравнивает категории без учёта регистра и пробелов, без каталога
+func sameCategory(value, category types.PaymentCategory) bool {
+	return wallet.CanonicalCategory(string(value)) == wallet.CanonicalCategory(string(category))
+}
+
+// Payload тело запроса; Rewards - начисления за подтверждённый платёж
+type Payload struct {
+	Event    wallet.EventType `json:"event"`
+	Sequence int64            `json:"sequence"`
+	Time     time.Time        `json:"time"`
+	Payment  types.Payment    `json:"payment"`
+	Rewards  []types.Reward   `json:"rewards,omitempty"`
+}
+
+// RetryPolicy экспоненциальные повторы: перед попыткой n+1 ждём
+// InitialBackoff * Multiplier^(n-1), но не больше MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy политика повторов по умолчанию
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+}
+
+// Backoff пауза после неудачной попытки attempt (с 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.Multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+// DefaultMaxPending сколько событий одной подписки и аккаунта может ждать повторов по умолчанию
+const DefaultMaxPending = 1000
+
+// Options настройки Dispatcher, нулевые значения заменяются значениями по умолчанию
+type Options struct {
+	Client      *http.Client
+	Retry       RetryPolicy
+	DeadLetters DeadLetterStore
+	Clock       func() time.Time
+	// MaxPending событий одной подписки и аккаунта в очереди повторов;
+	// сверх лимита событие сразу попадает в DeadLetters
+	MaxPending int
+	// InCategory проверяет, относится ли категория платежа к категории подписки,
+	// обычно wallet.Service.InCategory, чтобы подписка на категорию получала и подкатегории.
+	// Вызывается из обработчика шины: при синхронной подписке сервис уже заблокирован
+	// вызывающим, при Attach с workers функция сама должна взять блокировку сервиса.
+	// nil - сравнение канонических имён без каталога
+	InCategory func(value, category types.PaymentCategory) bool
+}
+
+// Dispatcher доставляет события платежей подписчикам вебхуков
+type Dispatcher struct {
+	client      *http.Client
+	retry       RetryPolicy
+	deadLetters DeadLetterStore
+	clock       func() time.Time
+	maxPending  int
+	inCategory  func(value, category types.PaymentCategory) bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu            sync.RWMutex
+	subscriptions []*Subscription
+
+	// очереди повторов по подписке и аккаунту, у каждой своя горутина
+	retryMu sync.Mutex
+	idle    *sync.Cond
+	retries map[string][]pendingDelivery
+	closed  bool
+}
+
+// pendingDelivery событие в очереди повторов
+type pendingDelivery struct {
+	sub      Subscription
+	delivery *Delivery
+}
+
+// NewDispatcher создаёт Dispatcher
+func NewDispatcher(opts Options) *Dispatcher {
+	d := &Dispatcher{
+		client:      opts.Client,
+		retry:       opts.Retry,
+		deadLetters: opts.DeadLetters,
+		clock:       opts.Clock,
+		maxPending:  opts.MaxPending,
+		inCategory:  opts.InCategory,
+		retries:     make(map[string][]pendingDelivery),
+	}
+	d.idle = sync.NewCond(&d.retryMu)
+	if d.client == nil {
+		d.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if d.retry.MaxAttempts <= 0 {
+		d.retry = DefaultRetryPolicy
+	}
+	if d.deadLetters == nil {
+		d.deadLetters = NewMemoryDeadLetters()
+	}
+	if d.clock == nil {
+		d.clock = time.Now
+	}
+	if d.maxPending <= 0 {
+		d.maxPending = DefaultMaxPending
+	}
+	if d.inCategory == nil {
+		d.inCategory = sameCategory
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d
+}
+
+// Attach подписывает Dispatcher на события платежей шины bus. Доставка асинхронная;
+// повторы для аккаунта задерживают его следующие события, так что порядок сохраняется,
+// но выполняются вне горутин шины и не задерживают события других аккаунтов
+func (d *Dispatcher) Attach(bus *wallet.EventBus, workers int) *wallet.Subscription {
+	return bus.Subscribe(d.Handle, wallet.SubscribeOptions{
+		Mode:    wallet.DeliverAsync,
+		Types:   PaymentEvents,
+		Workers: workers,
+	})
+}
+
+// Close прерывает ожидание повторов и ждёт, пока прерванные доставки попадут в хранилище недоставленных
+func (d *Dispatcher) Close() {
+	d.retryMu.Lock()
+	d.closed = true
+	d.retryMu.Unlock()
+	d.cancel()
+	d.Wait()
+}
+
+// Wait ждёт, пока все события из очередей повторов будут доставлены или попадут в DeadLetters
+func (d *Dispatcher) Wait() {
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	for len(d.retries) > 0 {
+		d.idle.Wait()
+	}
+}
+
+// Subscribe добавляет подписку и возвращает её с назначенным ID
+func (d *Dispatcher) Subscribe(sub Subscription) (*Subscription, error) {
+	parsed, err := url.Parse(sub.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	if sub.Secret == "" {
+		return nil, ErrEmptySecret
+	}
+
+	sub.ID = uuid.New().String()
+	d.mu.Lock()
+	d.subscriptions = append(d.subscriptions, &sub)
+	d.mu.Unlock()
+	result := sub
+	return &result, nil
+}
+
+// Unsubscribe удаляет подписку
+func (d *Dispatcher) Unsubscribe(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, sub := range d.subscriptions {
+		if sub.ID == id {
+			d.subscriptions = append(d.subscriptions[:i], d.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrSubscriptionNotFound
+}
+
+// Subscriptions возвращает все подписки
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	result := make([]Subscription, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		result = append(result, *sub)
+	}
+	return result
+}
+
+func (d *Dispatcher) subscription(id string) (Subscription, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, sub := range d.subscriptions {
+		if sub.ID == id {
+			return *sub, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// DeadLetters возвращает хранилище недоставленных событий
+func (d *Dispatcher) DeadLetters() DeadLetterStore {
+	return d.deadLetters
+}
+
+// Handle обработчик wallet.EventHandler: отправляет событие платежа всем подходящим
+// подписчикам, недоставленные события сохраняются в DeadLetters. Handle делает только
+// первую попытку; повторы с паузами выполняет отдельная горутина, поэтому недоступный
+// адрес задерживает обработчик не дольше одного запроса
+func (d *Dispatcher) Handle(event wallet.Event) {
+	payload, ok := payloadOf(event)
+	if !ok {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	d.mu.RLock()
+	var targets []Subscription
+	for _, sub := range d.subscriptions {
+		if sub.matches(payload.Payment, d.inCategory) {
+			targets = append(targets, *sub)
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, sub := range targets {
+		delivery := Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			Event:          string(payload.Event),
+			Body:           body,
+			Created:        d.clock(),
+		}
+		d.dispatch(sub, payload.Payment.AccountID, &delivery)
+	}
+}
+
+// dispatch делает первую попытку или, если у подписки и аккаунта уже есть очередь повторов,
+// ставит событие за ней, чтобы не обогнать предыдущие события аккаунта
+func (d *Dispatcher) dispatch(sub Subscription, accountID int64, delivery *Delivery) {
+	key := sub.ID + ":" + strconv.FormatInt(accountID, 10)
+	if d.enqueue(key, sub, delivery, false) {
+		return
+	}
+
+	err := d.attempt(d.ctx, sub, delivery)
+	if err == nil {
+		return
+	}
+	if !retryable(delivery.LastStatus) || delivery.Attempts >= d.retry.MaxAttempts || !d.enqueue(key, sub, delivery, true) {
+		d.deadLetters.Put(*delivery)
+	}
+}
+
+// enqueue ставит событие в очередь повторов key. Без create событие ставится, только если
+// очередь уже есть. Возвращает false, если событие не поставлено; переполненная очередь
+// сама сохраняет событие в DeadLetters и возвращает true
+func (d *Dispatcher) enqueue(key string, sub Subscription, delivery *Delivery, create bool) bool {
+	d.retryMu.Lock()
+	defer d.retryMu.Unlock()
+	if d.closed {
+		return false
+	}
+	queue, ok := d.retries[key]
+	if !ok && !create {
+		return false
+	}
+	if len(queue) >= d.maxPending {
+		delivery.LastError = "retry queue is full"
+		d.deadLetters.Put(*delivery)
+		return true
+	}
+	d.retries[key] = append(queue, pendingDelivery{sub: sub, delivery: delivery})
+	if !ok {
+		go d.drain(key)
+	}
+	return true
+}
+
+// drain по очереди доставляет события очереди повторов key и удаляет её, когда она опустеет
+func (d *Dispatcher) drain(key string) {
+	for {
+		d.retryMu.Lock()
+		queue := d.retries[key]
+		if len(queue) == 0 {
+			delete(d.retries, key)
+			d.idle.Broadcast()
+			d.retryMu.Unlock()
+			return
+		}
+		next := queue[0]
+		d.retryMu.Unlock()
+
+		d.deliver(d.ctx, next.sub, next.delivery)
+
+		d.retryMu.Lock()
+		d.retries[key] = d.retries[key][1:]
+		d.retryMu.Unlock()
+	}
+}
+
+// Redeliver повторно отправляет недоставленное событие одной попыткой;
+// при успехе оно удаляется из хранилища, иначе обновляется
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) error {
+	delivery, err := d.deadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+	sub, ok := d.subscription(delivery.SubscriptionID)
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	err = d.attempt(ctx, sub, &delivery)
+	if err != nil {
+		if putErr := d.deadLetters.Put(delivery); putErr != nil {
+			return putErr
+		}
+		return err
+	}
+	return d.deadLetters.Delete(id)
+}
+
+// RedeliverAll повторно отправляет все недоставленные события и возвращает количество доставленных
+func (d *Dispatcher) RedeliverAll(ctx context.Context) (int, error) {
+	deliveries, err := d.deadLetters.List()
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, delivery := range deliveries {
+		if err := ctx.Err(); err != nil {
+			return delivered, err
+		}
+		if d.Redeliver(ctx, delivery.ID) == nil {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliver выполняет оставшиеся попытки по политике повторов, перед повтором выдерживает паузу;
+// неудачную доставку сохраняет в DeadLetters
+func (d *Dispatcher) deliver(ctx context.Context, sub Subscription, delivery *Delivery) {
+	for {
+		if delivery.Attempts > 0 {
+			if !retryable(delivery.LastStatus) || delivery.Attempts >= d.retry.MaxAttempts {
+				break
+			}
+			timer := time.NewTimer(d.retry.Backoff(delivery.Attempts))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			if err := ctx.Err(); err != nil {
+				delivery.LastError = err.Error()
+				break
+			}
+		}
+		if d.attempt(ctx, sub, delivery) == nil {
+			return
+		}
+	}
+	d.deadLetters.Put(*delivery)
+}
+
+// attempt одна попытка отправки
+func (d *Dispatcher) attempt(ctx context.Context, sub Subscription, delivery *Delivery) error {
+	delivery.Attempts++
+	delivery.LastAttempt = d.clock()
+	delivery.LastStatus = 0
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		delivery.LastError = err.Error()
+		return err
+	}
+	timestamp := strconv.FormatInt(delivery.LastAttempt.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.LastError = err.Error()
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	delivery.LastStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+		delivery.LastError = err.Error()
+		return err
+	}
+	delivery.LastError = ""
+	return nil
+}
+
+// retryable сетевые ошибки, 5xx, 408 и 429 повторяются, остальные ответы 4xx - нет
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+func payloadOf(event wallet.Event) (Payload, bool) {
+	header := event.Header()
+	payload := Payload{Event: header.Type, Sequence: header.Sequence, Time: header.Time}
+	switch event := event.(type) {
+	case wallet.PaymentCreated:
+		payload.Payment = event.Payment
+	case wallet.PaymentConfirmed:
+		payload.Payment = event.Payment
+		payload.Rewards = event.Rewards
+	case wallet.PaymentRejected:
+		payload.Payment = event.Payment
+	default:
+		return Payload{}, false
+	}
+	return payload, true
+}
+
+// Sign подпись запроса: "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись запроса на стороне получателя
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,318 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shodikhuja83/wallet/pkg/types"
+	"github.com/shodikhuja83/wallet/pkg/wallet"
+)
+
+var testRetry = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+}
+
+// receiver тестовый получатель вебхуков, отвечает статусами из statuses по очереди
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	payloads []Payload
+	attempts int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+	if !Verify(r.secret, req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature)) {
+		r.t.Errorf("invalid signature %q", req.Header.Get(HeaderSignature))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			r.t.Error(err)
+		}
+		r.payloads = append(r.payloads, payload)
+	}
+	w.WriteHeader(status)
+}
+
+func setup(t *testing.T, statuses ...int) (*wallet.Service, *Dispatcher, *receiver, *httptest.Server) {
+	t.Helper()
+	recv := &receiver{t: t, secret: "secret", statuses: statuses}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	svc := &wallet.Service{}
+	bus := wallet.NewEventBus()
+	svc.SetEventBus(bus)
+	dispatcher := NewDispatcher(Options{Client: server.Client(), Retry: testRetry})
+	bus.Subscribe(dispatcher.Handle, wallet.SubscribeOptions{Types: PaymentEvents})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	return svc, dispatcher, recv, server
+}
+
+func TestDispatcher_deliversMatchingEvents(t *testing.T) {
+	svc, dispatcher, recv, server := setup(t)
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret", Category: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+
+	payment, err := svc.Pay(1, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(1, 100_00, "food"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recv.payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(recv.payloads))
+	}
+	if recv.payloads[0].Event != wallet.EventPaymentCreated || recv.payloads[0].Payment.ID != payment.ID {
+		t.Errorf("first payload = %+v", recv.payloads[0])
+	}
+	if recv.payloads[1].Event != wallet.EventPaymentRejected || recv.payloads[1].Payment.Status != types.PaymentStatusFail {
+		t.Errorf("second payload = %+v", recv.payloads[1])
+	}
+}
+
+func TestDispatcher_matchesSubcategories(t *testing.T) {
+	recv := &receiver{t: t, secret: "secret"}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	svc := &wallet.Service{}
+	bus := wallet.NewEventBus()
+	svc.SetEventBus(bus)
+	dispatcher := NewDispatcher(Options{Client: server.Client(), Retry: testRetry, InCategory: svc.InCategory})
+	bus.Subscribe(dispatcher.Handle, wallet.SubscribeOptions{Types: PaymentEvents})
+	if _, err := svc.RegisterCategory("food", "Food", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RegisterCategory("cafe", "Cafe", "food"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RegisterCategory("auto", "Auto", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret", Category: "Food"}); err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := svc.RegisterAccount("+992000000001")
+	svc.Deposit(account.ID, 1_000_00)
+	for _, category := range []types.PaymentCategory{"Cafe", "food", "auto"} {
+		if _, err := svc.Pay(account.ID, 10_00, category); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(recv.payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(recv.payloads))
+	}
+	if recv.payloads[0].Payment.Category != "cafe" || recv.payloads[1].Payment.Category != "food" {
+		t.Errorf("payloads = %+v", recv.payloads)
+	}
+}
+
+func TestDispatcher_deliversConfirmedPayments(t *testing.T) {
+	svc, dispatcher, recv, server := setup(t)
+	if err := svc.SetRewardRules([]types.RewardRule{{Kind: types.RewardCashback, BasisPoints: 500}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret", AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	payment, err := svc.Pay(1, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Confirm(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recv.payloads) != 2 {
+		t.Fatalf("got %d payloads, want 2", len(recv.payloads))
+	}
+	confirmed := recv.payloads[1]
+	if confirmed.Event != wallet.EventPaymentConfirmed || confirmed.Payment.Status != types.PaymentStatusOk {
+		t.Errorf("confirmed payload = %+v", confirmed)
+	}
+	if len(confirmed.Rewards) != 1 || confirmed.Rewards[0].Amount != 5_00 {
+		t.Errorf("confirmed rewards = %+v, want one 5_00 cashback", confirmed.Rewards)
+	}
+}
+
+func TestDispatcher_retriesWithBackoff(t *testing.T) {
+	svc, dispatcher, recv, server := setup(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret", AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Pay(1, 100_00, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Wait()
+	if recv.attempts != 3 || len(recv.payloads) != 1 {
+		t.Errorf("attempts = %d, payloads = %d; want 3 and 1", recv.attempts, len(recv.payloads))
+	}
+	if deliveries, _ := dispatcher.DeadLetters().List(); len(deliveries) != 0 {
+		t.Errorf("got %d dead letters, want 0", len(deliveries))
+	}
+}
+
+func TestDispatcher_deadLetterAndRedeliver(t *testing.T) {
+	svc, dispatcher, recv, server := setup(t,
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, // все попытки первого платежа
+		http.StatusBadRequest, // без повторов
+	)
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Pay(1, 100_00, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(1, 100_00, "food"); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Wait()
+	if recv.attempts != 4 {
+		t.Errorf("attempts = %d, want 4", recv.attempts)
+	}
+
+	deliveries, err := dispatcher.DeadLetters().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d dead letters, want 2", len(deliveries))
+	}
+	if deliveries[0].Attempts != 3 || deliveries[0].LastStatus != http.StatusBadGateway {
+		t.Errorf("first dead letter = %+v", deliveries[0])
+	}
+	if deliveries[1].Attempts != 1 || deliveries[1].LastStatus != http.StatusBadRequest {
+		t.Errorf("second dead letter = %+v", deliveries[1])
+	}
+
+	delivered, err := dispatcher.RedeliverAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 2 || len(recv.payloads) != 2 {
+		t.Errorf("delivered = %d, payloads = %d; want 2 and 2", delivered, len(recv.payloads))
+	}
+	if deliveries, _ := dispatcher.DeadLetters().List(); len(deliveries) != 0 {
+		t.Errorf("got %d dead letters after redelivery, want 0", len(deliveries))
+	}
+	if err := dispatcher.Redeliver(context.Background(), deliveries[0].ID); err != ErrDeliveryNotFound {
+		t.Errorf("Redeliver error = %v, want %v", err, ErrDeliveryNotFound)
+	}
+}
+
+func TestDispatcher_retriesOffTheHandler(t *testing.T) {
+	svc, dispatcher, recv, server := setup(t, http.StatusServiceUnavailable)
+	dispatcher.retry = RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, Multiplier: 2}
+	if _, err := dispatcher.Subscribe(Subscription{URL: server.URL, Secret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// первая попытка неудачна, но платёж не ждёт часовой паузы перед повтором,
+	// а следующее событие аккаунта встаёт в очередь за первым
+	start := time.Now()
+	if _, err := svc.Pay(1, 100_00, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(1, 100_00, "food"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("payments took %v", elapsed)
+	}
+
+	// Close прерывает паузу, оба события попадают в DeadLetters в порядке публикации
+	dispatcher.Close()
+	recv.mu.Lock()
+	attempts := recv.attempts
+	recv.mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	deliveries, err := dispatcher.DeadLetters().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].LastError != context.Canceled.Error() {
+		t.Fatalf("dead letters = %+v", deliveries)
+	}
+	var first, second Payload
+	json.Unmarshal(deliveries[0].Body, &first)
+	json.Unmarshal(deliveries[1].Body, &second)
+	if first.Payment.Category != "auto" || second.Payment.Category != "food" {
+		t.Errorf("dead letters out of order: %v, %v", first.Payment.Category, second.Payment.Category)
+	}
+}
+
+func TestDispatcher_Subscribe_validation(t *testing.T) {
+	dispatcher := NewDispatcher(Options{})
+	if _, err := dispatcher.Subscribe(Subscription{URL: "ftp://example.com", Secret: "secret"}); err != ErrInvalidURL {
+		t.Errorf("error = %v, want %v", err, ErrInvalidURL)
+	}
+	if _, err := dispatcher.Subscribe(Subscription{URL: "https://example.com/hook"}); err != ErrEmptySecret {
+		t.Errorf("error = %v, want %v", err, ErrEmptySecret)
+	}
+	sub, err := dispatcher.Subscribe(Subscription{URL: "https://example.com/hook", Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Unsubscribe(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Unsubscribe(sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("error = %v, want %v", err, ErrSubscriptionNotFound)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Multiplier: 2}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, backoff := range want {
+		if got := policy.Backoff(i + 1); got != backoff {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, backoff)
+		}
+	}
+}